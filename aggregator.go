@@ -0,0 +1,402 @@
+package batchsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reducer 聚合列的归约方式
+type Reducer uint8
+
+const (
+	// ReduceLast 取最后一次提交的值（未声明归约的非键列默认使用）
+	ReduceLast Reducer = iota
+	// ReduceSum 数值求和（计数器 +1 场景）
+	ReduceSum
+	// ReduceMax 取最大值（数值、字符串、time.Time）
+	ReduceMax
+	// ReduceMin 取最小值（数值、字符串、time.Time）
+	ReduceMin
+)
+
+// AggregateSpec 单表聚合声明
+type AggregateSpec struct {
+	// KeyColumns 聚合键列；为空时使用 Schema.ConflictKeyColumns()
+	KeyColumns []string
+	// Reducers 列 -> 归约方式；未声明的非键列使用 ReduceLast
+	Reducers map[string]Reducer
+}
+
+// Aggregator 写入前的内存聚合层
+// 架构：Application -> Aggregator -> BatchSQL -> ...
+//
+// 在一个聚合窗口内，按表与聚合键将多次提交折叠为一行，窗口结束时每个键只向 BatchSQL 提交一次；
+// 适合 (key, +1) 这类计数器写入，配合 ConflictUpdate 形成 upsert。
+// 未注册聚合声明的表、以及聚合键含 NULL（或缺失）的行（SQL 中 NULL 互不相等）直接透传给 BatchSQL。
+// 折叠后的行完成时依次调用被折叠各请求的 OnComplete。
+//
+// 关闭顺序：BatchSQL 随其 ctx 结束而关闭，之后的 Submit 均会失败。
+// 应先调用 Close 提交最后一个窗口，再结束 BatchSQL 的 ctx，否则该窗口的聚合结果会丢失。
+type Aggregator struct {
+	batch  *BatchSQL
+	window time.Duration
+
+	mu      sync.Mutex
+	specs   map[*Schema]AggregateSpec
+	buckets map[*Schema]*aggregateBucket
+	order   []*Schema // 表首次出现顺序，保证输出稳定
+	closed  bool
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// aggregateBucket 单表在当前窗口内的聚合结果
+type aggregateBucket struct {
+	rows map[string]*Request
+	keys []string // 键首次出现顺序
+}
+
+// NewAggregator 创建聚合层并启动窗口刷新
+// window <= 0 时使用 BatchSQL 的 FlushInterval；ctx 结束时尽力提交剩余聚合结果
+// （若 BatchSQL 与之共用 ctx 则通常已无法提交，应在关闭 BatchSQL 前调用 Close）
+func NewAggregator(ctx context.Context, batch *BatchSQL, window time.Duration) *Aggregator {
+	if window <= 0 {
+		window = batch.config.FlushInterval
+	}
+	a := &Aggregator{
+		batch:   batch,
+		window:  window,
+		specs:   make(map[*Schema]AggregateSpec),
+		buckets: make(map[*Schema]*aggregateBucket),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go a.run(ctx)
+	return a
+}
+
+// Register 为表声明聚合方式（返回自身以支持链式）
+func (a *Aggregator) Register(schema *Schema, spec AggregateSpec) *Aggregator {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.specs[schema] = spec
+	return a
+}
+
+// Submit 提交请求：已注册的表折叠到当前窗口，其余表直接透传给 BatchSQL
+func (a *Aggregator) Submit(ctx context.Context, request *Request) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if request == nil {
+		return ErrEmptyRequest
+	}
+	schema := request.Schema()
+	if err := validateSchema(schema); err != nil {
+		return err
+	}
+
+	a.mu.Lock()
+	spec, ok := a.specs[schema]
+	if !ok || a.closed {
+		// 未注册的表，或 Close 之后的提交，直接透传
+		a.mu.Unlock()
+		return a.batch.Submit(ctx, request)
+	}
+
+	keyColumns := spec.KeyColumns
+	if len(keyColumns) == 0 {
+		keyColumns = schema.ConflictKeyColumns()
+	}
+	var sb strings.Builder
+	if !writeDedupKey(&sb, request.columns, keyColumns) {
+		a.mu.Unlock()
+		return a.batch.Submit(ctx, request)
+	}
+	defer a.mu.Unlock()
+	key := sb.String()
+
+	bucket := a.bucket(schema)
+	folded, ok := bucket.rows[key]
+	if !ok {
+		// 拷贝一份，调用方可复用原请求
+		folded = NewRequest(schema)
+		for col, v := range request.columns {
+			folded.columns[col] = v
+		}
+		folded.onComplete = request.onComplete
+		bucket.rows[key] = folded
+		bucket.keys = append(bucket.keys, key)
+		return nil
+	}
+	if err := foldRequest(spec, folded, request); err != nil {
+		return err
+	}
+	chainComplete(folded, request)
+	return nil
+}
+
+// bucket 取得（必要时创建）表在当前窗口的聚合结果，调用方需持有 a.mu
+func (a *Aggregator) bucket(schema *Schema) *aggregateBucket {
+	bucket, ok := a.buckets[schema]
+	if !ok {
+		bucket = &aggregateBucket{rows: make(map[string]*Request)}
+		a.buckets[schema] = bucket
+		a.order = append(a.order, schema)
+	}
+	return bucket
+}
+
+// foldRequest 将 incoming 按归约方式折叠进 folded
+// 先计算再写回，任一列失败时不留下部分折叠的结果
+func foldRequest(spec AggregateSpec, folded, incoming *Request) error {
+	updates := make(map[string]any, len(incoming.columns))
+	for col, v := range incoming.columns {
+		reduced, err := reduceValue(spec.Reducers[col], folded.columns[col], v)
+		if err != nil {
+			return fmt.Errorf("%w: column %s: %v", ErrInvalidColumnType, col, err)
+		}
+		updates[col] = reduced
+	}
+	for col, v := range updates {
+		folded.columns[col] = v
+	}
+	return nil
+}
+
+// chainComplete 将 src 的完成回调追加到 dst 之后
+func chainComplete(dst, src *Request) {
+	next := src.onComplete
+	if next == nil {
+		return
+	}
+	if prev := dst.onComplete; prev != nil {
+		dst.onComplete = func(err error) {
+			prev(err)
+			next(err)
+		}
+		return
+	}
+	dst.onComplete = next
+}
+
+// Flush 立即将当前窗口的聚合结果提交给 BatchSQL
+// 提交失败的行放回聚合层，与下一个窗口的同键结果合并后再次提交
+func (a *Aggregator) Flush(ctx context.Context) error {
+	a.mu.Lock()
+	buckets, order := a.buckets, a.order
+	a.buckets = make(map[*Schema]*aggregateBucket)
+	a.order = nil
+	a.mu.Unlock()
+
+	var errs []error
+	for _, schema := range order {
+		bucket := buckets[schema]
+		for i, key := range bucket.keys {
+			if err := a.batch.Submit(ctx, bucket.rows[key]); err != nil {
+				// 本表剩余的键同样无法提交，统一记一次错误
+				a.batch.metricsReporter.IncError(schema.Name, "aggregate_emit")
+				errs = append(errs, &SchemaError{Table: schema.Name, Err: fmt.Errorf("%d aggregated rows not submitted: %w", len(bucket.keys)-i, err)})
+				a.restore(schema, bucket, bucket.keys[i:])
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restore 将未提交的键放回当前窗口：旧结果在前，期间新到的同键结果折叠在其后
+func (a *Aggregator) restore(schema *Schema, old *aggregateBucket, keys []string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	spec := a.specs[schema]
+	current := a.buckets[schema]
+	restored := &aggregateBucket{rows: make(map[string]*Request, len(keys))}
+	for _, key := range keys {
+		restored.rows[key] = old.rows[key]
+		restored.keys = append(restored.keys, key)
+	}
+	if current != nil {
+		for _, key := range current.keys {
+			row := current.rows[key]
+			if folded, ok := restored.rows[key]; ok {
+				err := foldRequest(spec, folded, row)
+				if err == nil {
+					chainComplete(folded, row)
+					continue
+				}
+				// 无法与旧结果合并时保留新结果，并通知旧结果的调用方（与 Submit 的折叠失败语义一致：旧值不被部分覆盖）
+				folded.complete(err)
+				restored.rows[key] = row
+				continue
+			}
+			restored.rows[key] = row
+			restored.keys = append(restored.keys, key)
+		}
+	} else {
+		a.order = append(a.order, schema)
+	}
+	a.buckets[schema] = restored
+}
+
+// Close 停止窗口刷新并提交剩余聚合结果，之后已注册表的提交直接透传给 BatchSQL
+// 必须在结束 BatchSQL 的 ctx 之前调用；ctx 仅约束本次提交，失败的行保留，可再次调用 Close 重试
+func (a *Aggregator) Close(ctx context.Context) error {
+	a.closeOnce.Do(func() { close(a.stop) })
+	<-a.done
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	return a.Flush(ctx)
+}
+
+// run 按窗口周期刷新；ctx 结束时尽力提交剩余结果
+func (a *Aggregator) run(ctx context.Context) {
+	defer close(a.done)
+	ticker := time.NewTicker(a.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.flushAndLog(ctx)
+		case <-a.stop:
+			return
+		case <-ctx.Done():
+			a.flushAndLog(context.WithoutCancel(ctx))
+			return
+		}
+	}
+}
+
+// flushAndLog 后台刷新失败时记录日志（失败的行已放回，下个窗口重试）
+func (a *Aggregator) flushAndLog(ctx context.Context) {
+	if err := a.Flush(ctx); err != nil {
+		a.batch.logger.log(ctx, slog.LevelWarn, "batchsql: aggregate flush failed", slog.Any("error", err))
+	}
+}
+
+// reduceValue 按归约方式合并旧值与新值
+func reduceValue(reducer Reducer, current, incoming any) (any, error) {
+	switch reducer {
+	case ReduceSum:
+		return addValues(current, incoming)
+	case ReduceMax, ReduceMin:
+		if current == nil {
+			return incoming, nil
+		}
+		if incoming == nil {
+			return current, nil
+		}
+		c, err := compareValues(current, incoming)
+		if err != nil {
+			return nil, err
+		}
+		if (reducer == ReduceMax && c < 0) || (reducer == ReduceMin && c > 0) {
+			return incoming, nil
+		}
+		return current, nil
+	default:
+		return incoming, nil
+	}
+}
+
+// addValues 数值相加：同为整数时保持 int64 语义，否则按 float64 计算；结果类型与旧值一致
+func addValues(a, b any) (any, error) {
+	if a == nil {
+		return b, nil
+	}
+	if b == nil {
+		return a, nil
+	}
+	ai, aInt := toInt64(a)
+	bi, bInt := toInt64(b)
+	if aInt && bInt {
+		sum := ai + bi
+		switch a.(type) {
+		case int:
+			return int(sum), nil
+		case int32:
+			return int32(sum), nil
+		default:
+			return sum, nil
+		}
+	}
+	af, aOk := toFloat64(a)
+	bf, bOk := toFloat64(b)
+	if !aOk || !bOk {
+		return nil, fmt.Errorf("cannot sum %T and %T", a, b)
+	}
+	if _, ok := a.(float32); ok {
+		return float32(af + bf), nil
+	}
+	return af + bf, nil
+}
+
+// compareValues 比较两个值，返回 -1/0/1
+func compareValues(a, b any) (int, error) {
+	if ai, ok := toInt64(a); ok {
+		if bi, ok := toInt64(b); ok {
+			switch {
+			case ai < bi:
+				return -1, nil
+			case ai > bi:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	if af, ok := toFloat64(a); ok {
+		if bf, ok := toFloat64(b); ok {
+			switch {
+			case af < bf:
+				return -1, nil
+			case af > bf:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	switch x := a.(type) {
+	case string:
+		if y, ok := b.(string); ok {
+			return strings.Compare(x, y), nil
+		}
+	case time.Time:
+		if y, ok := b.(time.Time); ok {
+			return x.Compare(y), nil
+		}
+	}
+	return 0, fmt.Errorf("cannot compare %T and %T", a, b)
+}
+
+func toInt64(v any) (int64, bool) {
+	switch x := v.(type) {
+	case int:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	}
+	return 0, false
+}
+
+func toFloat64(v any) (float64, bool) {
+	switch x := v.(type) {
+	case float32:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
@@ -0,0 +1,222 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestAggregator_FoldsCountersPerKey(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	schema := batchsql.NewSchema("page_views", batchsql.ConflictUpdate, "page", "views", "max_ms", "min_ms", "last_ua")
+	agg := batchsql.NewAggregator(ctx, b, time.Hour).Register(schema, batchsql.AggregateSpec{
+		Reducers: map[string]batchsql.Reducer{
+			"views":  batchsql.ReduceSum,
+			"max_ms": batchsql.ReduceMax,
+			"min_ms": batchsql.ReduceMin,
+		},
+	})
+
+	submit := func(page string, ms float64, ua string) {
+		req := batchsql.NewRequest(schema).
+			SetString("page", page).
+			SetInt64("views", 1).
+			SetFloat64("max_ms", ms).
+			SetFloat64("min_ms", ms).
+			SetString("last_ua", ua)
+		if err := agg.Submit(ctx, req); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	submit("/a", 10, "ua1")
+	submit("/b", 5, "ua1")
+	submit("/a", 30, "ua2")
+	submit("/a", 20, "ua3")
+
+	if err := agg.Flush(ctx); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(mock.SnapshotExecutedBatches()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	batches := mock.SnapshotExecutedBatches()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("expected one batch with 2 folded rows, got %#v", batches)
+	}
+	a := batches[0][0]
+	if a["page"] != "/a" || a["views"] != int64(3) || a["max_ms"] != float64(30) || a["min_ms"] != float64(10) || a["last_ua"] != "ua3" {
+		t.Fatalf("unexpected folded row: %#v", a)
+	}
+	if batches[0][1]["views"] != int64(1) {
+		t.Fatalf("unexpected folded row: %#v", batches[0][1])
+	}
+}
+
+func TestAggregator_PassThroughAndTypeErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     1,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	counters := batchsql.NewSchema("counters", batchsql.ConflictUpdate, "id", "n")
+	plain := batchsql.NewSchema("plain", batchsql.ConflictIgnore, "id")
+	agg := batchsql.NewAggregator(ctx, b, time.Hour).Register(counters, batchsql.AggregateSpec{
+		Reducers: map[string]batchsql.Reducer{"n": batchsql.ReduceSum},
+	})
+
+	if err := agg.Submit(ctx, batchsql.NewRequest(counters).SetInt64("id", 1).SetString("n", "x")); err != nil {
+		t.Fatalf("first submit should not fold: %v", err)
+	}
+	err := agg.Submit(ctx, batchsql.NewRequest(counters).SetInt64("id", 1).SetString("n", "y"))
+	if !errors.Is(err, batchsql.ErrInvalidColumnType) {
+		t.Fatalf("expected ErrInvalidColumnType for non-numeric sum, got %v", err)
+	}
+
+	// 未注册的表直接透传
+	if err := agg.Submit(ctx, batchsql.NewRequest(plain).SetInt64("id", 1)); err != nil {
+		t.Fatalf("pass-through submit: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(mock.SnapshotExecutedBatches()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(mock.SnapshotExecutedBatches()) != 1 {
+		t.Fatalf("expected pass-through request to be executed")
+	}
+}
+
+func TestAggregator_FailedFlushMergesIntoNextWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	schema := batchsql.NewSchema("counters", batchsql.ConflictUpdate, "id", "n")
+	agg := batchsql.NewAggregator(ctx, b, time.Hour).Register(schema, batchsql.AggregateSpec{
+		Reducers: map[string]batchsql.Reducer{"n": batchsql.ReduceSum},
+	})
+	submit := func(id, n int64) {
+		if err := agg.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", id).SetInt64("n", n)); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	submit(1, 1)
+	submit(1, 2)
+
+	// 已取消的 ctx 使提交失败：聚合结果放回，不得丢失
+	canceled, cancelFlush := context.WithCancel(ctx)
+	cancelFlush()
+	if err := agg.Flush(canceled); err == nil {
+		t.Fatalf("expected flush with canceled ctx to fail")
+	}
+
+	submit(1, 4)
+	submit(2, 1)
+	if err := agg.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(mock.SnapshotExecutedBatches()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	batches := mock.SnapshotExecutedBatches()
+	if len(batches) != 1 || len(batches[0]) != 2 {
+		t.Fatalf("expected one batch with 2 rows, got %#v", batches)
+	}
+	if batches[0][0]["id"] != int64(1) || batches[0][0]["n"] != int64(7) || batches[0][1]["n"] != int64(1) {
+		t.Fatalf("failed window must merge into the next one: %#v", batches[0])
+	}
+
+	// Close 之后已注册表直接透传
+	submit(3, 1)
+	deadline = time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(mock.SnapshotExecutedBatches()) < 2 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(mock.SnapshotExecutedBatches()) != 2 {
+		t.Fatalf("submits after Close must pass through to BatchSQL")
+	}
+}
+
+func TestAggregator_KeysCallbacksAndValidation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	b, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+	})
+	schema := batchsql.NewSchema("counters", batchsql.ConflictUpdate, "tenant", "id", "n").WithConflictColumns("tenant", "id")
+	agg := batchsql.NewAggregator(ctx, b, time.Hour).Register(schema, batchsql.AggregateSpec{
+		Reducers: map[string]batchsql.Reducer{"n": batchsql.ReduceSum},
+	})
+
+	var completed atomic.Int32
+	submit := func(req *batchsql.Request) {
+		t.Helper()
+		req.OnComplete(func(err error) {
+			if err == nil {
+				completed.Add(1)
+			}
+		})
+		if err := agg.Submit(ctx, req); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	// 同键折叠：三个请求的回调都应收到通知
+	for i := 0; i < 3; i++ {
+		submit(batchsql.NewRequest(schema).SetString("tenant", "t").SetInt64("id", 1).SetInt64("n", 1))
+	}
+	// 值中含分隔符的不同键不得折叠
+	submit(batchsql.NewRequest(schema).SetString("tenant", "a\x1fs:b").SetString("id", "c").SetInt64("n", 1))
+	submit(batchsql.NewRequest(schema).SetString("tenant", "a").SetString("id", "b\x1fs:c").SetInt64("n", 1))
+	// NULL 键互不相等：直接透传，不折叠
+	submit(batchsql.NewRequest(schema).SetString("tenant", "t").SetNull("id").SetInt64("n", 1))
+	submit(batchsql.NewRequest(schema).SetString("tenant", "t").SetNull("id").SetInt64("n", 1))
+
+	if err := agg.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && completed.Load() < 7 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := completed.Load(); n != 7 {
+		t.Fatalf("expected every folded and passed-through request to be completed, got %d of 7", n)
+	}
+	rows := 0
+	for _, batch := range mock.SnapshotExecutedBatches() {
+		rows += len(batch)
+	}
+	if rows != 5 {
+		t.Fatalf("expected 1 folded row, 2 separator rows and 2 NULL-key rows, got %d rows", rows)
+	}
+
+	// 无效 schema 在 Submit 时即返回错误
+	invalid := &batchsql.Schema{Columns: []string{"id"}}
+	agg2 := batchsql.NewAggregator(ctx, b, time.Hour).Register(invalid, batchsql.AggregateSpec{})
+	if err := agg2.Submit(ctx, batchsql.NewRequest(invalid).SetInt64("id", 1)); !errors.Is(err, batchsql.ErrEmptySchemaName) {
+		t.Fatalf("expected ErrEmptySchemaName, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package batchsql
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AutoTuneConfig FlushSize 在线自动调优配置（零值=关闭）
+/*
+策略（爬山法）：
+- 观测与 MetricsReporter.ObserveExecuteDuration 相同：每个执行批次的行数与执行耗时
+- 每个评估窗口（至少 Window 时长且至少 MinSamples 个批次）计算吞吐（成功行数 / 窗口墙钟时长）与耗时 p99；
+  并发刷新时执行耗时相互重叠，按墙钟计算才是实际写入速率
+- p99 超过 TargetP99：按 StepRatio 减小 FlushSize，并以违规时的大小为上限，之后不再向上探索到该值
+- 否则与上一窗口比较吞吐：提升超过 Tolerance 时沿原方向继续，下降超过 Tolerance 时反向，持平时保持方向
+- 稳定模式：连续 StableAfter 个窗口未见明显提升（持平或反向）后停止调整并记录基线吞吐；
+  之后吞吐低于基线超过 2×Tolerance 或 p99 超标时退出稳定模式重新探索
+- 窗口内最大批次不足当前 FlushSize 一半时（按刷新间隔出批，流量未饱和）不调整
+- FlushSize 始终处于 [MinFlushSize, MaxFlushSize]，通过 Reconfigure 生效，
+  变化时通过 AutoTuneMetricsReporter.SetFlushSize 上报；按 schema 隔离模式下作用于全局值，
+  SchemaPipelines 中显式覆盖了 FlushSize 的表不参与观测（其批次大小不受调优影响）
+*/
+type AutoTuneConfig struct {
+	Enabled      bool
+	MinFlushSize uint32        // 下限（默认 FlushSize/4，至少 1）
+	MaxFlushSize uint32        // 上限（默认 FlushSize×4）
+	TargetP99    time.Duration // 批次执行耗时 p99 上限（0 表示不限制）
+	Window       time.Duration // 评估窗口最短时长（默认 5s）
+	MinSamples   int           // 评估窗口最少批次数（默认 10）
+	// StepRatio 单步调整比例，取值 (0,1]（默认 0.25，至少 1 行）
+	StepRatio float64
+	// Tolerance 吞吐变化小于该比例视为持平（默认 0.05）
+	Tolerance float64
+	// StableAfter 连续未提升窗口数达到后进入稳定模式（默认 3；< 0 表示不进入稳定模式）
+	StableAfter int
+}
+
+// AutoTuneStatus 自动调优状态快照
+type AutoTuneStatus struct {
+	Enabled    bool
+	FlushSize  uint32        // 当前 FlushSize
+	RowsPerSec float64       // 最近一个窗口的吞吐
+	P99        time.Duration // 最近一个窗口的执行耗时 p99
+	Stable     bool          // 是否处于稳定模式
+	Windows    int           // 已评估的窗口数
+}
+
+// flushTuner FlushSize 爬山调优器
+type flushTuner struct {
+	cfg AutoTuneConfig
+
+	mu          sync.Mutex
+	windowStart time.Time
+	samples     []time.Duration
+	rows        int64 // 成功行数
+	maxRows     int
+
+	prevRate  float64 // 上一窗口吞吐（比较基准，0 表示需重新建立）
+	direction int     // +1 增大 / -1 减小
+	flat      int     // 连续未提升的窗口数
+	ceiling   uint32  // p99 违规后的探索上限（0 表示无）
+	stable    bool
+	baseline  float64 // 进入稳定模式时的吞吐
+
+	// 最近一个窗口的观测结果（AutoTuneStatus）
+	windows  int
+	lastRate float64
+	lastP99  time.Duration
+}
+
+func newFlushTuner(cfg AutoTuneConfig, flushSize uint32) *flushTuner {
+	if cfg.MinFlushSize == 0 {
+		cfg.MinFlushSize = max(flushSize/4, 1)
+	}
+	if cfg.MaxFlushSize == 0 {
+		cfg.MaxFlushSize = max(flushSize*4, cfg.MinFlushSize)
+	}
+	if cfg.MaxFlushSize < cfg.MinFlushSize {
+		cfg.MaxFlushSize = cfg.MinFlushSize
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 5 * time.Second
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 10
+	}
+	if cfg.StepRatio <= 0 || cfg.StepRatio > 1 {
+		cfg.StepRatio = 0.25
+	}
+	if cfg.Tolerance <= 0 {
+		cfg.Tolerance = 0.05
+	}
+	if cfg.StableAfter == 0 {
+		cfg.StableAfter = 3
+	}
+	return &flushTuner{cfg: cfg, direction: 1, windowStart: time.Now()}
+}
+
+// observe 记录一个执行批次；窗口结束时返回建议的 FlushSize（0 表示保持不变）
+func (t *flushTuner) observe(rows int, d time.Duration, ok bool, current uint32) uint32 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.samples = append(t.samples, d)
+	t.maxRows = max(t.maxRows, rows)
+	if ok {
+		t.rows += int64(rows)
+	}
+	elapsed := time.Since(t.windowStart)
+	if len(t.samples) < t.cfg.MinSamples || elapsed < t.cfg.Window {
+		return 0
+	}
+
+	rate := float64(t.rows) / elapsed.Seconds()
+	slices.Sort(t.samples)
+	p99 := t.samples[(len(t.samples)*99-1)/100]
+	saturated := t.maxRows*2 >= int(current)
+	t.windowStart, t.samples, t.rows, t.maxRows = time.Now(), t.samples[:0], 0, 0
+	t.windows++
+	t.lastP99, t.lastRate = p99, rate
+
+	if t.cfg.TargetP99 > 0 && p99 > t.cfg.TargetP99 {
+		// 延迟优先：减小并封顶，重新建立吞吐基准
+		t.ceiling = max(current-1, t.cfg.MinFlushSize)
+		t.stable, t.flat, t.prevRate, t.direction = false, 0, 0, -1
+		return t.step(current, -1)
+	}
+	if !saturated {
+		return 0
+	}
+	if t.stable {
+		if rate >= t.baseline*(1-2*t.cfg.Tolerance) {
+			return 0
+		}
+		t.stable, t.flat, t.ceiling, t.prevRate = false, 0, 0, rate
+		return t.step(current, t.direction)
+	}
+	if t.prevRate == 0 {
+		t.prevRate = rate
+		return t.step(current, t.direction)
+	}
+	change := (rate - t.prevRate) / t.prevRate
+	t.prevRate = rate
+	switch {
+	case change > t.cfg.Tolerance:
+		t.flat = 0
+	case change < -t.cfg.Tolerance:
+		t.direction = -t.direction
+		t.flat++
+	default:
+		t.flat++
+	}
+	if t.cfg.StableAfter > 0 && t.flat >= t.cfg.StableAfter {
+		t.stable, t.baseline = true, rate
+		return 0
+	}
+	return t.step(current, t.direction)
+}
+
+// step 按方向调整一步并限制在边界内（已在边界时保持不变，由后续窗口累计进入稳定模式）
+func (t *flushTuner) step(current uint32, direction int) uint32 {
+	upper := t.cfg.MaxFlushSize
+	if t.ceiling > 0 {
+		upper = min(upper, t.ceiling)
+	}
+	delta := max(uint32(float64(current)*t.cfg.StepRatio), 1)
+	if direction > 0 {
+		return max(min(current+delta, upper), t.cfg.MinFlushSize)
+	}
+	if current <= delta {
+		return t.cfg.MinFlushSize
+	}
+	return max(current-delta, t.cfg.MinFlushSize)
+}
+
+// status 调优器状态快照
+func (t *flushTuner) status() AutoTuneStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return AutoTuneStatus{Enabled: true, RowsPerSec: t.lastRate, P99: t.lastP99, Stable: t.stable, Windows: t.windows}
+}
+
+// observeTune 将批次执行结果交给调优器，窗口结束时按建议调整 FlushSize
+// 独立管道显式覆盖了 FlushSize 的表不受全局值影响，其批次不参与观测
+func (b *BatchSQL) observeTune(ctx context.Context, schema *Schema, rows int, d time.Duration, err error) {
+	if b.tuner == nil {
+		return
+	}
+	if b.config.PerSchemaPipeline && b.config.SchemaPipelines[schema.Name].FlushSize > 0 {
+		return
+	}
+	current := b.settings.Load().size
+	next := b.tuner.observe(rows, d, err == nil, current)
+	if next == 0 || next == current {
+		return
+	}
+	if err := b.Reconfigure(RuntimeConfig{FlushSize: next}); err != nil {
+		return
+	}
+	if ar, ok := b.metricsReporter.(AutoTuneMetricsReporter); ok {
+		ar.SetFlushSize(int(next))
+	}
+	st := b.tuner.status()
+	b.logger.log(ctx, slog.LevelDebug, "batchsql: flush size tuned",
+		slog.Uint64("from", uint64(current)), slog.Uint64("to", uint64(next)),
+		slog.Float64("rows_per_sec", st.RowsPerSec), slog.Duration("p99", st.P99))
+}
+
+// AutoTuneStatus 返回 FlushSize 自动调优状态（未启用时 Enabled 为 false）
+func (b *BatchSQL) AutoTuneStatus() AutoTuneStatus {
+	var st AutoTuneStatus
+	if b.tuner != nil {
+		st = b.tuner.status()
+	}
+	st.FlushSize = b.settings.Load().size
+	return st
+}
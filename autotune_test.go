@@ -0,0 +1,191 @@
+package batchsql_test
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// costExecutor 执行耗时 = 固定开销 + 每行耗时，并记录最大批次
+// serial 为 true 时批次串行执行（模拟数据库成为瓶颈）
+type costExecutor struct {
+	overhead, perRow time.Duration
+	serial           bool
+	mu               sync.Mutex
+	maxRows          atomic.Int64
+	executed         atomic.Int64 // 已执行行数（生产者据此限制积压）
+}
+
+func (e *costExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	for n := int64(len(data)); ; {
+		cur := e.maxRows.Load()
+		if n <= cur || e.maxRows.CompareAndSwap(cur, n) {
+			break
+		}
+	}
+	if e.serial {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+	}
+	time.Sleep(e.overhead + time.Duration(len(data))*e.perRow)
+	e.executed.Add(int64(len(data)))
+	return nil
+}
+
+// runAutoTune 持续提交直到 done 返回 true 或超时
+// 刷新是异步的，生产者将未执行行数限制在两个批次以内，避免观测到的批次滞后于当前 FlushSize
+func runAutoTune(t *testing.T, exec *costExecutor, cfg batchsql.PipelineConfig, done func(batchsql.AutoTuneStatus) bool) batchsql.AutoTuneStatus {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQLWithConfig(ctx, cfg, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := int64(0); ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			for i-exec.executed.Load() >= 2*int64(batch.AutoTuneStatus().FlushSize) {
+				select {
+				case <-stop:
+					return
+				case <-time.After(100 * time.Microsecond):
+				}
+			}
+			if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", i)); err != nil {
+				return
+			}
+			// 让出调度，避免单核环境下生产者挤占执行器的计时
+			runtime.Gosched()
+		}
+	}()
+	defer func() {
+		close(stop)
+		cancel()
+		wg.Wait()
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if st := batch.AutoTuneStatus(); done(st) {
+			return st
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	st := batch.AutoTuneStatus()
+	t.Fatalf("auto-tune did not converge: %+v", st)
+	return st
+}
+
+func TestAutoTune_ClimbsToUpperBoundAndStabilizes(t *testing.T) {
+	exec := &costExecutor{overhead: 2 * time.Millisecond, perRow: 10 * time.Microsecond, serial: true}
+	st := runAutoTune(t, exec, batchsql.PipelineConfig{
+		BufferSize:    1000,
+		FlushSize:     10,
+		FlushInterval: 5 * time.Millisecond,
+		AutoTune: batchsql.AutoTuneConfig{
+			Enabled:      true,
+			MaxFlushSize: 80,
+			Window:       20 * time.Millisecond,
+			MinSamples:   5,
+			Tolerance:    0.1,
+		},
+	}, func(st batchsql.AutoTuneStatus) bool { return st.Stable && st.FlushSize >= 60 })
+	if st.FlushSize > 80 || exec.maxRows.Load() > 80 {
+		t.Fatalf("flush size exceeded upper bound: status=%+v max batch=%d", st, exec.maxRows.Load())
+	}
+}
+
+func TestAutoTune_ShrinksToMeetP99Target(t *testing.T) {
+	exec := &costExecutor{perRow: 100 * time.Microsecond}
+	runAutoTune(t, exec, batchsql.PipelineConfig{
+		BufferSize:    1000,
+		FlushSize:     80,
+		FlushInterval: 5 * time.Millisecond,
+		AutoTune: batchsql.AutoTuneConfig{
+			Enabled:      true,
+			MinFlushSize: 5,
+			TargetP99:    3 * time.Millisecond,
+			Window:       20 * time.Millisecond,
+			MinSamples:   5,
+		},
+	}, func(st batchsql.AutoTuneStatus) bool { return st.FlushSize <= 30 && st.Windows > 0 })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, _ := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 10, FlushInterval: time.Hour})
+	if st := batch.AutoTuneStatus(); st.Enabled || st.FlushSize != 10 {
+		t.Fatalf("unexpected status without auto-tune: %+v", st)
+	}
+}
+
+func TestAutoTune_WallClockThroughputAndSchemaOverrides(t *testing.T) {
+	t.Run("throughput is bounded by wall-clock ingest rate", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// 每批执行 20ms，约 50 行一批：按执行耗时之和计算约 2500 行/秒，
+		// 而生产者每毫秒至多提交一行，实际写入速率不可能超过 1000 行/秒
+		exec := &costExecutor{overhead: 20 * time.Millisecond}
+		batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+			BufferSize:    1000,
+			FlushSize:     100,
+			FlushInterval: 50 * time.Millisecond,
+			AutoTune:      batchsql.AutoTuneConfig{Enabled: true, Window: 200 * time.Millisecond, MinSamples: 3},
+		}, exec)
+		schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+		deadline := time.Now().Add(10 * time.Second)
+		for i := int64(0); batch.AutoTuneStatus().Windows < 2; i++ {
+			if time.Now().After(deadline) {
+				t.Fatalf("no window evaluated: %+v", batch.AutoTuneStatus())
+			}
+			if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", i)); err != nil {
+				t.Fatal(err)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if st := batch.AutoTuneStatus(); st.RowsPerSec <= 0 || st.RowsPerSec > 1000 {
+			t.Fatalf("throughput %.0f rows/s exceeds the ingest rate", st.RowsPerSec)
+		}
+	})
+
+	t.Run("schemas with a FlushSize override are not observed", func(t *testing.T) {
+		exec := &costExecutor{overhead: time.Millisecond}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+			BufferSize:        1000,
+			FlushSize:         10,
+			FlushInterval:     5 * time.Millisecond,
+			PerSchemaPipeline: true,
+			SchemaPipelines:   map[string]batchsql.SchemaPipelineConfig{"events": {FlushSize: 10}},
+			AutoTune:          batchsql.AutoTuneConfig{Enabled: true, MaxFlushSize: 80, Window: 10 * time.Millisecond, MinSamples: 2},
+		}, exec)
+		schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+		for i := int64(0); i < 500; i++ {
+			if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", i)); err != nil {
+				t.Fatal(err)
+			}
+			runtime.Gosched()
+		}
+		time.Sleep(50 * time.Millisecond)
+		if st := batch.AutoTuneStatus(); st.Windows != 0 || st.FlushSize != 10 {
+			t.Fatalf("overridden schema was tuned: %+v", st)
+		}
+		if n := exec.maxRows.Load(); n == 0 || n > 10 {
+			t.Fatalf("max batch = %d, want 1..10", n)
+		}
+	})
+}
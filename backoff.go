@@ -0,0 +1,178 @@
+package batchsql
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// BackoffStrategy 重试退避策略
+// attempt 为已失败的尝试次数（从 1 开始），prev 为上一次的等待时长（首次为 0）
+// 实现需并发安全：同一执行器的多个批次会同时调用
+type BackoffStrategy interface {
+	Backoff(attempt int, prev time.Duration) time.Duration
+}
+
+const (
+	defaultBackoffBase = 20 * time.Millisecond
+	defaultMaxBackoff  = 2 * time.Second
+)
+
+// backoffBounds 补齐基值与上限的默认值
+func backoffBounds(base, maxBackoff time.Duration) (time.Duration, time.Duration) {
+	if base <= 0 {
+		base = defaultBackoffBase
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	if maxBackoff < base {
+		maxBackoff = base
+	}
+	return base, maxBackoff
+}
+
+// exponential 返回 base*2^(attempt-1)，不超过 maxBackoff
+func exponential(base, maxBackoff time.Duration, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt; i++ {
+		d *= 2
+		if d >= maxBackoff || d <= 0 {
+			return maxBackoff
+		}
+	}
+	return min(d, maxBackoff)
+}
+
+// randDuration 返回 [lo, hi] 内的随机时长
+func randDuration(lo, hi time.Duration) time.Duration {
+	if hi <= lo {
+		return lo
+	}
+	return lo + time.Duration(rand.Int64N(int64(hi-lo)+1))
+}
+
+// ExponentialBackoff 指数退避 + 比例抖动（未指定策略时的默认行为，Jitter=0.2 即 ±20%）
+type ExponentialBackoff struct {
+	Base   time.Duration // 退避基值（默认 20ms）
+	Max    time.Duration // 退避上限（默认 2s）
+	Jitter float64       // 抖动比例 [0,1]，0 表示不抖动
+}
+
+func (b ExponentialBackoff) Backoff(attempt int, _ time.Duration) time.Duration {
+	base, maxBackoff := backoffBounds(b.Base, b.Max)
+	d := exponential(base, maxBackoff, attempt)
+	jitter := time.Duration(float64(d) * min(max(b.Jitter, 0), 1))
+	return randDuration(d-jitter, d+jitter)
+}
+
+// FullJitterBackoff 全抖动：在 [0, min(Max, Base*2^(attempt-1))] 内均匀取值
+// 并发批次同时失败时能最大程度错开重试时间
+type FullJitterBackoff struct {
+	Base time.Duration // 退避基值（默认 20ms）
+	Max  time.Duration // 退避上限（默认 2s）
+}
+
+func (b FullJitterBackoff) Backoff(attempt int, _ time.Duration) time.Duration {
+	base, maxBackoff := backoffBounds(b.Base, b.Max)
+	return randDuration(0, exponential(base, maxBackoff, attempt))
+}
+
+// DecorrelatedJitterBackoff 去相关抖动：在 [Base, prev*3] 内取值，不超过 Max
+type DecorrelatedJitterBackoff struct {
+	Base time.Duration // 退避基值（默认 20ms）
+	Max  time.Duration // 退避上限（默认 2s）
+}
+
+func (b DecorrelatedJitterBackoff) Backoff(_ int, prev time.Duration) time.Duration {
+	base, maxBackoff := backoffBounds(b.Base, b.Max)
+	hi := max(prev*3, base)
+	return min(randDuration(base, hi), maxBackoff)
+}
+
+// ConstantBackoff 固定间隔
+type ConstantBackoff struct {
+	Delay time.Duration
+}
+
+func (b ConstantBackoff) Backoff(int, time.Duration) time.Duration { return b.Delay }
+
+// RetryBudget 重试预算（零值关闭）
+// 滑动窗口内重试次数上限 = 批次数 × Ratio + MinRetries，超出后失败批次不再重试，避免下游故障时重试放大流量
+type RetryBudget struct {
+	Ratio      float64       // 重试/批次比例上限（如 0.1 表示最多 10% 的额外尝试）
+	MinRetries int           // 每个窗口保底可用的重试次数（低流量时仍可重试）
+	Window     time.Duration // 统计窗口（默认 10s）
+}
+
+// retryBudget 以当前窗口 + 上一窗口按时间加权近似滑动窗口
+type retryBudget struct {
+	cfg RetryBudget
+
+	mu          sync.Mutex
+	windowStart time.Time
+	requests    float64
+	retries     float64
+	prevReqs    float64
+	prevRetries float64
+}
+
+func newRetryBudget(cfg RetryBudget) *retryBudget {
+	if cfg.Ratio <= 0 {
+		return nil
+	}
+	if cfg.MinRetries < 0 {
+		cfg.MinRetries = 0
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 10 * time.Second
+	}
+	return &retryBudget{cfg: cfg, windowStart: time.Now()}
+}
+
+// rotateLocked 推进窗口
+func (b *retryBudget) rotateLocked(now time.Time) {
+	elapsed := now.Sub(b.windowStart)
+	if elapsed < b.cfg.Window {
+		return
+	}
+	if elapsed < 2*b.cfg.Window {
+		b.prevReqs, b.prevRetries = b.requests, b.retries
+		b.windowStart = b.windowStart.Add(b.cfg.Window)
+	} else {
+		b.prevReqs, b.prevRetries = 0, 0
+		b.windowStart = now
+	}
+	b.requests, b.retries = 0, 0
+}
+
+// onRequest 记录一个批次
+func (b *retryBudget) onRequest() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	b.rotateLocked(time.Now())
+	b.requests++
+	b.mu.Unlock()
+}
+
+// tryRetry 尝试消耗一次重试配额
+func (b *retryBudget) tryRetry() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.rotateLocked(now)
+	// 上一窗口按剩余重叠比例计入
+	weight := 1 - float64(now.Sub(b.windowStart))/float64(b.cfg.Window)
+	requests := b.requests + b.prevReqs*weight
+	retries := b.retries + b.prevRetries*weight
+	if retries+1 > requests*b.cfg.Ratio+float64(b.cfg.MinRetries) {
+		return false
+	}
+	b.retries++
+	return true
+}
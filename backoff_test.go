@@ -0,0 +1,109 @@
+package batchsql_test
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestBackoffStrategies_Bounds(t *testing.T) {
+	base, maxBackoff := 10*time.Millisecond, 80*time.Millisecond
+
+	exp := batchsql.ExponentialBackoff{Base: base, Max: maxBackoff}
+	for attempt, want := range map[int]time.Duration{1: 10 * time.Millisecond, 2: 20 * time.Millisecond, 3: 40 * time.Millisecond, 10: maxBackoff} {
+		if got := exp.Backoff(attempt, 0); got != want {
+			t.Fatalf("exponential attempt %d: got %v want %v", attempt, got, want)
+		}
+	}
+
+	jittered := batchsql.ExponentialBackoff{Base: base, Max: maxBackoff, Jitter: 0.2}
+	full := batchsql.FullJitterBackoff{Base: base, Max: maxBackoff}
+	decorrelated := batchsql.DecorrelatedJitterBackoff{Base: base, Max: maxBackoff}
+	var prev time.Duration
+	distinct := make(map[time.Duration]struct{})
+	for i := 0; i < 200; i++ {
+		if d := jittered.Backoff(2, 0); d < 16*time.Millisecond || d > 24*time.Millisecond {
+			t.Fatalf("exponential jitter out of ±20%%: %v", d)
+		}
+		d := full.Backoff(3, 0)
+		if d < 0 || d > 40*time.Millisecond {
+			t.Fatalf("full jitter out of [0, 40ms]: %v", d)
+		}
+		distinct[d] = struct{}{}
+		prev = decorrelated.Backoff(i+1, prev)
+		if prev < base || prev > maxBackoff {
+			t.Fatalf("decorrelated jitter out of [base, max]: %v", prev)
+		}
+	}
+	if len(distinct) < 10 {
+		t.Fatalf("full jitter should spread sleeps, got %d distinct values", len(distinct))
+	}
+
+	if d := (batchsql.ConstantBackoff{Delay: 5 * time.Millisecond}).Backoff(7, time.Second); d != 5*time.Millisecond {
+		t.Fatalf("constant backoff: %v", d)
+	}
+}
+
+type countingBackoff struct{ calls atomic.Int32 }
+
+func (b *countingBackoff) Backoff(int, time.Duration) time.Duration {
+	b.calls.Add(1)
+	return 0
+}
+
+func TestRetryConfig_CustomBackoffStrategy(t *testing.T) {
+	p := &fakeProcessor{failCount: 2, failReason: "deadlock"}
+	backoff := &countingBackoff{}
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, Backoff: backoff})
+
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}}); err != nil {
+		t.Fatalf("expected success after retries: %v", err)
+	}
+	if got := backoff.calls.Load(); got != 2 {
+		t.Fatalf("backoff strategy should be used for each retry, calls=%d", got)
+	}
+}
+
+func TestRetryBudget_LimitsRetries(t *testing.T) {
+	p := &switchProcessor{}
+	p.failing.Store(true)
+	m := &retryBudgetMetrics{}
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithMetricsReporter(m).
+		WithRetryConfig(batchsql.RetryConfig{
+			Enabled:     true,
+			MaxAttempts: 3,
+			Backoff:     batchsql.ConstantBackoff{},
+			Budget:      batchsql.RetryBudget{Ratio: 0.1, MinRetries: 2, Window: time.Minute},
+		})
+
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 10; i++ {
+		if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": i}}); err == nil {
+			t.Fatalf("expected failure")
+		}
+	}
+	// 10 个批次：预算 = 10*0.1 + 2 = 3 次重试（无预算时为 20 次）
+	if got := p.calls.Load(); got != 13 {
+		t.Fatalf("expected 10 attempts + 3 budgeted retries, got %d", got)
+	}
+	if got := m.exhausted.Load(); got == 0 {
+		t.Fatalf("expected retry_budget_exhausted to be reported")
+	}
+}
+
+type retryBudgetMetrics struct {
+	batchsql.NoopMetricsReporter
+	exhausted atomic.Int32
+}
+
+func (m *retryBudgetMetrics) IncError(table, typ string) {
+	if typ == "retry_budget_exhausted" {
+		m.exhausted.Add(1)
+	}
+}
@@ -3,6 +3,10 @@ package batchsql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -23,24 +27,65 @@ import (
 - 测试环境：MockExecutor（直接实现 BatchExecutor）
 可选能力：
 - WithConcurrencyLimit：通过信号量限制 ExecuteBatch 并发，避免攒批后同时冲击数据库（limit <= 0 等价于不限流）
+- PipelineConfig.PerSchemaPipeline：按 schema 懒创建独立管道，Submit 按表路由，共享 ErrorChan 与指标
+- PipelineConfig.Ordering：同一表（或分区键）的批次按提交顺序执行
+- PipelineConfig.Dedup：批内按冲突键折叠重复行（keep-last / keep-first / merge）
+- PipelineConfig.Overflow / TrySubmit：缓冲区满时阻塞、丢弃最新/最旧、落盘或采样
+- SubmitMany：批量提交，整批绕过缓冲区异步执行，返回逐条受理错误
+- PipelineConfig.Memory：按估算字节数触发刷新与切分批次，并限制已缓冲字节数（阻塞或丢弃）
+- Reconfigure：运行时调整刷新大小/间隔、执行器并发上限与重试策略
+- PipelineConfig.AutoTune：按批次吞吐与执行耗时 p99 在线调整 FlushSize（爬山法，带边界与稳定模式）
+- PipelineConfig.Idempotency：批次 id 与数据在同一事务写入去重表，重试或落盘重放已提交的批次时跳过
+- Request.OnComplete / OutboxRelay：逐请求完成回调；从 outbox 表拉取（SKIP LOCKED）写入目标后再删除源行
+- Health / LivenessHandler / ReadinessHandler：连通性、熔断、队列占用、最近成功刷新与错误率
+- OpenWAL：Submit 前写预写日志，批次成功后 checkpoint，启动时重放未确认请求（at-least-once）
 */
 type BatchSQL struct {
-	pipeline        *gopipeline.StandardPipeline[*Request] // 异步批量处理管道
-	executor        BatchExecutor                          // 批量执行器（数据库特定）
-	metricsReporter MetricsReporter                        // 指标上报器（默认 Noop）
-	closed          atomic.Bool                            // 当创建时上下文被取消后置为 true，拒绝后续提交
+	ctx             context.Context // 创建时的生命周期上下文
+	config          PipelineConfig  // 管道配置
+	pipeline        *pipelineHandle // 异步批量处理管道（共享模式）
+	executor        BatchExecutor   // 批量执行器（数据库特定）
+	metricsReporter MetricsReporter // 指标上报器（默认 Noop）
+	closed          atomic.Bool     // 当创建时上下文被取消后置为 true，拒绝后续提交
+	logger          eventLogger     // 可选结构化日志（默认继承执行器的日志器）
+	stats           statsCollector  // 内置统计计数器（Stats 快照）
+	wal             *writeAheadLog  // 可选预写日志（OpenWAL 开启）
+	memory          memoryBudget    // 已缓冲请求的估算字节数（MemoryConfig.MaxBufferedBytes）
+	tuner           *flushTuner     // 可选 FlushSize 自动调优（PipelineConfig.AutoTune）
+	health          healthTracker   // 健康检查：最近成功刷新与错误率窗口
+
+	// 当前攒批参数（Reconfigure 可调整）
+	settings atomic.Pointer[flushSettings]
+
+	// 按 schema 隔离模式：表名 -> 独立管道 *pipelineHandle（懒创建）
+	schemaPipelinesMu sync.Mutex
+	schemaPipelines   sync.Map
+	// 隔离模式下汇总各独立管道错误的统一错误通道（首次调用决定缓冲大小）
+	errOnce sync.Once
+	errChan chan error
 }
 
 // NewBatchSQL 创建 BatchSQL 实例
 // 这是最底层的构造函数，接受任何实现了BatchExecutor接口的执行器
 // 通常不直接使用，而是通过具体数据库的工厂方法创建
 func NewBatchSQL(ctx context.Context, buffSize uint32, flushSize uint32, flushInterval time.Duration, executor BatchExecutor) *BatchSQL {
+	return NewBatchSQLWithConfig(ctx, PipelineConfig{
+		BufferSize:    buffSize,
+		FlushSize:     flushSize,
+		FlushInterval: flushInterval,
+	}, executor)
+}
+
+// NewBatchSQLWithConfig 使用完整 PipelineConfig 创建 BatchSQL 实例
+// 与 NewBatchSQL 相同，但可启用 PipelineConfig 中的可选能力（如按 schema 隔离管道）
+// 注意：Retry/Idempotency 配置作用于执行器/处理器，需由调用方自行设置（SQL 工厂方法已处理）
+func NewBatchSQLWithConfig(ctx context.Context, config PipelineConfig, executor BatchExecutor) *BatchSQL {
 	// 确保 BatchSQL 始终拥有可用 reporter，但不误覆盖自定义执行器的已有配置
 	var reporter MetricsReporter
 	// 说明：
 	// - 由于 Go 对泛型接口的类型断言需要具体类型实参，无法在此处（仅持有 BatchExecutor）统一断言 MetricsCapable[T]。
 	// - 因此采用非泛型的只读探测接口 MetricsProvider 进行安全探测；若为 nil，则在本地使用 Noop 兜底，不强制写回。
-	if mp, ok := executor.(interface{ MetricsReporter() MetricsReporter }); ok {
+	if mp, ok := executorAs[interface{ MetricsReporter() MetricsReporter }](executor); ok {
 		if r := mp.MetricsReporter(); r != nil {
 			reporter = r
 		} else {
@@ -52,80 +97,357 @@ func NewBatchSQL(ctx context.Context, buffSize uint32, flushSize uint32, flushIn
 	}
 
 	batchSQL := &BatchSQL{
+		ctx:             ctx,
+		config:          config,
 		executor:        executor,
 		metricsReporter: reporter,
 	}
+	if lp, ok := executorAs[interface{ Logger() *slog.Logger }](executor); ok {
+		batchSQL.logger = newEventLogger(lp.Logger(), DefaultLogSampling)
+	}
+	batchSQL.settings.Store(&flushSettings{size: config.FlushSize, interval: config.FlushInterval})
+	batchSQL.health.started = time.Now()
+	batchSQL.health.configure(HealthConfig{})
+	if config.AutoTune.Enabled {
+		batchSQL.tuner = newFlushTuner(config.AutoTune, config.FlushSize)
+	}
+
+	// 共享模式：所有表共用一个管道；隔离模式下按 schema 懒创建，不预先创建
+	if !config.PerSchemaPipeline {
+		batchSQL.pipeline = batchSQL.startPipeline(batchSQL.pipelineConfig(""))
+	}
+	// 标记管道生命周期：创建时 ctx 一旦取消，后续 Submit 均应拒绝
+	go func() {
+		<-ctx.Done()
+		batchSQL.closed.Store(true)
+		batchSQL.logger.log(context.Background(), slog.LevelInfo, "batchsql: closed, rejecting further submits", slog.Any("reason", context.Cause(ctx)))
+	}()
 
-	// 创建 flush 函数，使用批量执行器处理数据
-	flushFunc := func(ctx context.Context, batchData []*Request) error {
-		// 按schema分组处理
-		schemaGroups := make(map[*Schema][]*Request)
-		for _, request := range batchData {
-			schema := request.Schema()
-			schemaGroups[schema] = append(schemaGroups[schema], request)
+	return batchSQL
+}
+
+// pipelineHandle 管道及其提交侧状态
+type pipelineHandle struct {
+	// 当前一代管道；Reconfigure 调整攒批参数时整体替换，旧管道排空后退役
+	stage atomic.Pointer[pipelineStage]
+	// 刷新函数（顺序模式下各代管道共享同一调度器）
+	flushFunc func(ctx context.Context, batchData []*Request) error
+
+	// 顺序模式：序号分配与入队需原子完成（以通道实现互斥，等待时可响应 ctx）
+	submitLock chan struct{}
+	nextSeq    uint64
+
+	// OverflowDropOldest：管道前的前置队列（可淘汰最旧请求）
+	front chan *Request
+}
+
+// ordered 是否启用了顺序保证
+func (h *pipelineHandle) ordered() bool { return h.submitLock != nil }
+
+// queueLength 当前管道通道与前置队列中的请求数（近似）
+func (h *pipelineHandle) queueLength() int {
+	return len(h.stage.Load().pipeline.DataChan()) + len(h.front)
+}
+
+// startPipeline 创建并异步启动一个管道，flush 统一走 BatchSQL.flush（顺序模式走 flushOrdered）
+func (b *BatchSQL) startPipeline(config gopipeline.PipelineConfig) *pipelineHandle {
+	h := &pipelineHandle{flushFunc: b.flush}
+	if b.config.Ordering.Mode != OrderingNone {
+		h.submitLock = make(chan struct{}, 1)
+		dispatcher := newOrderedDispatcher()
+		h.flushFunc = func(ctx context.Context, batchData []*Request) error {
+			return b.flushOrdered(ctx, dispatcher, batchData)
 		}
+	}
+	h.stage.Store(b.startStage(h, config))
+	if b.config.evicting() {
+		b.startEvictionPump(h, config.BufferSize)
+	}
+	return h
+}
+
+// flush 管道刷新函数：按 schema 分组后交给批量执行器处理
+// 多个 schema 组并发执行（受执行器 WithConcurrencyLimit 约束），各组错误互不影响，
+// 最终以 errors.Join 汇总；每个组的错误包装为 *SchemaError 以标识失败的表
+func (b *BatchSQL) flush(ctx context.Context, batchData []*Request) error {
+	// 按schema分组处理
+	schemaGroups := make(map[*Schema][]*Request)
+	for _, request := range batchData {
+		schema := request.Schema()
+		schemaGroups[schema] = append(schemaGroups[schema], request)
+	}
 
-		// 处理每个schema组
+	// 单组无需并发调度
+	if len(schemaGroups) == 1 {
 		for schema, requests := range schemaGroups {
-			assembleStart := time.Now()
-			// 在开始耗时操作前快速检查
-			if err := ctx.Err(); err != nil {
-				return err
-			}
+			return b.executeGroup(ctx, schema, requests)
+		}
+	}
 
-			// 转换为数据格式
-			data := make([]map[string]any, len(requests))
-			for i, request := range requests {
-				// 如果单个schema的数据量很大，可以定期检查
-				if len(requests) > 10000 && i%1000 == 0 {
-					if err := ctx.Err(); err != nil {
-						return err
-					}
-				}
-				rowData := make(map[string]any)
-				values := request.GetOrderedValues()
-				columns := schema.Columns
+	// 组级并发上限与执行器并发上限保持一致（<= 0 表示不限）
+	var semaphore chan struct{}
+	if limit := executorConcurrencyLimit(b.executor); limit > 0 {
+		semaphore = make(chan struct{}, limit)
+	}
 
-				for j, col := range columns {
-					if j < len(values) {
-						rowData[col] = values[j]
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for schema, requests := range schemaGroups {
+		wg.Add(1)
+		go func(schema *Schema, requests []*Request) {
+			defer wg.Done()
+			var err error
+			if semaphore != nil {
+				select {
+				case semaphore <- struct{}{}:
+					defer func() { <-semaphore }()
+				case <-ctx.Done():
+					err = &SchemaError{Table: schema.Name, Err: ctx.Err()}
+					// 未执行的组同样释放内存预算并通知完成回调
+					b.releaseMemory(requests)
+					for _, request := range requests {
+						request.complete(err)
 					}
 				}
-				data[i] = rowData
 			}
+			if err == nil {
+				err = b.executeGroup(ctx, schema, requests)
+			}
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(schema, requests)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// executeGroup 执行单个 schema 组；启用 MemoryConfig.FlushBytes 时按字节切分后顺序执行
+func (b *BatchSQL) executeGroup(ctx context.Context, schema *Schema, requests []*Request) error {
+	chunks := b.splitByBytes(requests)
+	if len(chunks) == 1 {
+		return b.executeChunk(ctx, schema, requests)
+	}
+	var errs []error
+	for _, chunk := range chunks {
+		if err := b.executeChunk(ctx, schema, chunk); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// executeChunk 组装一个批次的数据并执行；错误包装为 *SchemaError
+func (b *BatchSQL) executeChunk(ctx context.Context, schema *Schema, requests []*Request) (err error) {
+	// 批次结束（成功或失败）后通知各请求的完成回调（最后执行：统计与 WAL 确认已完成）
+	// 批次落盘（SpillConfig）时改由落盘队列在重放结束后通知，避免调用方把仅存于本地文件的数据当作已写入
+	completion := &spillCompletion{onDone: func(err error) {
+		for _, request := range requests {
+			request.complete(err)
+		}
+	}}
+	ctx = withSpillCompletion(ctx, completion)
+	defer func() {
+		if err == nil && completion.taken.Load() {
+			return
+		}
+		completion.onDone(err)
+	}()
+	// 批次结束（成功或失败）后请求不再占用缓冲内存
+	defer b.releaseMemory(requests)
+	counters := b.stats.table(schema.Name)
+	counters.inFlight.Add(1)
+	defer func() {
+		counters.inFlight.Add(-1)
+		b.stats.recordBatch(schema.Name, len(requests), err)
+		b.health.record(err)
+	}()
+	// panic 时先转为错误供上面的统计与完成回调使用，再继续向上传播（由管道或顺序调度器恢复）
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrBatchPanicked, r)
+			panic(r)
+		}
+	}()
+
+	// 可选链路追踪：批次 span 关联批内各请求的 submit span
+	if _, ok := b.metricsReporter.(TracingMetricsReporter); ok {
+		links := make([]context.Context, 0, len(requests))
+		for _, request := range requests {
+			if request.traceCtx != nil {
+				links = append(links, request.traceCtx)
+			}
+		}
+		var endBatch func(error)
+		ctx, endBatch = startSpan(b.metricsReporter, ctx, SpanInfo{Stage: SpanBatch, Table: schema.Name, Rows: len(requests), Links: links})
+		defer func() { endBatch(err) }()
+	}
 
-			// 组装完成指标（批大小 + 组装耗时）
-			batchSQL.metricsReporter.ObserveBatchSize(len(requests))
-			batchSQL.metricsReporter.ObserveBatchAssemble(time.Since(assembleStart))
+	assembleStart := time.Now()
+	_, endAssemble := startSpan(b.metricsReporter, ctx, SpanInfo{Stage: SpanAssemble, Table: schema.Name, Rows: len(requests)})
+	// 在开始耗时操作前快速检查
+	if err := ctx.Err(); err != nil {
+		endAssemble(err)
+		return &SchemaError{Table: schema.Name, Err: err}
+	}
 
-			// 执行批量操作
-			if err := batchSQL.executor.ExecuteBatch(ctx, schema, data); err != nil {
-				return err
+	// 转换为数据格式
+	data := make([]map[string]any, len(requests))
+	for i, request := range requests {
+		// 如果单个schema的数据量很大，可以定期检查
+		if len(requests) > 10000 && i%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				endAssemble(err)
+				return &SchemaError{Table: schema.Name, Err: err}
 			}
 		}
-		return nil
+		rowData := make(map[string]any)
+		values := request.GetOrderedValues()
+		columns := schema.Columns
+
+		for j, col := range columns {
+			if j < len(values) {
+				rowData[col] = values[j]
+			}
+		}
+		data[i] = rowData
 	}
 
-	pipeline := gopipeline.NewStandardPipeline(
-		gopipeline.PipelineConfig{
-			BufferSize:    buffSize,
-			FlushSize:     flushSize,
-			FlushInterval: flushInterval,
-		},
-		flushFunc,
-	)
+	// 可选：批内按冲突键去重（在 SQL 生成之前）
+	if b.config.Dedup.Enabled {
+		var collapsed int
+		data, collapsed = b.config.Dedup.apply(schema, data)
+		if collapsed > 0 {
+			if dr, ok := b.metricsReporter.(DedupMetricsReporter); ok {
+				dr.ObserveDedupCollapsed(schema.Name, collapsed)
+			}
+		}
+	}
 
-	batchSQL.pipeline = pipeline
-	go func() {
-		_ = pipeline.AsyncPerform(ctx)
-	}()
-	// 标记管道生命周期：创建时 ctx 一旦取消，后续 Submit 均应拒绝
-	go func() {
-		<-ctx.Done()
-		batchSQL.closed.Store(true)
-	}()
+	// 组装完成指标（批大小 + 组装耗时）
+	b.metricsReporter.ObserveBatchSize(len(requests))
+	b.metricsReporter.ObserveBatchAssemble(time.Since(assembleStart))
+	endAssemble(nil)
+	xr, extended := b.metricsReporter.(ExtendedMetricsReporter)
+	if extended {
+		xr.ObserveTableAssemble(schema.Name, time.Since(assembleStart))
+		xr.ObservePayloadBytes(schema.Name, estimateRowsSize(data))
+	}
 
-	return batchSQL
+	// 幂等模式下批次 id 由预写日志决定并先于执行落盘：提交后、checkpoint 前崩溃时，
+	// 重放按原批次边界与 id 执行，已提交的批次被去重表跳过
+	if b.wal != nil && b.config.Idempotency.Enabled {
+		if _, ok := BatchIDFromContext(ctx); !ok {
+			if id, werr := b.wal.markBatch(schema.Name, requests); werr != nil {
+				b.logger.log(ctx, slog.LevelWarn, "batchsql: wal batch record failed",
+					slog.String("table", schema.Name), slog.Int("rows", len(requests)), slog.Any("error", werr))
+			} else if id != "" {
+				ctx = WithBatchID(ctx, id)
+			}
+		}
+	}
+
+	// 执行批量操作
+	executeStart := time.Now()
+	err = b.executor.ExecuteBatch(ctx, schema, data)
+	b.observeTune(ctx, schema, len(data), time.Since(executeStart), err)
+	if extended {
+		status := "success"
+		if err != nil {
+			status = "fail"
+		}
+		xr.AddRows(schema.Name, len(data), status)
+	}
+	if err != nil {
+		b.logger.log(ctx, slog.LevelError, "batchsql: batch dropped",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)),
+			slog.Duration("duration", time.Since(assembleStart)), slog.Any("error", err))
+		return &SchemaError{Table: schema.Name, Err: err}
+	}
+	// 预写日志 checkpoint：批次执行成功后确认，失败的请求保留在日志中待下次启动重放
+	if b.wal != nil {
+		if werr := b.wal.ack(requests); werr != nil {
+			b.logger.log(ctx, slog.LevelWarn, "batchsql: wal checkpoint failed",
+				slog.String("table", schema.Name), slog.Int("rows", len(requests)), slog.Any("error", werr))
+		}
+	}
+	return nil
+}
+
+// WithLogger 设置结构化日志器（nil 表示关闭；默认继承执行器的日志器），高频事件按 DefaultLogSampling 采样
+// 需在提交前调用
+func (b *BatchSQL) WithLogger(logger *slog.Logger) *BatchSQL {
+	b.logger = newEventLogger(logger, DefaultLogSampling)
+	return b
+}
+
+// Stats 返回统计快照（计数器以原子操作维护，可在任意 goroutine 调用）
+// 行数按请求计（批内去重前）；Retried 取自执行器（需实现 StatsProvider，如 ThrottledBatchExecutor）
+func (b *BatchSQL) Stats() Stats {
+	s := b.stats.snapshot()
+	if sp, ok := executorAs[StatsProvider](b.executor); ok {
+		for name, es := range sp.Stats().Tables {
+			ts := s.Tables[name]
+			ts.Retried = es.Retried
+			s.Tables[name] = ts
+			s.Retried += es.Retried
+		}
+	}
+	s.BufferedBytes = b.memory.bufferedBytes()
+	b.forEachPipeline(func(h *pipelineHandle) {
+		s.QueueLength += h.queueLength()
+	})
+	return s
+}
+
+// executorConcurrencyLimit 探测执行器的并发上限（未实现探测接口或不限流时返回 0）
+func executorConcurrencyLimit(executor BatchExecutor) int {
+	if cl, ok := executorAs[interface{ ConcurrencyLimit() int }](executor); ok {
+		return cl.ConcurrencyLimit()
+	}
+	return 0
+}
+
+// schemaPipeline 返回表对应的独立管道；首次访问时按配置懒创建并启动
+func (b *BatchSQL) schemaPipeline(name string) *pipelineHandle {
+	if v, ok := b.schemaPipelines.Load(name); ok {
+		return v.(*pipelineHandle)
+	}
+
+	b.schemaPipelinesMu.Lock()
+	defer b.schemaPipelinesMu.Unlock()
+	if v, ok := b.schemaPipelines.Load(name); ok {
+		return v.(*pipelineHandle)
+	}
+
+	h := b.startPipeline(b.pipelineConfig(name))
+	b.schemaPipelines.Store(name, h)
+	return h
+}
+
+// mergedErrorChan 懒初始化统一错误通道（首次调用决定缓冲大小）
+func (b *BatchSQL) mergedErrorChan(size int) chan error {
+	b.errOnce.Do(func() {
+		n := size
+		if n <= 0 {
+			n = defaultErrorChanSize(b.config.BufferSize, b.config.FlushSize)
+		}
+		b.errChan = make(chan error, n)
+	})
+	return b.errChan
+}
+
+// defaultErrorChanSize 与 go-pipeline 的默认错误缓冲计算方式保持一致
+func defaultErrorChanSize(bufferSize, flushSize uint32) int {
+	if bufferSize == 0 {
+		return 1
+	}
+	return int((flushSize + bufferSize - 1) / bufferSize)
 }
 
 // PipelineConfig 管道配置
@@ -136,6 +458,58 @@ type PipelineConfig struct {
 
 	// Step 2: 可选重试配置（零值=关闭，向后兼容）
 	Retry RetryConfig
+
+	// 可选：按 schema 隔离管道（零值=关闭，所有表共享一个管道）
+	// 开启后每个表懒创建独立管道（独立缓冲、批量与刷新间隔），慢表不再拖累其他表的刷新
+	PerSchemaPipeline bool
+	// 按表名覆盖独立管道配置（仅 PerSchemaPipeline 时生效；零值字段沿用上面的全局配置）
+	SchemaPipelines map[string]SchemaPipelineConfig
+
+	// 可选：顺序保证（零值=不保证）；同一表/分区键的批次按提交顺序执行，不同键之间并行
+	Ordering OrderingConfig
+
+	// 可选：批内按冲突键去重（零值=关闭）
+	Dedup DedupConfig
+
+	// 可选：缓冲区满时的溢出策略（零值=阻塞）
+	Overflow OverflowConfig
+
+	// 可选：按估算字节数切分批次与限制缓冲内存（零值=关闭）
+	Memory MemoryConfig
+
+	// 可选：FlushSize 在线自动调优（零值=关闭）
+	AutoTune AutoTuneConfig
+
+	// 可选：批次幂等（零值=关闭）；作用于 SQLBatchProcessor，由 SQL 工厂方法设置
+	Idempotency IdempotencyConfig
+}
+
+// SchemaPipelineConfig 单表独立管道配置（零值字段沿用 PipelineConfig 全局值）
+type SchemaPipelineConfig struct {
+	BufferSize    uint32
+	FlushSize     uint32
+	FlushInterval time.Duration
+}
+
+// schemaPipelineConfig 合并全局配置与单表覆盖配置
+func (c PipelineConfig) schemaPipelineConfig(name string) gopipeline.PipelineConfig {
+	out := gopipeline.PipelineConfig{
+		BufferSize:    c.BufferSize,
+		FlushSize:     c.FlushSize,
+		FlushInterval: c.FlushInterval,
+	}
+	if o, ok := c.SchemaPipelines[name]; ok {
+		if o.BufferSize > 0 {
+			out.BufferSize = o.BufferSize
+		}
+		if o.FlushSize > 0 {
+			out.FlushSize = o.FlushSize
+		}
+		if o.FlushInterval > 0 {
+			out.FlushInterval = o.FlushInterval
+		}
+	}
+	return out
 }
 
 // NewMySQLBatchSQL 创建MySQL BatchSQL实例（使用默认Driver）
@@ -144,11 +518,7 @@ type PipelineConfig struct {
 */
 // 这是推荐的使用方式，使用MySQL优化的默认配置
 func NewMySQLBatchSQL(ctx context.Context, db *sql.DB, config PipelineConfig) *BatchSQL {
-	executor := NewSQLThrottledBatchExecutorWithDriver(db, DefaultMySQLDriver)
-	if config.Retry.Enabled {
-		executor.WithRetryConfig(config.Retry)
-	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, newSQLExecutor(db, DefaultMySQLDriver, config))
 }
 
 // NewMySQLBatchSQLWithDriver 创建MySQL BatchSQL实例（使用自定义Driver）
@@ -157,47 +527,36 @@ func NewMySQLBatchSQL(ctx context.Context, db *sql.DB, config PipelineConfig) *B
 */
 // 适用于需要自定义SQL生成逻辑的场景（如TiDB优化）
 func NewMySQLBatchSQLWithDriver(ctx context.Context, db *sql.DB, config PipelineConfig, driver SQLDriver) *BatchSQL {
-	executor := NewSQLThrottledBatchExecutorWithDriver(db, driver)
-	if config.Retry.Enabled {
-		executor.WithRetryConfig(config.Retry)
-	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, newSQLExecutor(db, driver, config))
 }
 
 // NewPostgreSQLBatchSQL 创建PostgreSQL BatchSQL实例（使用默认Driver）
 func NewPostgreSQLBatchSQL(ctx context.Context, db *sql.DB, config PipelineConfig) *BatchSQL {
-	executor := NewSQLThrottledBatchExecutorWithDriver(db, DefaultPostgreSQLDriver)
-	if config.Retry.Enabled {
-		executor.WithRetryConfig(config.Retry)
-	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, newSQLExecutor(db, DefaultPostgreSQLDriver, config))
 }
 
 // NewPostgreSQLBatchSQLWithDriver 创建PostgreSQL BatchSQL实例（使用自定义Driver）
 func NewPostgreSQLBatchSQLWithDriver(ctx context.Context, db *sql.DB, config PipelineConfig, driver SQLDriver) *BatchSQL {
-	executor := NewSQLThrottledBatchExecutorWithDriver(db, driver)
-	if config.Retry.Enabled {
-		executor.WithRetryConfig(config.Retry)
-	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, newSQLExecutor(db, driver, config))
 }
 
 // NewSQLiteBatchSQL 创建SQLite BatchSQL实例（使用默认Driver）
 func NewSQLiteBatchSQL(ctx context.Context, db *sql.DB, config PipelineConfig) *BatchSQL {
-	executor := NewSQLThrottledBatchExecutorWithDriver(db, DefaultSQLiteDriver)
-	if config.Retry.Enabled {
-		executor.WithRetryConfig(config.Retry)
-	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, newSQLExecutor(db, DefaultSQLiteDriver, config))
 }
 
 // NewSQLiteBatchSQLWithDriver 创建SQLite BatchSQL实例（使用自定义Driver）
 func NewSQLiteBatchSQLWithDriver(ctx context.Context, db *sql.DB, config PipelineConfig, driver SQLDriver) *BatchSQL {
-	executor := NewSQLThrottledBatchExecutorWithDriver(db, driver)
+	return NewBatchSQLWithConfig(ctx, config, newSQLExecutor(db, driver, config))
+}
+
+// newSQLExecutor 按 PipelineConfig 创建 SQL 执行器（重试配置作用于执行器，幂等配置作用于处理器）
+func newSQLExecutor(db *sql.DB, driver SQLDriver, config PipelineConfig) *ThrottledBatchExecutor {
+	executor := NewThrottledBatchExecutor(NewSQLBatchProcessor(db, driver).WithIdempotency(config.Idempotency))
 	if config.Retry.Enabled {
 		executor.WithRetryConfig(config.Retry)
 	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return executor
 }
 
 // NewRedisBatchSQL 创建Redis BatchSQL实例
@@ -210,7 +569,7 @@ func NewRedisBatchSQL(ctx context.Context, db *redisV9.Client, config PipelineCo
 	if config.Retry.Enabled {
 		executor.WithRetryConfig(config.Retry)
 	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, executor)
 }
 
 func NewRedisBatchSQLWithDriver(ctx context.Context, db *redisV9.Client, config PipelineConfig, driver RedisDriver) *BatchSQL {
@@ -218,7 +577,7 @@ func NewRedisBatchSQLWithDriver(ctx context.Context, db *redisV9.Client, config
 	if config.Retry.Enabled {
 		executor.WithRetryConfig(config.Retry)
 	}
-	return NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, executor)
+	return NewBatchSQLWithConfig(ctx, config, executor)
 }
 
 // NewBatchSQLWithMock 使用模拟执行器创建 BatchSQL 实例（用于测试）
@@ -226,7 +585,7 @@ func NewRedisBatchSQLWithDriver(ctx context.Context, db *redisV9.Client, config
 // 适用于单元测试，不依赖真实数据库连接
 func NewBatchSQLWithMock(ctx context.Context, config PipelineConfig) (*BatchSQL, *MockExecutor) {
 	mockExecutor := NewMockExecutor()
-	batchSQL := NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, mockExecutor)
+	batchSQL := NewBatchSQLWithConfig(ctx, config, mockExecutor)
 	return batchSQL, mockExecutor
 }
 
@@ -235,24 +594,33 @@ func NewBatchSQLWithMock(ctx context.Context, config PipelineConfig) (*BatchSQL,
 // 适用于测试自定义SQLDriver的SQL生成逻辑
 func NewBatchSQLWithMockDriver(ctx context.Context, config PipelineConfig, sqlDriver SQLDriver) (*BatchSQL, *MockExecutor) {
 	mockExecutor := NewMockExecutorWithDriver(sqlDriver)
-	batchSQL := NewBatchSQL(ctx, config.BufferSize, config.FlushSize, config.FlushInterval, mockExecutor)
+	batchSQL := NewBatchSQLWithConfig(ctx, config, mockExecutor)
 	return batchSQL, mockExecutor
 }
 
-// ErrorChan 获取错误通道
+// ErrorChan 获取错误通道（首次调用决定缓冲大小，满时丢弃新错误）
+// 汇总所有管道（含按 schema 隔离的独立管道、Reconfigure 替换前后的管道）的错误
 func (b *BatchSQL) ErrorChan(size int) <-chan error {
-	return b.pipeline.ErrorChan(size)
+	return b.mergedErrorChan(size)
 }
 
-// Submit 提交请求到批量处理管道
+// Submit 提交请求到批量处理管道；缓冲区满时按 PipelineConfig.Overflow 处理（默认阻塞）
 func (b *BatchSQL) Submit(ctx context.Context, request *Request) error {
+	return b.submit(ctx, request, false)
+}
+
+// TrySubmit 非阻塞提交：缓冲区满时按溢出策略处理，无法立即入队则返回 ErrQueueFull
+func (b *BatchSQL) TrySubmit(ctx context.Context, request *Request) error {
+	return b.submit(ctx, request, true)
+}
+
+func (b *BatchSQL) submit(ctx context.Context, request *Request, try bool) (err error) {
 	// 优先尊重取消，避免 select 在多就绪时随机选择发送路径
 	if err := ctx.Err(); err != nil {
 		return err
 	}
-	// 若 BatchSQL 所属生命周期已结束（创建时的 ctx 已取消），直接拒绝提交
-	if b.closed.Load() {
-		return context.Canceled
+	if err := b.checkOpen(ctx); err != nil {
+		return err
 	}
 
 	if request == nil {
@@ -260,6 +628,35 @@ func (b *BatchSQL) Submit(ctx context.Context, request *Request) error {
 	}
 
 	schema := request.Schema()
+	if err := validateSchema(schema); err != nil {
+		return err
+	}
+
+	// 可选链路追踪：submit span 覆盖排队等待与入队，其 ctx 随请求传递，供批次 span 建立关联
+	if _, ok := b.metricsReporter.(TracingMetricsReporter); ok {
+		var endSpan func(error)
+		ctx, endSpan = startSpan(b.metricsReporter, ctx, SpanInfo{Stage: SpanSubmit, Table: schema.Name, Rows: 1})
+		request.traceCtx = ctx
+		defer func() { endSpan(err) }()
+	}
+
+	return b.enqueue(ctx, schema, request, b.wal != nil, try)
+}
+
+// checkOpen 若 BatchSQL 所属生命周期已结束（创建时的 ctx 已取消），直接拒绝提交
+func (b *BatchSQL) checkOpen(ctx context.Context) error {
+	if b.closed.Load() {
+		if xr, ok := b.metricsReporter.(ExtendedMetricsReporter); ok {
+			xr.IncSubmitRejected("closed")
+		}
+		b.logger.sampled(ctx, slog.LevelWarn, "batchsql: submit rejected, batch closed")
+		return context.Canceled
+	}
+	return nil
+}
+
+// validateSchema 提交前的 schema 校验
+func validateSchema(schema *Schema) error {
 	if schema == nil {
 		return ErrInvalidSchema
 	}
@@ -269,19 +666,72 @@ func (b *BatchSQL) Submit(ctx context.Context, request *Request) error {
 	if len(schema.Name) == 0 {
 		return ErrEmptySchemaName
 	}
+	return nil
+}
 
-	dataChan := b.pipeline.DataChan()
-	enqueueStart := time.Now()
+// enqueue 将请求送入对应管道；logWAL 为 true 时先写入预写日志（重放的请求已在日志中，不再重复写入）
+// try 为 true 时不阻塞（TrySubmit）
+func (b *BatchSQL) enqueue(ctx context.Context, schema *Schema, request *Request, logWAL, try bool) error {
+	if err := b.reserveMemory(ctx, schema, request, try); err != nil {
+		return err
+	}
+	queued := false
+	defer func() {
+		if !queued {
+			b.releaseMemory([]*Request{request})
+		}
+	}()
+
+	h := b.pipeline
+	if b.config.PerSchemaPipeline {
+		h = b.schemaPipeline(schema.Name)
+	}
+
+	// 顺序模式：持有提交锁完成“分配序号 + 入队”，保证通道顺序即提交顺序
+	if h.ordered() {
+		select {
+		case h.submitLock <- struct{}{}:
+			defer func() { <-h.submitLock }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		h.nextSeq++
+		request.seq = h.nextSeq
+		// 未入队（写日志失败、溢出丢弃或转存）则回收序号，避免放行调度出现空洞
+		defer func() {
+			if !queued {
+				h.nextSeq--
+			}
+		}()
+	}
 
-	select {
-	case dataChan <- request:
-		// 入队成功后记录入队耗时与队列长度
-		// 注意：len(dataChan) 是近似观测，仅用于指标参考
-		// 这里将耗时统计放在调用方路径内，默认 Noop 不引入开销
-		b.metricsReporter.ObserveEnqueueLatency(time.Since(enqueueStart))
-		b.metricsReporter.SetQueueLength(len(dataChan))
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
+	// 预写日志：在顺序锁内追加，保证日志顺序与入队顺序一致
+	if logWAL {
+		if err := b.wal.append(request); err != nil {
+			return err
+		}
 	}
+
+	enqueueStart := time.Now()
+	if h.trySend(request) {
+		queued = true
+	} else {
+		// 缓冲区已满：按溢出策略处理
+		var err error
+		if queued, err = b.overflow(ctx, h, schema, request, try, logWAL); err != nil || !queued {
+			if err == nil {
+				// 已转存到落盘队列，视为提交成功
+				b.stats.table(schema.Name).submitted.Add(1)
+			}
+			return err
+		}
+	}
+
+	// 入队成功后记录入队耗时与队列长度
+	// 注意：队列长度是近似观测，仅用于指标参考
+	// 这里将耗时统计放在调用方路径内，默认 Noop 不引入开销
+	b.metricsReporter.ObserveEnqueueLatency(time.Since(enqueueStart))
+	b.metricsReporter.SetQueueLength(h.queueLength())
+	b.stats.table(schema.Name).submitted.Add(1)
+	return nil
 }
@@ -0,0 +1,170 @@
+package batchsql_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// captureProcessor 记录每次 GenerateOperations 收到的数据
+type captureProcessor struct {
+	mu      sync.Mutex
+	batches [][]map[string]any
+}
+
+func (p *captureProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	p.mu.Lock()
+	p.batches = append(p.batches, data)
+	p.mu.Unlock()
+	return batchsql.Operations{}, nil
+}
+
+func (p *captureProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	return nil
+}
+
+func (p *captureProcessor) snapshot() [][]map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]map[string]any(nil), p.batches...)
+}
+
+type dedupMetrics struct {
+	batchsql.NoopMetricsReporter
+	collapsed int32
+}
+
+func (m *dedupMetrics) ObserveDedupCollapsed(table string, n int) {
+	atomic.AddInt32(&m.collapsed, int32(n))
+}
+
+func runDedupBatch(t *testing.T, cfg batchsql.DedupConfig, schema *batchsql.Schema, reqs []*batchsql.Request) ([]map[string]any, *dedupMetrics) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := &captureProcessor{}
+	metrics := &dedupMetrics{}
+	exec := batchsql.NewThrottledBatchExecutor(proc).WithMetricsReporter(metrics)
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     uint32(len(reqs)),
+		FlushInterval: time.Hour,
+		Dedup:         cfg,
+	}, exec)
+	for _, r := range reqs {
+		if err := b.Submit(ctx, r); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && len(proc.snapshot()) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	batches := proc.snapshot()
+	if len(batches) != 1 {
+		t.Fatalf("expected exactly one batch, got %d", len(batches))
+	}
+	return batches[0], metrics
+}
+
+func TestBatchSQL_Dedup_Policies(t *testing.T) {
+	schema := batchsql.NewSchema("counters", batchsql.ConflictUpdate, "id", "name", "hits")
+	newReqs := func() []*batchsql.Request {
+		return []*batchsql.Request{
+			batchsql.NewRequest(schema).SetInt64("id", 1).SetString("name", "a").SetInt64("hits", 1),
+			batchsql.NewRequest(schema).SetInt64("id", 2).SetString("name", "b").SetInt64("hits", 2),
+			batchsql.NewRequest(schema).SetInt64("id", 1).SetString("name", "c").SetInt64("hits", 3),
+		}
+	}
+
+	data, metrics := runDedupBatch(t, batchsql.DedupConfig{Enabled: true}, schema, newReqs())
+	if len(data) != 2 || data[0]["name"] != "c" || data[1]["name"] != "b" {
+		t.Fatalf("keep-last unexpected: %#v", data)
+	}
+	if atomic.LoadInt32(&metrics.collapsed) != 1 {
+		t.Fatalf("expected 1 collapsed row, got %d", metrics.collapsed)
+	}
+
+	data, _ = runDedupBatch(t, batchsql.DedupConfig{Enabled: true, Policy: batchsql.DedupKeepFirst}, schema, newReqs())
+	if len(data) != 2 || data[0]["name"] != "a" {
+		t.Fatalf("keep-first unexpected: %#v", data)
+	}
+
+	merge := func(_ *batchsql.Schema, existing, incoming map[string]any) map[string]any {
+		out := make(map[string]any, len(incoming))
+		for k, v := range incoming {
+			out[k] = v
+		}
+		out["hits"] = existing["hits"].(int64) + incoming["hits"].(int64)
+		return out
+	}
+	data, _ = runDedupBatch(t, batchsql.DedupConfig{Enabled: true, Policy: batchsql.DedupMerge, Merge: merge}, schema, newReqs())
+	if len(data) != 2 || data[0]["hits"] != int64(4) || data[0]["name"] != "c" {
+		t.Fatalf("merge unexpected: %#v", data)
+	}
+}
+
+func TestBatchSQL_Dedup_CompositeConflictColumns(t *testing.T) {
+	schema := batchsql.NewSchema("scores", batchsql.ConflictUpdate, "tenant", "id", "score").
+		WithConflictColumns("tenant", "id")
+	reqs := []*batchsql.Request{
+		batchsql.NewRequest(schema).SetString("tenant", "a").SetInt64("id", 1).SetInt64("score", 1),
+		batchsql.NewRequest(schema).SetString("tenant", "b").SetInt64("id", 1).SetInt64("score", 2),
+		batchsql.NewRequest(schema).SetString("tenant", "a").SetInt64("id", 1).SetInt64("score", 3),
+	}
+	data, _ := runDedupBatch(t, batchsql.DedupConfig{Enabled: true}, schema, reqs)
+	if len(data) != 2 || data[0]["score"] != int64(3) || data[1]["tenant"] != "b" {
+		t.Fatalf("composite dedup unexpected: %#v", data)
+	}
+}
+
+func TestBatchSQL_Dedup_DisabledKeepsDuplicates(t *testing.T) {
+	schema := batchsql.NewSchema("users", batchsql.ConflictUpdate, "id")
+	reqs := []*batchsql.Request{
+		batchsql.NewRequest(schema).SetInt64("id", 1),
+		batchsql.NewRequest(schema).SetInt64("id", 1),
+	}
+	data, _ := runDedupBatch(t, batchsql.DedupConfig{}, schema, reqs)
+	if len(data) != 2 {
+		t.Fatalf("dedup disabled must keep duplicates, got %d rows", len(data))
+	}
+}
+
+func TestBatchSQL_Dedup_NullKeysPassThrough(t *testing.T) {
+	schema := batchsql.NewSchema("scores", batchsql.ConflictUpdate, "tenant", "id", "score").
+		WithConflictColumns("tenant", "id")
+	reqs := []*batchsql.Request{
+		batchsql.NewRequest(schema).SetString("tenant", "a").SetNull("id").SetInt64("score", 1),
+		batchsql.NewRequest(schema).SetString("tenant", "a").SetNull("id").SetInt64("score", 2),
+		batchsql.NewRequest(schema).SetString("tenant", "a").SetInt64("score", 3),
+	}
+	data, metrics := runDedupBatch(t, batchsql.DedupConfig{Enabled: true}, schema, reqs)
+	if len(data) != 3 {
+		t.Fatalf("rows with NULL conflict keys never conflict and must all be kept, got %#v", data)
+	}
+	if n := atomic.LoadInt32(&metrics.collapsed); n != 0 {
+		t.Fatalf("NULL-key rows must not be counted as collapsed, got %d", n)
+	}
+}
+
+func TestBatchSQL_Dedup_SeparatorInKeyValuesDoesNotCollide(t *testing.T) {
+	schema := batchsql.NewSchema("scores", batchsql.ConflictUpdate, "tenant", "id", "score").
+		WithConflictColumns("tenant", "id")
+	// 未转义的分隔符拼接下两行的复合键相同
+	reqs := []*batchsql.Request{
+		batchsql.NewRequest(schema).SetString("tenant", "a\x1fs:b").SetString("id", "c").SetInt64("score", 1),
+		batchsql.NewRequest(schema).SetString("tenant", "a").SetString("id", "b\x1fs:c").SetInt64("score", 2),
+	}
+	data, metrics := runDedupBatch(t, batchsql.DedupConfig{Enabled: true}, schema, reqs)
+	if len(data) != 2 {
+		t.Fatalf("distinct keys containing the separator must not collapse, got %#v", data)
+	}
+	if n := atomic.LoadInt32(&metrics.collapsed); n != 0 {
+		t.Fatalf("expected no collapsed rows, got %d", n)
+	}
+}
@@ -0,0 +1,205 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// orderRecordingExecutor 按顺序键记录执行到的 id，并随机休眠以放大乱序可能
+type orderRecordingExecutor struct {
+	mu      sync.Mutex
+	seen    map[string][]int64
+	keyCol  string
+	blockOn string
+	block   chan struct{}
+}
+
+func (e *orderRecordingExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	key := schema.Name
+	if e.keyCol != "" {
+		key = data[0][e.keyCol].(string)
+	}
+	if e.block != nil && key == e.blockOn {
+		<-e.block
+	}
+	time.Sleep(time.Duration(rand.Intn(2000)) * time.Microsecond)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, row := range data {
+		e.seen[key] = append(e.seen[key], row["id"].(int64))
+	}
+	return nil
+}
+
+func (e *orderRecordingExecutor) snapshot(key string) []int64 {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]int64(nil), e.seen[key]...)
+}
+
+func TestBatchSQL_Ordering_PerSchemaPreservesSubmissionOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := &orderRecordingExecutor{seen: make(map[string][]int64)}
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    64,
+		FlushSize:     3,
+		FlushInterval: 2 * time.Millisecond,
+		Ordering:      batchsql.OrderingConfig{Mode: batchsql.OrderingPerSchema},
+	}, exec)
+
+	users := batchsql.NewSchema("users", batchsql.ConflictUpdate, "id")
+	orders := batchsql.NewSchema("orders", batchsql.ConflictUpdate, "id")
+	const n = 300
+	for i := 1; i <= n; i++ {
+		if err := b.Submit(ctx, batchsql.NewRequest(users).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		if err := b.Submit(ctx, batchsql.NewRequest(orders).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && (len(exec.snapshot("users")) < n || len(exec.snapshot("orders")) < n) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, table := range []string{"users", "orders"} {
+		got := exec.snapshot(table)
+		if len(got) != n {
+			t.Fatalf("%s: expected %d rows, got %d", table, n, len(got))
+		}
+		for i, id := range got {
+			if id != int64(i+1) {
+				t.Fatalf("%s: out of order at %d: got id %d", table, i, id)
+			}
+		}
+	}
+}
+
+func TestBatchSQL_Ordering_PerKeyAllowsParallelismAcrossKeys(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	release := make(chan struct{})
+	exec := &orderRecordingExecutor{
+		seen:    make(map[string][]int64),
+		keyCol:  "tenant",
+		blockOn: "slow",
+		block:   release,
+	}
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    64,
+		FlushSize:     4,
+		FlushInterval: 2 * time.Millisecond,
+		Ordering: batchsql.OrderingConfig{
+			Mode: batchsql.OrderingPerKey,
+			PartitionKey: func(r *batchsql.Request) string {
+				s, _ := r.GetString("tenant")
+				return s
+			},
+		},
+	}, exec)
+
+	schema := batchsql.NewSchema("events", batchsql.ConflictUpdate, "id", "tenant")
+	const n = 50
+	for i := 1; i <= n; i++ {
+		for _, tenant := range []string{"slow", "fast"} {
+			req := batchsql.NewRequest(schema).SetInt64("id", int64(i)).SetString("tenant", tenant)
+			if err := b.Submit(ctx, req); err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+		}
+	}
+
+	// slow 键被阻塞时，fast 键仍应全部按序完成
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(exec.snapshot("fast")) < n {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := exec.snapshot("fast"); len(got) != n {
+		t.Fatalf("fast key should not wait for slow key: got %d rows", len(got))
+	}
+	if got := exec.snapshot("slow"); len(got) != 0 {
+		t.Fatalf("slow key should still be blocked, got %d rows", len(got))
+	}
+
+	close(release)
+	deadline = time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) && len(exec.snapshot("slow")) < n {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, key := range []string{"fast", "slow"} {
+		got := exec.snapshot(key)
+		if len(got) != n {
+			t.Fatalf("%s: expected %d rows, got %d", key, n, len(got))
+		}
+		for i, id := range got {
+			if id != int64(i+1) {
+				t.Fatalf("%s: out of order at %d: got id %d", key, i, id)
+			}
+		}
+	}
+}
+
+// panicOnceExecutor 第一次执行时 panic，之后记录写入行数
+type panicOnceExecutor struct {
+	panicked atomic.Bool
+	rows     atomic.Int64
+}
+
+func (e *panicOnceExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	if e.panicked.CompareAndSwap(false, true) {
+		panic("boom")
+	}
+	e.rows.Add(int64(len(data)))
+	return nil
+}
+
+func TestBatchSQL_Ordering_PanicDoesNotStallLaterBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := &panicOnceExecutor{}
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    16,
+		FlushSize:     2,
+		FlushInterval: 5 * time.Millisecond,
+		Ordering:      batchsql.OrderingConfig{Mode: batchsql.OrderingPerSchema},
+	}, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+	first := make(chan error, 1)
+	if err := b.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 0).OnComplete(func(err error) { first <- err })); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	select {
+	case err := <-first:
+		if !errors.Is(err, batchsql.ErrBatchPanicked) {
+			t.Fatalf("expected ErrBatchPanicked, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("completion callback not called for panicked batch")
+	}
+
+	for i := 1; i <= 4; i++ {
+		if err := b.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for exec.rows.Load() < 4 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := exec.rows.Load(); got != 4 {
+		t.Fatalf("expected later batches to flush after panic, got %d rows", got)
+	}
+}
@@ -0,0 +1,94 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestBatchSQL_Flush_FailedGroupDoesNotDropOthers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := newTableRecordingExecutor()
+	boom := errors.New("boom")
+	exec.fail["broken"] = boom
+
+	// FlushSize 足够大 + 单次定时刷新，确保三个表落在同一批次
+	b := batchsql.NewBatchSQL(ctx, 100, 100, 50*time.Millisecond, exec)
+	errs := b.ErrorChan(10)
+
+	for _, name := range []string{"broken", "users", "orders"} {
+		schema := batchsql.NewSchema(name, batchsql.ConflictIgnore, "id")
+		if err := b.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 1)); err != nil {
+			t.Fatalf("submit %s: %v", name, err)
+		}
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, boom) {
+			t.Fatalf("expected joined error to contain boom, got %v", err)
+		}
+		var schemaErr *batchsql.SchemaError
+		if !errors.As(err, &schemaErr) || schemaErr.Table != "broken" {
+			t.Fatalf("expected SchemaError for table broken, got %#v", schemaErr)
+		}
+		if !strings.Contains(err.Error(), "batchsql: table broken: ") {
+			t.Fatalf("expected joined error text to name the failing table, got %q", err.Error())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected flush error")
+	}
+
+	if len(exec.snapshot("users")) != 1 || len(exec.snapshot("orders")) != 1 {
+		t.Fatalf("healthy tables must still be executed: users=%v orders=%v",
+			exec.snapshot("users"), exec.snapshot("orders"))
+	}
+}
+
+// rendezvousExecutor 在所有预期的组都进入执行前阻塞，用于验证组级并发
+type rendezvousExecutor struct {
+	entered int32
+	want    int32
+	ready   chan struct{}
+}
+
+func (e *rendezvousExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	if atomic.AddInt32(&e.entered, 1) == e.want {
+		close(e.ready)
+	}
+	select {
+	case <-e.ready:
+		return nil
+	case <-time.After(time.Second):
+		return errors.New("groups were not executed concurrently")
+	}
+}
+
+func TestBatchSQL_Flush_GroupsExecuteConcurrently(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := &rendezvousExecutor{want: 3, ready: make(chan struct{})}
+	b := batchsql.NewBatchSQL(ctx, 100, 100, 50*time.Millisecond, exec)
+	errs := b.ErrorChan(10)
+
+	for _, name := range []string{"a", "b", "c"} {
+		schema := batchsql.NewSchema(name, batchsql.ConflictIgnore, "id")
+		_ = b.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 1))
+	}
+
+	select {
+	case <-exec.ready:
+	case err := <-errs:
+		t.Fatalf("unexpected error: %v", err)
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected all groups to be in flight at the same time")
+	}
+}
@@ -0,0 +1,163 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// tableRecordingExecutor 按表记录批大小；可让指定表阻塞或失败
+type tableRecordingExecutor struct {
+	mu      sync.Mutex
+	batches map[string][]int
+	block   map[string]chan struct{}
+	fail    map[string]error
+}
+
+func newTableRecordingExecutor() *tableRecordingExecutor {
+	return &tableRecordingExecutor{
+		batches: make(map[string][]int),
+		block:   make(map[string]chan struct{}),
+		fail:    make(map[string]error),
+	}
+}
+
+func (e *tableRecordingExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	e.mu.Lock()
+	ch := e.block[schema.Name]
+	err := e.fail[schema.Name]
+	e.mu.Unlock()
+	if ch != nil {
+		select {
+		case <-ch:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	e.mu.Lock()
+	e.batches[schema.Name] = append(e.batches[schema.Name], len(data))
+	e.mu.Unlock()
+	return err
+}
+
+func (e *tableRecordingExecutor) snapshot(table string) []int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]int(nil), e.batches[table]...)
+}
+
+func TestBatchSQL_PerSchemaPipeline_RoutesWithOwnFlushSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := newTableRecordingExecutor()
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:        100,
+		FlushSize:         5,
+		FlushInterval:     time.Hour,
+		PerSchemaPipeline: true,
+		SchemaPipelines: map[string]batchsql.SchemaPipelineConfig{
+			"small": {FlushSize: 3},
+		},
+	}, exec)
+
+	small := batchsql.NewSchema("small", batchsql.ConflictIgnore, "id")
+	large := batchsql.NewSchema("large", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 15; i++ {
+		if err := b.Submit(ctx, batchsql.NewRequest(small).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit small: %v", err)
+		}
+		if err := b.Submit(ctx, batchsql.NewRequest(large).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit large: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if len(exec.snapshot("small")) == 5 && len(exec.snapshot("large")) == 3 {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	for _, n := range exec.snapshot("small") {
+		if n != 3 {
+			t.Fatalf("small batches should use overridden flush size 3, got %v", exec.snapshot("small"))
+		}
+	}
+	for _, n := range exec.snapshot("large") {
+		if n != 5 {
+			t.Fatalf("large batches should use global flush size 5, got %v", exec.snapshot("large"))
+		}
+	}
+	if len(exec.snapshot("small")) != 5 || len(exec.snapshot("large")) != 3 {
+		t.Fatalf("unexpected batch counts: small=%v large=%v", exec.snapshot("small"), exec.snapshot("large"))
+	}
+}
+
+func TestBatchSQL_PerSchemaPipeline_SlowTableDoesNotBlockOthers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := newTableRecordingExecutor()
+	release := make(chan struct{})
+	exec.block["slow"] = release
+	defer close(release)
+
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:        10,
+		FlushSize:         2,
+		FlushInterval:     20 * time.Millisecond,
+		PerSchemaPipeline: true,
+	}, exec)
+
+	slow := batchsql.NewSchema("slow", batchsql.ConflictIgnore, "id")
+	fast := batchsql.NewSchema("fast", batchsql.ConflictIgnore, "id")
+	_ = b.Submit(ctx, batchsql.NewRequest(slow).SetInt64("id", 1))
+	_ = b.Submit(ctx, batchsql.NewRequest(fast).SetInt64("id", 1))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) && len(exec.snapshot("fast")) == 0 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(exec.snapshot("fast")) == 0 {
+		t.Fatalf("fast table should be flushed while slow table is blocked")
+	}
+	if len(exec.snapshot("slow")) != 0 {
+		t.Fatalf("slow table should still be blocked")
+	}
+}
+
+func TestBatchSQL_PerSchemaPipeline_MergesErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := newTableRecordingExecutor()
+	boom := errors.New("boom")
+	exec.fail["broken"] = boom
+
+	b := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:        10,
+		FlushSize:         1,
+		FlushInterval:     20 * time.Millisecond,
+		PerSchemaPipeline: true,
+	}, exec)
+	errs := b.ErrorChan(10)
+
+	broken := batchsql.NewSchema("broken", batchsql.ConflictIgnore, "id")
+	if err := b.Submit(ctx, batchsql.NewRequest(broken).SetInt64("id", 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, boom) {
+			t.Fatalf("expected boom, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected error from isolated pipeline on shared ErrorChan")
+	}
+}
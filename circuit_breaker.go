@@ -0,0 +1,218 @@
+package batchsql
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState 熔断器状态
+type CircuitState uint8
+
+const (
+	CircuitClosed   CircuitState = iota // 关闭：正常放行
+	CircuitOpen                         // 打开：快速失败，返回 ErrCircuitOpen
+	CircuitHalfOpen                     // 半开：仅放行一个探测批次
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half_open"
+	default:
+		return "unknown"
+	}
+}
+
+// globalCircuitKey 全局熔断器的键（未按表熔断时使用）
+const globalCircuitKey = "*"
+
+// CircuitBreakerConfig 熔断配置
+/*
+状态流转：
+- closed：连续失败（每次尝试计一次）达到 FailureThreshold 后进入 open
+- open：ExecuteBatch 直接返回 ErrCircuitOpen，不进入重试；OpenTimeout 后首个批次作为探测进入 half-open
+- half-open：仅放行一个探测批次，成功则 closed，失败则重新 open；探测期间其余批次快速失败
+*/
+type CircuitBreakerConfig struct {
+	FailureThreshold int           // 连续失败阈值（默认 5）
+	OpenTimeout      time.Duration // 打开状态持续时长（默认 10s）
+	PerSchema        bool          // 按表独立熔断（默认全局共享）
+	// IsFailure 判断错误是否计入熔断（默认：除上下文取消/超时外的所有错误；单次尝试超时计入）
+	IsFailure func(error) bool
+}
+
+// circuitBreaker 单个熔断器
+type circuitBreaker struct {
+	key          string
+	cfg          CircuitBreakerConfig
+	onTransition func(key string, from, to CircuitState)
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// allow 判断是否放行；probe 为 true 表示本次为半开探测，调用方结束时需 releaseProbe
+func (cb *circuitBreaker) allow() (probe bool, err error) {
+	if cb == nil {
+		return false, nil
+	}
+	cb.mu.Lock()
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.cfg.OpenTimeout {
+			cb.mu.Unlock()
+			return false, ErrCircuitOpen
+		}
+		cb.state = CircuitHalfOpen
+		cb.probing = true
+		cb.mu.Unlock()
+		cb.transition(CircuitOpen, CircuitHalfOpen)
+		return true, nil
+	case CircuitHalfOpen:
+		if cb.probing {
+			cb.mu.Unlock()
+			return false, ErrCircuitOpen
+		}
+		cb.probing = true
+		cb.mu.Unlock()
+		return true, nil
+	default:
+		cb.mu.Unlock()
+		return false, nil
+	}
+}
+
+// record 记录一次尝试结果
+func (cb *circuitBreaker) record(err error) {
+	if cb == nil {
+		return
+	}
+	cb.mu.Lock()
+	from := cb.state
+	switch {
+	case err == nil:
+		cb.failures = 0
+		if cb.state == CircuitHalfOpen {
+			cb.state = CircuitClosed
+			cb.probing = false
+		}
+	case cb.isFailure(err):
+		cb.failures++
+		if cb.state == CircuitHalfOpen || (cb.state == CircuitClosed && cb.failures >= cb.cfg.FailureThreshold) {
+			cb.state = CircuitOpen
+			cb.openedAt = time.Now()
+			cb.probing = false
+		}
+	}
+	to := cb.state
+	cb.mu.Unlock()
+	if from != to {
+		cb.transition(from, to)
+	}
+}
+
+// releaseProbe 探测批次未得出结论（如 ctx 取消）时归还探测名额
+func (cb *circuitBreaker) releaseProbe() {
+	cb.mu.Lock()
+	if cb.state == CircuitHalfOpen {
+		cb.probing = false
+	}
+	cb.mu.Unlock()
+}
+
+// rejecting 是否处于拒绝新尝试的状态（用于中止重试）
+func (cb *circuitBreaker) rejecting() bool {
+	if cb == nil {
+		return false
+	}
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state == CircuitOpen
+}
+
+// currentState 返回当前状态
+func (cb *circuitBreaker) currentState() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	return cb.state
+}
+
+func (cb *circuitBreaker) isFailure(err error) bool {
+	if cb.cfg.IsFailure != nil {
+		return cb.cfg.IsFailure(err)
+	}
+	if errors.Is(err, ErrAttemptTimeout) {
+		return true
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+func (cb *circuitBreaker) transition(from, to CircuitState) {
+	if cb.onTransition != nil {
+		cb.onTransition(cb.key, from, to)
+	}
+}
+
+// circuitBreakers 熔断器集合（全局或按表懒创建）
+type circuitBreakers struct {
+	cfg          CircuitBreakerConfig
+	onTransition func(key string, from, to CircuitState)
+	mu           sync.Mutex
+	breakers     map[string]*circuitBreaker
+}
+
+func newCircuitBreakers(cfg CircuitBreakerConfig, onTransition func(key string, from, to CircuitState)) *circuitBreakers {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 10 * time.Second
+	}
+	return &circuitBreakers{
+		cfg:          cfg,
+		onTransition: onTransition,
+		breakers:     make(map[string]*circuitBreaker),
+	}
+}
+
+// get 返回表对应的熔断器（未按表熔断时返回全局熔断器）
+func (cs *circuitBreakers) get(table string) *circuitBreaker {
+	if cs == nil {
+		return nil
+	}
+	key := globalCircuitKey
+	if cs.cfg.PerSchema {
+		key = table
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cb, ok := cs.breakers[key]
+	if !ok {
+		cb = &circuitBreaker{key: key, cfg: cs.cfg, onTransition: cs.onTransition}
+		cs.breakers[key] = cb
+	}
+	return cb
+}
+
+// states 返回所有熔断器的状态快照
+func (cs *circuitBreakers) states() map[string]CircuitState {
+	out := make(map[string]CircuitState)
+	if cs == nil {
+		return out
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for key, cb := range cs.breakers {
+		out[key] = cb.currentState()
+	}
+	return out
+}
@@ -0,0 +1,335 @@
+package batchsql
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"time"
+)
+
+// 请求二进制编码（WAL 与落盘队列共用）
+//
+// 布局：schema（表名、冲突策略、列、冲突键列）+ 列值（按 schema 列下标，仅编码已设置的列）
+// 值以 1 字节类型标记开头，支持 Request 类型化 Set 方法涉及的类型及常见整数类型
+
+const (
+	valueNil byte = iota
+	valueInt64
+	valueInt32
+	valueInt
+	valueFloat64
+	valueFloat32
+	valueString
+	valueBool
+	valueTime
+	valueBytes
+	valueUint64
+	valueUint32
+	valueUint
+	valueInt16
+	valueInt8
+	valueUint16
+	valueUint8
+)
+
+// 落盘记录帧：4 字节负载长度 + 4 字节 CRC32（负载）+ 负载
+const frameHeaderSize = 8
+
+// appendFrame 将负载以记录帧格式追加到 dst
+func appendFrame(dst, payload []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(payload)))
+	dst = binary.LittleEndian.AppendUint32(dst, crc32.ChecksumIEEE(payload))
+	return append(dst, payload...)
+}
+
+// nextFrame 读取 off 处的记录帧；不完整或校验失败（崩溃时写到一半）时 ok 为 false
+func nextFrame(data []byte, off int) (payload []byte, next int, ok bool) {
+	if off+frameHeaderSize > len(data) {
+		return nil, off, false
+	}
+	n := int(binary.LittleEndian.Uint32(data[off:]))
+	sum := binary.LittleEndian.Uint32(data[off+4:])
+	if n == 0 || n > len(data)-off-frameHeaderSize {
+		return nil, off, false
+	}
+	payload = data[off+frameHeaderSize : off+frameHeaderSize+n]
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, off, false
+	}
+	return payload, off + frameHeaderSize + n, true
+}
+
+// errCorruptRecord 记录内容无法解码
+var errCorruptRecord = errors.New("batchsql: corrupt encoded request")
+
+// appendRequest 将请求编码追加到 dst；存在不支持的值类型时返回 ErrInvalidColumnType
+func appendRequest(dst []byte, r *Request) ([]byte, error) {
+	dst = appendSchema(dst, r.schema)
+
+	var n uint64
+	for _, col := range r.schema.Columns {
+		if _, ok := r.columns[col]; ok {
+			n++
+		}
+	}
+	dst = binary.AppendUvarint(dst, n)
+	for i, col := range r.schema.Columns {
+		v, ok := r.columns[col]
+		if !ok {
+			continue
+		}
+		dst = binary.AppendUvarint(dst, uint64(i))
+		var err error
+		if dst, err = appendValue(dst, v); err != nil {
+			return nil, fmt.Errorf("%w: column %s has unsupported type %T", ErrInvalidColumnType, col, v)
+		}
+	}
+	return dst, nil
+}
+
+func appendSchema(dst []byte, s *Schema) []byte {
+	dst = appendString(dst, s.Name)
+	dst = append(dst, byte(s.ConflictStrategy))
+	dst = binary.AppendUvarint(dst, uint64(len(s.Columns)))
+	for _, c := range s.Columns {
+		dst = appendString(dst, c)
+	}
+	dst = binary.AppendUvarint(dst, uint64(len(s.ConflictColumns)))
+	for _, c := range s.ConflictColumns {
+		dst = appendString(dst, c)
+	}
+	return dst
+}
+
+func appendString(dst []byte, s string) []byte {
+	dst = binary.AppendUvarint(dst, uint64(len(s)))
+	return append(dst, s...)
+}
+
+func appendValue(dst []byte, v any) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(dst, valueNil), nil
+	case int64:
+		return binary.AppendVarint(append(dst, valueInt64), x), nil
+	case int32:
+		return binary.AppendVarint(append(dst, valueInt32), int64(x)), nil
+	case int:
+		return binary.AppendVarint(append(dst, valueInt), int64(x)), nil
+	case int16:
+		return binary.AppendVarint(append(dst, valueInt16), int64(x)), nil
+	case int8:
+		return binary.AppendVarint(append(dst, valueInt8), int64(x)), nil
+	case uint64:
+		return binary.AppendUvarint(append(dst, valueUint64), x), nil
+	case uint32:
+		return binary.AppendUvarint(append(dst, valueUint32), uint64(x)), nil
+	case uint:
+		return binary.AppendUvarint(append(dst, valueUint), uint64(x)), nil
+	case uint16:
+		return binary.AppendUvarint(append(dst, valueUint16), uint64(x)), nil
+	case uint8:
+		return binary.AppendUvarint(append(dst, valueUint8), uint64(x)), nil
+	case float64:
+		return binary.LittleEndian.AppendUint64(append(dst, valueFloat64), math.Float64bits(x)), nil
+	case float32:
+		return binary.LittleEndian.AppendUint32(append(dst, valueFloat32), math.Float32bits(x)), nil
+	case string:
+		return appendString(append(dst, valueString), x), nil
+	case bool:
+		b := byte(0)
+		if x {
+			b = 1
+		}
+		return append(dst, valueBool, b), nil
+	case time.Time:
+		raw, err := x.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return append(binary.AppendUvarint(append(dst, valueTime), uint64(len(raw))), raw...), nil
+	case []byte:
+		if x == nil {
+			return append(dst, valueNil), nil
+		}
+		return append(binary.AppendUvarint(append(dst, valueBytes), uint64(len(x))), x...), nil
+	default:
+		return nil, ErrInvalidColumnType
+	}
+}
+
+// schemaCache 解码时复用相同 schema 的指针（flush 按 *Schema 分组）
+type schemaCache map[string]*Schema
+
+// decodeRequest 解码 appendRequest 的输出
+func decodeRequest(data []byte, schemas schemaCache) (*Request, error) {
+	d := decoder{buf: data}
+	schemaStart := d.off
+	name := d.string()
+	strategy := d.byte()
+	columns := make([]string, d.count())
+	for i := range columns {
+		columns[i] = d.string()
+	}
+	var conflict []string
+	if n := d.count(); n > 0 {
+		conflict = make([]string, n)
+		for i := range conflict {
+			conflict[i] = d.string()
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	key := string(data[schemaStart:d.off])
+	schema, ok := schemas[key]
+	if !ok {
+		schema = NewSchema(name, ConflictStrategy(strategy), columns...)
+		schema.ConflictColumns = conflict
+		schemas[key] = schema
+	}
+
+	r := NewRequest(schema)
+	n := d.count()
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		idx := d.uvarint()
+		v := d.value()
+		if d.err == nil && idx >= uint64(len(schema.Columns)) {
+			d.err = errCorruptRecord
+		}
+		if d.err == nil {
+			r.columns[schema.Columns[idx]] = v
+		}
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return r, nil
+}
+
+// decoder 顺序读取器；首个错误后所有读取返回零值
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) fail() { d.err = errCorruptRecord }
+
+func (d *decoder) byte() byte {
+	if d.err != nil || d.off >= len(d.buf) {
+		d.fail()
+		return 0
+	}
+	b := d.buf[d.off]
+	d.off++
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.off:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.off:])
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+// count 读取元素个数；每个元素至少占 1 字节，超过剩余长度视为损坏（避免按损坏长度分配内存）
+func (d *decoder) count() uint64 {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)-d.off) {
+		d.fail()
+		return 0
+	}
+	return n
+}
+
+func (d *decoder) bytes(n uint64) []byte {
+	if d.err != nil || n > uint64(len(d.buf)-d.off) {
+		d.fail()
+		return nil
+	}
+	b := d.buf[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b
+}
+
+func (d *decoder) string() string { return string(d.bytes(d.uvarint())) }
+
+func (d *decoder) value() any {
+	switch tag := d.byte(); tag {
+	case valueNil:
+		return nil
+	case valueInt64:
+		return d.varint()
+	case valueInt32:
+		return int32(d.varint())
+	case valueInt:
+		return int(d.varint())
+	case valueInt16:
+		return int16(d.varint())
+	case valueInt8:
+		return int8(d.varint())
+	case valueUint64:
+		return d.uvarint()
+	case valueUint32:
+		return uint32(d.uvarint())
+	case valueUint:
+		return uint(d.uvarint())
+	case valueUint16:
+		return uint16(d.uvarint())
+	case valueUint8:
+		return uint8(d.uvarint())
+	case valueFloat64:
+		if b := d.bytes(8); d.err == nil {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return nil
+	case valueFloat32:
+		if b := d.bytes(4); d.err == nil {
+			return math.Float32frombits(binary.LittleEndian.Uint32(b))
+		}
+		return nil
+	case valueString:
+		return d.string()
+	case valueBool:
+		return d.byte() == 1
+	case valueTime:
+		var t time.Time
+		if raw := d.bytes(d.uvarint()); d.err == nil {
+			if err := t.UnmarshalBinary(raw); err != nil {
+				d.fail()
+			}
+		}
+		return t
+	case valueBytes:
+		if b := d.bytes(d.uvarint()); d.err == nil {
+			return append(make([]byte, 0, len(b)), b...)
+		}
+		return nil
+	default:
+		d.fail()
+		return nil
+	}
+}
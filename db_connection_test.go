@@ -150,8 +150,8 @@ func TestDBConnection_ConnectionFailure(t *testing.T) {
 		if err == nil {
 			t.Error("Expected connection error, but got nil")
 		}
-		if err.Error() != "connection refused" {
-			t.Errorf("Expected 'connection refused', got: %v", err)
+		if err.Error() != "batchsql: table test_table: connection refused" {
+			t.Errorf("Expected 'batchsql: table test_table: connection refused', got: %v", err)
 		}
 	case <-time.After(2 * time.Second):
 		t.Error("Expected connection error but timeout occurred")
@@ -303,8 +303,8 @@ func TestDBConnection_TransactionFailure(t *testing.T) {
 		case err := <-errorChan:
 			if err != nil {
 				errorCount++
-				if err.Error() != "transaction deadlock" {
-					t.Errorf("Expected 'transaction deadlock', got: %v", err)
+				if err.Error() != "batchsql: table test_table: transaction deadlock" {
+					t.Errorf("Expected 'batchsql: table test_table: transaction deadlock', got: %v", err)
 				}
 			}
 		case <-timeout:
@@ -394,8 +394,8 @@ func TestDBConnection_MaxConnectionsExceeded(t *testing.T) {
 		case err := <-errorChan:
 			if err != nil {
 				errorCount++
-				if err.Error() != "too many connections" {
-					t.Errorf("Expected 'too many connections', got: %v", err)
+				if err.Error() != "batchsql: table test_table: too many connections" {
+					t.Errorf("Expected 'batchsql: table test_table: too many connections', got: %v", err)
 				}
 			}
 		case <-timeout:
@@ -0,0 +1,127 @@
+package batchsql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DedupPolicy 批内同冲突键多行的折叠策略
+type DedupPolicy uint8
+
+const (
+	// DedupKeepLast 保留最后一次提交的行（默认，符合 upsert 的 last-write-wins 语义）
+	DedupKeepLast DedupPolicy = iota
+	// DedupKeepFirst 保留第一次提交的行（与 ConflictIgnore 语义一致）
+	DedupKeepFirst
+	// DedupMerge 通过 DedupConfig.Merge 合并
+	DedupMerge
+)
+
+// DedupConfig 批内去重配置（零值=关闭）
+/*
+背景：
+- PostgreSQL 同一条 INSERT ... ON CONFLICT DO UPDATE 中同一键出现两次会报错
+  “ON CONFLICT DO UPDATE command cannot affect row a second time”
+- MySQL 的结果依赖行顺序
+开启后在 GenerateInsertSQL 之前按 Schema.ConflictKeyColumns() 折叠同键行。
+*/
+type DedupConfig struct {
+	Enabled bool
+	Policy  DedupPolicy
+	// Merge 合并同键两行（DedupMerge 必填）：existing 为已保留行，incoming 为后到行，返回合并结果
+	Merge func(schema *Schema, existing, incoming map[string]any) map[string]any
+}
+
+// apply 按冲突键折叠数据，返回折叠后的数据与被折叠的行数
+// 保留行位于该键首次出现的位置，保证其余行的相对顺序不变；
+// 键中任一列为 NULL（或缺失）的行原样保留：SQL 中 NULL 键互不冲突
+func (c DedupConfig) apply(schema *Schema, data []map[string]any) ([]map[string]any, int) {
+	if !c.Enabled || len(data) < 2 {
+		return data, 0
+	}
+	keyColumns := schema.ConflictKeyColumns()
+	if len(keyColumns) == 0 {
+		return data, 0
+	}
+
+	index := make(map[string]int, len(data))
+	out := make([]map[string]any, 0, len(data))
+	var sb strings.Builder
+	for _, row := range data {
+		sb.Reset()
+		if !writeDedupKey(&sb, row, keyColumns) {
+			out = append(out, row)
+			continue
+		}
+		key := sb.String()
+
+		pos, ok := index[key]
+		if !ok {
+			index[key] = len(out)
+			out = append(out, row)
+			continue
+		}
+		switch c.Policy {
+		case DedupKeepFirst:
+		case DedupMerge:
+			if c.Merge != nil {
+				out[pos] = c.Merge(schema, out[pos], row)
+			} else {
+				out[pos] = row
+			}
+		default:
+			out[pos] = row
+		}
+	}
+	return out, len(data) - len(out)
+}
+
+// writeDedupKey 按列编码复合键；任一列为 NULL（或缺失）时返回 false（SQL 中 NULL 键互不冲突）
+func writeDedupKey(sb *strings.Builder, row map[string]any, keyColumns []string) bool {
+	for i, col := range keyColumns {
+		v := row[col]
+		if v == nil {
+			return false
+		}
+		if i > 0 {
+			sb.WriteByte(0x1f)
+		}
+		writeDedupKeyPart(sb, v)
+	}
+	return true
+}
+
+// writeDedupKeyPart 将单个键值编码为字符串（常见类型走快速路径，带类型前缀避免 1 与 "1" 冲突）
+// 变长值带长度前缀，值中含分隔符时也不会与其他复合键混淆
+func writeDedupKeyPart(sb *strings.Builder, v any) {
+	switch x := v.(type) {
+	case string:
+		writeLengthPrefixed(sb, "s", x)
+	case int:
+		sb.WriteString("i:")
+		sb.WriteString(strconv.FormatInt(int64(x), 10))
+	case int32:
+		sb.WriteString("i:")
+		sb.WriteString(strconv.FormatInt(int64(x), 10))
+	case int64:
+		sb.WriteString("i:")
+		sb.WriteString(strconv.FormatInt(x, 10))
+	case []byte:
+		writeLengthPrefixed(sb, "b", string(x))
+	case time.Time:
+		sb.WriteString("t:")
+		sb.WriteString(strconv.FormatInt(x.UnixNano(), 10))
+	default:
+		writeLengthPrefixed(sb, fmt.Sprintf("%T", v), fmt.Sprint(v))
+	}
+}
+
+// writeLengthPrefixed 写入 <类型><长度>:<值>
+func writeLengthPrefixed(sb *strings.Builder, kind, s string) {
+	sb.WriteString(kind)
+	sb.WriteString(strconv.Itoa(len(s)))
+	sb.WriteByte(':')
+	sb.WriteString(s)
+}
@@ -15,6 +15,8 @@ type SQLDriver interface {
 
 var _ SQLDriver = (*MySQLDriver)(nil)
 
+var _ IdempotencyDriver = (*MySQLDriver)(nil)
+
 var DefaultMySQLDriver = NewMySQLDriver()
 
 type MySQLDriver struct {
@@ -90,8 +92,15 @@ func (d *MySQLDriver) generatePlaceholders(columnCount, batchSize int) string {
 	return out
 }
 
+// GenerateMarkSQL 生成去重表插入语句（IdempotencyDriver）
+func (d *MySQLDriver) GenerateMarkSQL(table string) string {
+	return fmt.Sprintf("INSERT IGNORE INTO %s (batch_id) VALUES (?)", table)
+}
+
 var _ SQLDriver = (*PostgreSQLDriver)(nil)
 
+var _ IdempotencyDriver = (*PostgreSQLDriver)(nil)
+
 var DefaultPostgreSQLDriver = NewPostgreSQLDriver()
 
 type PostgreSQLDriver struct {
@@ -139,8 +148,8 @@ func (d *PostgreSQLDriver) GenerateInsertSQL(ctx context.Context, schema *Schema
 		for i, col := range columns {
 			updatePairs[i] = fmt.Sprintf("%s = EXCLUDED.%s", col, col)
 		}
-		// 假设第一个列是主键
-		sql := fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", baseSQL, columns[0], strings.Join(updatePairs, ", "))
+		// 冲突目标：schema 声明的冲突键列（未声明时默认第一列）
+		sql := fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", baseSQL, strings.Join(schema.ConflictKeyColumns(), ", "), strings.Join(updatePairs, ", "))
 		return sql, args, nil
 	default:
 		return baseSQL, args, nil
@@ -168,8 +177,15 @@ func (d *PostgreSQLDriver) generatePlaceholders(columnCount, batchSize int) stri
 	return out
 }
 
+// GenerateMarkSQL 生成去重表插入语句（IdempotencyDriver）
+func (d *PostgreSQLDriver) GenerateMarkSQL(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (batch_id) VALUES ($1) ON CONFLICT DO NOTHING", table)
+}
+
 var _ SQLDriver = (*SQLiteDriver)(nil)
 
+var _ IdempotencyDriver = (*SQLiteDriver)(nil)
+
 var DefaultSQLiteDriver = NewSQLiteDriver()
 
 type SQLiteDriver struct {
@@ -245,8 +261,15 @@ func (d *SQLiteDriver) generatePlaceholders(columnCount, batchSize int) string {
 	return out
 }
 
+// GenerateMarkSQL 生成去重表插入语句（IdempotencyDriver）
+func (d *SQLiteDriver) GenerateMarkSQL(table string) string {
+	return fmt.Sprintf("INSERT OR IGNORE INTO %s (batch_id) VALUES (?)", table)
+}
+
 var _ SQLDriver = (*MockDriver)(nil)
 
+var _ IdempotencyDriver = (*MockDriver)(nil)
+
 type MockDriver struct {
 	databaseType string
 }
@@ -326,7 +349,7 @@ func (d *MockDriver) generatePostgreSQLSQL(schema *Schema, baseSQL, _, _ string,
 		for i, col := range schema.Columns {
 			updatePairs[i] = fmt.Sprintf("%s = EXCLUDED.%s", col, col)
 		}
-		sql := fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", baseSQL, schema.Columns[0], strings.Join(updatePairs, ", "))
+		sql := fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", baseSQL, strings.Join(schema.ConflictKeyColumns(), ", "), strings.Join(updatePairs, ", "))
 		return sql, args, nil
 	default:
 		return baseSQL, args, nil
@@ -362,6 +385,18 @@ func (d *MockDriver) generatePlaceholders(columnCount, batchSize int) string {
 	return strings.Join(rows, ", ")
 }
 
+// GenerateMarkSQL 按数据库类型生成去重表插入语句（IdempotencyDriver；默认 MySQL 语法）
+func (d *MockDriver) GenerateMarkSQL(table string) string {
+	switch d.databaseType {
+	case "postgresql":
+		return DefaultPostgreSQLDriver.GenerateMarkSQL(table)
+	case "sqlite":
+		return DefaultSQLiteDriver.GenerateMarkSQL(table)
+	default:
+		return DefaultMySQLDriver.GenerateMarkSQL(table)
+	}
+}
+
 type RedisCmd []any
 
 type RedisDriver interface {
@@ -1,6 +1,9 @@
 package batchsql
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	// ErrEmptyRequest 空请求错误
@@ -23,4 +26,34 @@ var (
 
 	// ErrEmptySchemaName 空表名错误
 	ErrEmptySchemaName = errors.New("empty schema name")
+
+	// ErrCircuitOpen 熔断器打开（或半开探测中），批次被快速拒绝
+	ErrCircuitOpen = errors.New("circuit breaker is open")
+
+	// ErrAttemptTimeout 单次执行尝试超时（RetryConfig.AttemptTimeout），可重试
+	ErrAttemptTimeout = errors.New("batch attempt timed out")
+
+	// ErrQueueFull 缓冲区已满，请求被丢弃（TrySubmit 或非阻塞溢出策略）
+	ErrQueueFull = errors.New("queue is full")
+
+	// ErrMemoryBudgetExceeded 已缓冲请求的估算字节数超出内存预算（MemoryConfig.MaxBufferedBytes）
+	ErrMemoryBudgetExceeded = errors.New("buffered bytes exceed memory budget")
+
+	// ErrWALClosed 预写日志已关闭（BatchSQL 生命周期结束）
+	ErrWALClosed = errors.New("write-ahead log is closed")
+
+	// ErrBatchPanicked 批次执行中发生 panic（顺序模式下由调度器恢复并转为错误）
+	ErrBatchPanicked = errors.New("batch execution panicked")
 )
+
+// SchemaError 标识批次中失败的表（flush 内各 schema 组独立执行时使用）
+// Error() 带表名前缀，errors.Join 汇总后的日志也能区分失败的表；
+// 可通过 errors.As 取得 Table，通过 errors.Is/Unwrap 判断原始错误
+type SchemaError struct {
+	Table string
+	Err   error
+}
+
+func (e *SchemaError) Error() string { return fmt.Sprintf("batchsql: table %s: %v", e.Table, e.Err) }
+
+func (e *SchemaError) Unwrap() error { return e.Err }
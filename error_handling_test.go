@@ -66,8 +66,8 @@ func TestErrorHandling_ExecutionError(t *testing.T) {
 		if err == nil {
 			t.Error("Expected error from execution, but got nil")
 		}
-		if err.Error() != "Database connection failed" {
-			t.Errorf("Expected 'Database connection failed', got: %v", err)
+		if err.Error() != "batchsql: table test_table: Database connection failed" {
+			t.Errorf("Expected 'batchsql: table test_table: Database connection failed', got: %v", err)
 		}
 	case <-time.After(2 * time.Second):
 		t.Error("Expected error but timeout occurred")
@@ -204,8 +204,17 @@ func TestErrorHandling_MultipleErrors(t *testing.T) {
 		if err == nil {
 			t.Error("Expected error from multiple executions, but got nil")
 		}
-		if err.Error() != "Multiple execution failed" {
-			t.Errorf("Expected 'Multiple execution failed', got: %v", err)
+		// 同一批次内多个表的失败会以 errors.Join 汇总，逐个校验表名前缀与原始错误文本
+		errs := []error{err}
+		var joined interface{ Unwrap() []error }
+		if errors.As(err, &joined) {
+			errs = joined.Unwrap()
+		}
+		for _, e := range errs {
+			var se *batchsql.SchemaError
+			if !errors.As(e, &se) || e.Error() != "batchsql: table "+se.Table+": Multiple execution failed" {
+				t.Errorf("Expected 'batchsql: table <name>: Multiple execution failed', got: %v", e)
+			}
 		}
 	case <-time.After(2 * time.Second):
 		t.Error("Expected error but timeout occurred")
@@ -0,0 +1,319 @@
+package otelmetrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/rushairer/batchsql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName OTel instrumentation scope 名称
+const instrumentationName = "github.com/rushairer/batchsql"
+
+// Options 配置项（均可选）
+type Options struct {
+	MeterProvider  metric.MeterProvider // 默认 otel.GetMeterProvider()
+	TracerProvider trace.TracerProvider // 默认 otel.GetTracerProvider()
+
+	// Database 绑定到所有指标与 span 的 db.system 维度（如 "mysql"）
+	Database string
+	// IncludeTable 是否在指标上启用 table 维度（注意基数膨胀；span 上始终记录）
+	IncludeTable bool
+}
+
+// Reporter 实现 batchsql.MetricsReporter（OTel 指标）与 batchsql.TracingMetricsReporter（OTel span）
+//
+// span 结构：
+//
+//	batchsql.submit（父 span 为 Submit 传入 ctx 中的 span）
+//	batchsql.batch（link -> 批内各请求的 batchsql.submit）
+//	├── batchsql.assemble
+//	└── batchsql.execute
+//	    ├── batchsql.attempt (attempt=1)
+//	    └── batchsql.attempt (attempt=2，重试)
+type Reporter struct {
+	tracer       trace.Tracer
+	baseAttrs    []attribute.KeyValue
+	includeTable bool
+
+	enqueue     metric.Float64Histogram
+	assemble    metric.Float64Histogram
+	execute     metric.Float64Histogram
+	batchSize   metric.Int64Histogram
+	errors      metric.Int64Counter
+	concurrency metric.Int64Gauge
+	queueLength metric.Int64Gauge
+	inflight    metric.Int64UpDownCounter
+	dedup       metric.Int64Counter
+	circuit     metric.Int64Counter
+
+	rows          metric.Int64Counter
+	rejected      metric.Int64Counter
+	retryAttempts metric.Int64Histogram
+	payloadBytes  metric.Int64Histogram
+	tableAssemble metric.Float64Histogram
+
+	spoolBatches metric.Int64Gauge
+	spoolBytes   metric.Int64Gauge
+	spillEvents  metric.Int64Counter
+
+	flushSize metric.Int64Gauge
+}
+
+var (
+	_ batchsql.MetricsReporter               = (*Reporter)(nil)
+	_ batchsql.TracingMetricsReporter        = (*Reporter)(nil)
+	_ batchsql.DedupMetricsReporter          = (*Reporter)(nil)
+	_ batchsql.CircuitBreakerMetricsReporter = (*Reporter)(nil)
+	_ batchsql.ExtendedMetricsReporter       = (*Reporter)(nil)
+	_ batchsql.SpillMetricsReporter          = (*Reporter)(nil)
+	_ batchsql.AutoTuneMetricsReporter       = (*Reporter)(nil)
+)
+
+// NewReporter 创建 Reporter 并注册 OTel 指标
+func NewReporter(opts Options) (*Reporter, error) {
+	mp := opts.MeterProvider
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	tp := opts.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	meter := mp.Meter(instrumentationName)
+
+	r := &Reporter{
+		tracer:       tp.Tracer(instrumentationName),
+		includeTable: opts.IncludeTable,
+	}
+	if opts.Database != "" {
+		r.baseAttrs = append(r.baseAttrs, attribute.String("db.system", opts.Database))
+	}
+
+	var err error
+	if r.enqueue, err = meter.Float64Histogram("batchsql.enqueue.duration",
+		metric.WithUnit("s"), metric.WithDescription("Submit 到入队的延迟")); err != nil {
+		return nil, err
+	}
+	if r.assemble, err = meter.Float64Histogram("batchsql.assemble.duration",
+		metric.WithUnit("s"), metric.WithDescription("攒批/组装耗时")); err != nil {
+		return nil, err
+	}
+	if r.execute, err = meter.Float64Histogram("batchsql.execute.duration",
+		metric.WithUnit("s"), metric.WithDescription("批次执行耗时（含重试与退避）")); err != nil {
+		return nil, err
+	}
+	if r.batchSize, err = meter.Int64Histogram("batchsql.batch.size",
+		metric.WithUnit("{row}"), metric.WithDescription("批大小")); err != nil {
+		return nil, err
+	}
+	if r.errors, err = meter.Int64Counter("batchsql.errors",
+		metric.WithUnit("{error}"), metric.WithDescription("错误计数（type 区分 retry:/final: 等）")); err != nil {
+		return nil, err
+	}
+	if r.concurrency, err = meter.Int64Gauge("batchsql.executor.concurrency",
+		metric.WithDescription("执行器并发上限（0 表示不限流）")); err != nil {
+		return nil, err
+	}
+	if r.queueLength, err = meter.Int64Gauge("batchsql.queue.length",
+		metric.WithDescription("管道队列长度（近似）")); err != nil {
+		return nil, err
+	}
+	if r.inflight, err = meter.Int64UpDownCounter("batchsql.executor.inflight",
+		metric.WithUnit("{batch}"), metric.WithDescription("在途批次数")); err != nil {
+		return nil, err
+	}
+	if r.dedup, err = meter.Int64Counter("batchsql.dedup.collapsed",
+		metric.WithUnit("{row}"), metric.WithDescription("批内去重折叠的行数")); err != nil {
+		return nil, err
+	}
+	if r.circuit, err = meter.Int64Counter("batchsql.circuit.transitions",
+		metric.WithDescription("熔断器状态变迁次数")); err != nil {
+		return nil, err
+	}
+	if r.rows, err = meter.Int64Counter("batchsql.rows",
+		metric.WithUnit("{row}"), metric.WithDescription("处理行数（status 区分 success/fail）")); err != nil {
+		return nil, err
+	}
+	if r.rejected, err = meter.Int64Counter("batchsql.submit.rejected",
+		metric.WithUnit("{request}"), metric.WithDescription("Submit 被拒绝的请求数")); err != nil {
+		return nil, err
+	}
+	if r.retryAttempts, err = meter.Int64Histogram("batchsql.retry.attempts",
+		metric.WithUnit("{attempt}"), metric.WithDescription("批次使用的尝试次数（含首轮）")); err != nil {
+		return nil, err
+	}
+	if r.payloadBytes, err = meter.Int64Histogram("batchsql.batch.payload",
+		metric.WithUnit("By"), metric.WithDescription("批次负载估算字节数")); err != nil {
+		return nil, err
+	}
+	if r.tableAssemble, err = meter.Float64Histogram("batchsql.table.assemble.duration",
+		metric.WithUnit("s"), metric.WithDescription("按表组装耗时")); err != nil {
+		return nil, err
+	}
+	if r.spoolBatches, err = meter.Int64Gauge("batchsql.spill.depth",
+		metric.WithUnit("{batch}"), metric.WithDescription("落盘队列中的批次数")); err != nil {
+		return nil, err
+	}
+	if r.spoolBytes, err = meter.Int64Gauge("batchsql.spill.bytes",
+		metric.WithUnit("By"), metric.WithDescription("落盘队列占用字节数")); err != nil {
+		return nil, err
+	}
+	if r.spillEvents, err = meter.Int64Counter("batchsql.spill.events",
+		metric.WithDescription("落盘事件计数（event 区分 spilled/replayed/dead 等）")); err != nil {
+		return nil, err
+	}
+	if r.flushSize, err = meter.Int64Gauge("batchsql.flush.size",
+		metric.WithUnit("{row}"), metric.WithDescription("自动调优后的 FlushSize")); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// attrs 组合基础维度与可选 table 维度
+func (r *Reporter) attrs(table string, extra ...attribute.KeyValue) metric.MeasurementOption {
+	kvs := make([]attribute.KeyValue, 0, len(r.baseAttrs)+len(extra)+1)
+	kvs = append(kvs, r.baseAttrs...)
+	if r.includeTable && table != "" {
+		kvs = append(kvs, attribute.String("table", table))
+	}
+	kvs = append(kvs, extra...)
+	return metric.WithAttributes(kvs...)
+}
+
+// ObserveEnqueueLatency 提交到入队延迟
+func (r *Reporter) ObserveEnqueueLatency(d time.Duration) {
+	r.enqueue.Record(context.Background(), d.Seconds(), r.attrs(""))
+}
+
+// ObserveBatchAssemble 攒批耗时
+func (r *Reporter) ObserveBatchAssemble(d time.Duration) {
+	r.assemble.Record(context.Background(), d.Seconds(), r.attrs(""))
+}
+
+// ObserveExecuteDuration 执行耗时（含重试与退避）
+func (r *Reporter) ObserveExecuteDuration(table string, n int, d time.Duration, status string) {
+	r.execute.Record(context.Background(), d.Seconds(), r.attrs(table, attribute.String("status", status)))
+}
+
+// ObserveBatchSize 批大小
+func (r *Reporter) ObserveBatchSize(n int) {
+	r.batchSize.Record(context.Background(), int64(n), r.attrs(""))
+}
+
+// IncError 错误计数
+func (r *Reporter) IncError(table string, typ string) {
+	r.errors.Add(context.Background(), 1, r.attrs(table, attribute.String("type", typ)))
+}
+
+// SetConcurrency 并发上限
+func (r *Reporter) SetConcurrency(n int) {
+	r.concurrency.Record(context.Background(), int64(n), r.attrs(""))
+}
+
+// SetQueueLength 队列长度
+func (r *Reporter) SetQueueLength(n int) {
+	r.queueLength.Record(context.Background(), int64(n), r.attrs(""))
+}
+
+// IncInflight 在途批次 +1
+func (r *Reporter) IncInflight() { r.inflight.Add(context.Background(), 1, r.attrs("")) }
+
+// DecInflight 在途批次 -1
+func (r *Reporter) DecInflight() { r.inflight.Add(context.Background(), -1, r.attrs("")) }
+
+// ObserveDedupCollapsed 批内去重折叠行数
+func (r *Reporter) ObserveDedupCollapsed(table string, n int) {
+	r.dedup.Add(context.Background(), int64(n), r.attrs(table))
+}
+
+// ObserveCircuitTransition 熔断器状态变迁
+func (r *Reporter) ObserveCircuitTransition(key string, from, to batchsql.CircuitState) {
+	r.circuit.Add(context.Background(), 1, r.attrs("",
+		attribute.String("breaker", key),
+		attribute.String("from", from.String()),
+		attribute.String("to", to.String()),
+	))
+}
+
+// AddRows 处理行数
+func (r *Reporter) AddRows(table string, n int, status string) {
+	r.rows.Add(context.Background(), int64(n), r.attrs(table, attribute.String("status", status)))
+}
+
+// ObserveRetryAttempts 批次使用的尝试次数
+func (r *Reporter) ObserveRetryAttempts(table string, attempts int) {
+	r.retryAttempts.Record(context.Background(), int64(attempts), r.attrs(table))
+}
+
+// ObservePayloadBytes 批次负载字节数
+func (r *Reporter) ObservePayloadBytes(table string, bytes int) {
+	r.payloadBytes.Record(context.Background(), int64(bytes), r.attrs(table))
+}
+
+// ObserveTableAssemble 按表组装耗时（始终带 table 维度）
+func (r *Reporter) ObserveTableAssemble(table string, d time.Duration) {
+	kvs := append(append([]attribute.KeyValue{}, r.baseAttrs...), attribute.String("table", table))
+	r.tableAssemble.Record(context.Background(), d.Seconds(), metric.WithAttributes(kvs...))
+}
+
+// IncSubmitRejected Submit 被拒绝
+func (r *Reporter) IncSubmitRejected(reason string) {
+	r.rejected.Add(context.Background(), 1, r.attrs("", attribute.String("reason", reason)))
+}
+
+// SetSpoolDepth 落盘队列深度
+func (r *Reporter) SetSpoolDepth(batches int, bytes int64) {
+	r.spoolBatches.Record(context.Background(), int64(batches), r.attrs(""))
+	r.spoolBytes.Record(context.Background(), bytes, r.attrs(""))
+}
+
+// IncSpillEvent 落盘事件
+func (r *Reporter) IncSpillEvent(table string, event string) {
+	r.spillEvents.Add(context.Background(), 1, r.attrs(table, attribute.String("event", event)))
+}
+
+// SetFlushSize 自动调优后的 FlushSize
+func (r *Reporter) SetFlushSize(n int) {
+	r.flushSize.Record(context.Background(), int64(n), r.attrs(""))
+}
+
+// StartSpan 开始阶段 span；batch 阶段为批内各请求的 submit span 建立 link
+func (r *Reporter) StartSpan(ctx context.Context, info batchsql.SpanInfo) (context.Context, func(error)) {
+	kvs := make([]attribute.KeyValue, 0, len(r.baseAttrs)+3)
+	kvs = append(kvs, r.baseAttrs...)
+	kvs = append(kvs, attribute.String("db.collection.name", info.Table), attribute.Int("batchsql.rows", info.Rows))
+	if info.Attempt > 0 {
+		kvs = append(kvs, attribute.Int("batchsql.attempt", info.Attempt))
+	}
+	opts := []trace.SpanStartOption{trace.WithAttributes(kvs...)}
+	if info.Stage == batchsql.SpanSubmit {
+		opts = append(opts, trace.WithSpanKind(trace.SpanKindProducer))
+	}
+	if info.Stage == batchsql.SpanBatch {
+		opts = append(opts, trace.WithSpanKind(trace.SpanKindConsumer))
+	}
+	if len(info.Links) > 0 {
+		links := make([]trace.Link, 0, len(info.Links))
+		for _, lc := range info.Links {
+			if sc := trace.SpanContextFromContext(lc); sc.IsValid() {
+				links = append(links, trace.Link{SpanContext: sc})
+			}
+		}
+		opts = append(opts, trace.WithLinks(links...))
+	}
+
+	ctx, span := r.tracer.Start(ctx, "batchsql."+string(info.Stage), opts...)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
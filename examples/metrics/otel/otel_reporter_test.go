@@ -0,0 +1,134 @@
+package otelmetrics_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+	otelmetrics "github.com/rushairer/batchsql/examples/metrics/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// failOnceProcessor 首次执行返回可重试错误
+type failOnceProcessor struct{ calls atomic.Int32 }
+
+func (p *failOnceProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *failOnceProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	if p.calls.Add(1) == 1 {
+		return errors.New("deadlock found")
+	}
+	return nil
+}
+
+func TestReporter_SpansAndMetrics(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	reporter, err := otelmetrics.NewReporter(otelmetrics.Options{MeterProvider: mp, TracerProvider: tp, Database: "mysql"})
+	if err != nil {
+		t.Fatalf("new reporter: %v", err)
+	}
+
+	executor := batchsql.NewThrottledBatchExecutor(&failOnceProcessor{}).
+		WithMetricsReporter(reporter).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 2, BackoffBase: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQL(ctx, 10, 2, time.Second, executor)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+	// 两个请求分别来自不同的上游 trace
+	var parents []trace.SpanContext
+	for i := 0; i < 2; i++ {
+		reqCtx, parent := tp.Tracer("test").Start(context.Background(), "handler")
+		parents = append(parents, parent.SpanContext())
+		if err := batch.Submit(reqCtx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		parent.End()
+	}
+
+	byName := func() map[string][]tracetest.SpanStub {
+		out := make(map[string][]tracetest.SpanStub)
+		for _, s := range exporter.GetSpans() {
+			out[s.Name] = append(out[s.Name], s)
+		}
+		return out
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for len(byName()["batchsql.batch"]) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	spans := byName()
+
+	submits := spans["batchsql.submit"]
+	if len(submits) != 2 {
+		t.Fatalf("expected 2 submit spans, got %d", len(submits))
+	}
+	for i, s := range submits {
+		if s.Parent.SpanID() != parents[i].SpanID() {
+			t.Fatalf("submit span %d should be a child of the caller span", i)
+		}
+	}
+
+	batches := spans["batchsql.batch"]
+	if len(batches) != 1 {
+		t.Fatalf("expected 1 batch span, got %d", len(batches))
+	}
+	linked := make(map[trace.SpanID]bool)
+	for _, l := range batches[0].Links {
+		linked[l.SpanContext.SpanID()] = true
+	}
+	for _, s := range submits {
+		if !linked[s.SpanContext.SpanID()] {
+			t.Fatalf("batch span should link to submit span %s", s.SpanContext.SpanID())
+		}
+	}
+
+	batchID := batches[0].SpanContext.SpanID()
+	if a := spans["batchsql.assemble"]; len(a) != 1 || a[0].Parent.SpanID() != batchID {
+		t.Fatalf("assemble span should be a child of the batch span")
+	}
+	execs := spans["batchsql.execute"]
+	if len(execs) != 1 || execs[0].Parent.SpanID() != batchID {
+		t.Fatalf("execute span should be a child of the batch span")
+	}
+	attempts := spans["batchsql.attempt"]
+	if len(attempts) != 2 {
+		t.Fatalf("expected 2 attempt spans (1 retry), got %d", len(attempts))
+	}
+	for _, a := range attempts {
+		if a.Parent.SpanID() != execs[0].SpanContext.SpanID() {
+			t.Fatalf("attempt span should be a child of the execute span")
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	names := make(map[string]bool)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			names[m.Name] = true
+		}
+	}
+	for _, want := range []string{"batchsql.enqueue.duration", "batchsql.batch.size", "batchsql.execute.duration", "batchsql.errors", "batchsql.executor.inflight", "batchsql.rows", "batchsql.retry.attempts", "batchsql.batch.payload"} {
+		if !names[want] {
+			t.Fatalf("missing metric %s, got %v", want, names)
+		}
+	}
+}
@@ -28,6 +28,9 @@ type Options struct {
 	AssembleBuckets  []float64
 	ExecuteBuckets   []float64
 	BatchSizeBuckets []float64
+	// 扩展指标（batchsql.ExtendedMetricsReporter）
+	RetryAttemptBuckets []float64
+	PayloadBytesBuckets []float64
 }
 
 // Metrics 指标容器
@@ -48,6 +51,17 @@ type Metrics struct {
 	queueLength         *prometheus.GaugeVec
 	inflightBatches     *prometheus.GaugeVec
 
+	// 扩展指标（batchsql.ExtendedMetricsReporter）
+	rowsTotal             *prometheus.CounterVec
+	submitRejected        *prometheus.CounterVec
+	retryAttempts         *prometheus.HistogramVec
+	payloadBytes          *prometheus.HistogramVec
+	tableAssembleDuration *prometheus.HistogramVec
+
+	// 维度开关（扩展指标按此拼装标签值）
+	includeTestName bool
+	includeTable    bool
+
 	server *http.Server
 }
 
@@ -70,6 +84,12 @@ func NewMetrics(opts Options) *Metrics {
 	if len(opts.BatchSizeBuckets) == 0 {
 		opts.BatchSizeBuckets = prometheus.ExponentialBuckets(1, 2, 12)
 	}
+	if len(opts.RetryAttemptBuckets) == 0 {
+		opts.RetryAttemptBuckets = prometheus.LinearBuckets(1, 1, 8)
+	}
+	if len(opts.PayloadBytesBuckets) == 0 {
+		opts.PayloadBytesBuckets = prometheus.ExponentialBuckets(256, 4, 10) // 256B ~ 64MB
+	}
 
 	reg := prometheus.NewRegistry()
 
@@ -96,8 +116,31 @@ func NewMetrics(opts Options) *Metrics {
 		labelsExecute = append(labelsExecute, "table")
 	}
 
+	// 扩展指标标签：database,[extra...],[test_name],[table]；按表组装耗时始终带 table
+	extLabels := func(extra ...string) []string {
+		labels := append([]string{"database"}, extra...)
+		if opts.IncludeTestName {
+			labels = append(labels, "test_name")
+		}
+		if opts.IncludeTable {
+			labels = append(labels, "table")
+		}
+		return labels
+	}
+	labelsTableAssemble := []string{"database"}
+	if opts.IncludeTestName {
+		labelsTableAssemble = append(labelsTableAssemble, "test_name")
+	}
+	labelsTableAssemble = append(labelsTableAssemble, "table")
+	labelsRejected := []string{"database", "reason"}
+	if opts.IncludeTestName {
+		labelsRejected = append(labelsRejected, "test_name")
+	}
+
 	m := &Metrics{
-		registry: reg,
+		registry:        reg,
+		includeTestName: opts.IncludeTestName,
+		includeTable:    opts.IncludeTable,
 		totalErrors: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace:   ns,
@@ -182,6 +225,59 @@ func NewMetrics(opts Options) *Metrics {
 			},
 			labelsInflight,
 		),
+		rowsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   ns,
+				Subsystem:   ss,
+				Name:        "rows_total",
+				Help:        "Total number of rows processed, by final status (success/fail)",
+				ConstLabels: cl,
+			},
+			extLabels("status"),
+		),
+		submitRejected: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace:   ns,
+				Subsystem:   ss,
+				Name:        "submit_rejected_total",
+				Help:        "Total number of requests rejected by Submit (e.g. after close)",
+				ConstLabels: cl,
+			},
+			labelsRejected,
+		),
+		retryAttempts: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   ns,
+				Subsystem:   ss,
+				Name:        "retry_attempts",
+				Help:        "Attempts used per batch (including the first attempt)",
+				Buckets:     opts.RetryAttemptBuckets,
+				ConstLabels: cl,
+			},
+			extLabels(),
+		),
+		payloadBytes: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   ns,
+				Subsystem:   ss,
+				Name:        "batch_payload_bytes",
+				Help:        "Estimated payload size per batch in bytes",
+				Buckets:     opts.PayloadBytesBuckets,
+				ConstLabels: cl,
+			},
+			extLabels(),
+		),
+		tableAssembleDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace:   ns,
+				Subsystem:   ss,
+				Name:        "table_assemble_duration_seconds",
+				Help:        "Time to assemble a batch, per table",
+				Buckets:     opts.AssembleBuckets,
+				ConstLabels: cl,
+			},
+			labelsTableAssemble,
+		),
 	}
 
 	// 注册
@@ -194,6 +290,11 @@ func NewMetrics(opts Options) *Metrics {
 		m.executorConcurrency,
 		m.queueLength,
 		m.inflightBatches,
+		m.rowsTotal,
+		m.submitRejected,
+		m.retryAttempts,
+		m.payloadBytes,
+		m.tableAssembleDuration,
 	)
 
 	// 常规运行时指标（可选）
@@ -318,6 +419,46 @@ func (m *Metrics) decInflight(database, testName string) {
 	m.inflightBatches.WithLabelValues(labels...).Dec()
 }
 
+// extLabelValues 扩展指标标签值：database,[extra...],[test_name],[table]
+func (m *Metrics) extLabelValues(database, testName, table string, extra ...string) []string {
+	labels := append([]string{database}, extra...)
+	if m.includeTestName {
+		labels = append(labels, testName)
+	}
+	if m.includeTable {
+		labels = append(labels, table)
+	}
+	return labels
+}
+
+func (m *Metrics) addRows(database, testName, table string, n int, status string) {
+	m.rowsTotal.WithLabelValues(m.extLabelValues(database, testName, table, status)...).Add(float64(n))
+}
+
+func (m *Metrics) observeRetryAttempts(database, testName, table string, attempts int) {
+	m.retryAttempts.WithLabelValues(m.extLabelValues(database, testName, table)...).Observe(float64(attempts))
+}
+
+func (m *Metrics) observePayloadBytes(database, testName, table string, bytes int) {
+	m.payloadBytes.WithLabelValues(m.extLabelValues(database, testName, table)...).Observe(float64(bytes))
+}
+
+func (m *Metrics) observeTableAssemble(database, testName, table string, d time.Duration) {
+	labels := []string{database}
+	if m.includeTestName {
+		labels = append(labels, testName)
+	}
+	m.tableAssembleDuration.WithLabelValues(append(labels, table)...).Observe(d.Seconds())
+}
+
+func (m *Metrics) incSubmitRejected(database, testName, reason string) {
+	labels := []string{database, reason}
+	if m.includeTestName {
+		labels = append(labels, testName)
+	}
+	m.submitRejected.WithLabelValues(labels...).Inc()
+}
+
 func hasLabel(_ prometheus.Collector, _ string) bool {
 	// CounterVec/HistogramVec/GaugeVec 都实现了 Describe，可从 Desc 文本判断标签是否存在
 	// 这里用一个简化的静态判断套路：依赖我们构造时的选择，不做反射/解析，避免开销。
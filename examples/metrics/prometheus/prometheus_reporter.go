@@ -94,5 +94,47 @@ func (r *Reporter) DecInflight() {
 	r.m.decInflight(r.Database, r.TestName)
 }
 
+// AddRows 行数（按最终状态）
+func (r *Reporter) AddRows(table string, n int, status string) {
+	if r.m == nil {
+		return
+	}
+	r.m.addRows(r.Database, r.TestName, table, n, status)
+}
+
+// ObserveRetryAttempts 批次使用的尝试次数
+func (r *Reporter) ObserveRetryAttempts(table string, attempts int) {
+	if r.m == nil {
+		return
+	}
+	r.m.observeRetryAttempts(r.Database, r.TestName, table, attempts)
+}
+
+// ObservePayloadBytes 批次负载字节数
+func (r *Reporter) ObservePayloadBytes(table string, bytes int) {
+	if r.m == nil {
+		return
+	}
+	r.m.observePayloadBytes(r.Database, r.TestName, table, bytes)
+}
+
+// ObserveTableAssemble 按表组装耗时
+func (r *Reporter) ObserveTableAssemble(table string, d time.Duration) {
+	if r.m == nil {
+		return
+	}
+	r.m.observeTableAssemble(r.Database, r.TestName, table, d)
+}
+
+// IncSubmitRejected Submit 被拒绝
+func (r *Reporter) IncSubmitRejected(reason string) {
+	if r.m == nil {
+		return
+	}
+	r.m.incSubmitRejected(r.Database, r.TestName, reason)
+}
+
 // 确保实现接口
 var _ batchsql.MetricsReporter = (*Reporter)(nil)
+
+var _ batchsql.ExtendedMetricsReporter = (*Reporter)(nil)
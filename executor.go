@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"log/slog"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -59,16 +62,59 @@ var _ BatchExecutor = (*ThrottledBatchExecutor)(nil)
 // - 职责分离：执行控制与具体处理逻辑分离
 // - 易于扩展：新增SQL数据库只需实现SQLDriver接口
 type ThrottledBatchExecutor struct {
-	processor       BatchProcessor  // 具体的批量处理逻辑
-	metricsReporter MetricsReporter // 性能指标报告器
-	semaphore       chan struct{}   // 可选信号量，用于限制 ExecuteBatch 并发
+	processor       BatchProcessor   // 具体的批量处理逻辑
+	metricsReporter MetricsReporter  // 性能指标报告器
+	adaptive        *adaptiveLimiter // 可选自适应并发（AIMD），启用时优先于固定上限
 
-	// Step 2: 重试配置（默认关闭）
-	retryEnabled     bool
-	retryMaxAttempts int
-	retryBackoffBase time.Duration
-	retryMaxBackoff  time.Duration
-	retryClassifier  func(error) (retryable bool, reason string)
+	// 可选固定并发上限（WithConcurrencyLimit，可在运行时调整；nil 表示不限流）
+	concurrencyMu sync.Mutex
+	concurrency   atomic.Pointer[concurrencyLimiter]
+
+	// 可选限速：全局与按表（行/秒、字节/秒）
+	rateLimit        *rateLimiter
+	schemaRateMu     sync.RWMutex
+	schemaRateLimits map[string]*rateLimiter
+
+	// 可选熔断：全局或按表
+	breakers *circuitBreakers
+
+	// 可选拦截器链（包装整个 ExecuteBatch）与单次尝试钩子
+	chain BatchExecutor
+	hooks BatchHooks
+
+	// 可选结构化日志
+	logger      eventLogger
+	logSampling *LogSampling
+
+	// 内置统计计数器（Stats 快照）
+	stats statsCollector
+
+	// 可选落盘队列（EnableSpill）
+	spill *spillQueue
+
+	// Step 2: 重试配置（默认关闭；整体替换，可在运行时调整）
+	retry atomic.Pointer[retryPolicy]
+}
+
+// retryPolicy 一次 WithRetryConfig 生效的重试参数；批次开始时取快照，执行中不受后续调整影响
+type retryPolicy struct {
+	enabled        bool
+	maxAttempts    int
+	backoff        BackoffStrategy
+	budget         *retryBudget
+	attemptTimeout time.Duration
+	classifier     func(error) (retryable bool, reason string)
+}
+
+// noRetry 未配置重试时的默认策略
+var noRetry = &retryPolicy{maxAttempts: 1}
+
+// retryPolicy 返回当前重试策略
+func (e *ThrottledBatchExecutor) retryPolicy() *retryPolicy {
+	if p := e.retry.Load(); p != nil {
+		return p
+	}
+	return noRetry
 }
 
 // NewThrottledBatchExecutor 创建通用执行器（使用自定义BatchProcessor）
@@ -100,28 +146,37 @@ type RetryConfig struct {
 	MaxBackoff  time.Duration // 最大退避时长（上限）
 	// 自定义错误分类（可选）；返回是否可重试与原因标签
 	Classifier func(error) (retryable bool, reason string)
+	// 退避策略（可选）；未设置时使用 ExponentialBackoff{BackoffBase, MaxBackoff, Jitter: 0.2}
+	Backoff BackoffStrategy
+	// 重试预算（可选，零值关闭）
+	Budget RetryBudget
+	// 单次尝试超时（可选，0 表示不限制）；超时返回 ErrAttemptTimeout，视为可重试
+	// 与父 ctx 取消区分：父 ctx 取消/到期仍终止整个重试流程
+	AttemptTimeout time.Duration
 }
 
 // WithRetryConfig 启用/配置重试（仅对 ThrottledBatchExecutor 可用）
+// 可在运行时并发调用：新配置对之后开始的批次生效
 func (e *ThrottledBatchExecutor) WithRetryConfig(cfg RetryConfig) *ThrottledBatchExecutor {
 	if cfg.MaxAttempts <= 0 {
 		cfg.MaxAttempts = 1
 	}
-	if cfg.BackoffBase <= 0 {
-		cfg.BackoffBase = 20 * time.Millisecond
+	cfg.BackoffBase, cfg.MaxBackoff = backoffBounds(cfg.BackoffBase, cfg.MaxBackoff)
+	if cfg.Backoff == nil {
+		cfg.Backoff = ExponentialBackoff{Base: cfg.BackoffBase, Max: cfg.MaxBackoff, Jitter: 0.2}
 	}
-	if cfg.MaxBackoff <= 0 {
-		cfg.MaxBackoff = 2 * time.Second
+	policy := &retryPolicy{
+		enabled:        cfg.Enabled,
+		maxAttempts:    cfg.MaxAttempts,
+		backoff:        cfg.Backoff,
+		budget:         newRetryBudget(cfg.Budget),
+		attemptTimeout: cfg.AttemptTimeout,
+		classifier:     cfg.Classifier,
 	}
-	e.retryEnabled = cfg.Enabled
-	e.retryMaxAttempts = cfg.MaxAttempts
-	e.retryBackoffBase = cfg.BackoffBase
-	e.retryMaxBackoff = cfg.MaxBackoff
-	if cfg.Classifier != nil {
-		e.retryClassifier = cfg.Classifier
-	} else {
-		e.retryClassifier = defaultRetryClassifier
+	if policy.classifier == nil {
+		policy.classifier = defaultRetryClassifier
 	}
+	e.retry.Store(policy)
 	return e
 }
 
@@ -129,6 +184,10 @@ func defaultRetryClassifier(err error) (bool, string) {
 	if err == nil {
 		return false, ""
 	}
+	// 单次尝试超时（父 ctx 仍有效）：可重试
+	if errors.Is(err, ErrAttemptTimeout) {
+		return true, "timeout"
+	}
 	// 非可重试：上下文取消/超时
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		return false, "context"
@@ -151,20 +210,94 @@ func defaultRetryClassifier(err error) (bool, string) {
 	}
 }
 
-// ExecuteBatch 执行批量操作
+// ExecuteBatch 执行批量操作（配置了拦截器时先经过拦截器链）
+// 开启落盘队列时，最终失败的批次尝试落盘；顺序模式下同一顺序键仍有落盘批次时直接排队落盘
 func (e *ThrottledBatchExecutor) ExecuteBatch(ctx context.Context, schema *Schema, data []map[string]any) error {
+	ctx = e.withBatchID(ctx)
+	if e.spill != nil && len(data) > 0 {
+		if keyHash := spillKeyHash(ctx); keyHash != "" && e.spill.holds(keyHash) {
+			return e.spillBehind(ctx, schema, data, keyHash)
+		}
+	}
+	var err error
+	if e.chain != nil {
+		err = e.chain.ExecuteBatch(ctx, schema, data)
+	} else {
+		err = e.executeBatch(ctx, schema, data)
+	}
+	if err != nil && e.spill != nil {
+		return e.spillBatch(ctx, schema, data, err)
+	}
+	return err
+}
+
+// withBatchID 幂等模式下为批次分配 id（ctx 中已有时沿用），重试与落盘重放使用同一 id
+func (e *ThrottledBatchExecutor) withBatchID(ctx context.Context) context.Context {
+	if p, ok := e.processor.(interface{ idempotent() bool }); ok && p.idempotent() {
+		if _, ok := BatchIDFromContext(ctx); !ok {
+			return WithBatchID(ctx, NewBatchID())
+		}
+	}
+	return ctx
+}
+
+// executeBatch 限速、熔断、并发控制与重试
+func (e *ThrottledBatchExecutor) executeBatch(ctx context.Context, schema *Schema, data []map[string]any) (err error) {
 	if len(data) == 0 {
 		return nil
 	}
 
-	// 可选并发限流：当设置了信号量时，进入前需占用一个令牌
-	if e.semaphore != nil {
-		select {
-		case e.semaphore <- struct{}{}:
-			defer func() { <-e.semaphore }()
-		case <-ctx.Done():
-			return ctx.Err()
+	// 可选链路追踪：execute span 覆盖熔断、限速、并发等待与全部重试
+	ctx, endSpan := startSpan(e.metricsReporter, ctx, SpanInfo{Stage: SpanExecute, Table: schema.Name, Rows: len(data)})
+	defer func() { endSpan(err) }()
+	counters := e.stats.table(schema.Name)
+	defer func() { e.stats.recordBatch(schema.Name, len(data), err) }()
+
+	// 可选熔断：打开时快速失败，不占用限速配额与并发令牌
+	breaker := e.breakers.get(schema.Name)
+	probe, err := breaker.allow()
+	if err != nil {
+		if e.metricsReporter != nil {
+			e.metricsReporter.IncError(schema.Name, "circuit_open")
+		}
+		e.logger.sampled(ctx, slog.LevelWarn, "batchsql: circuit open, batch rejected",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)))
+		return err
+	}
+	if probe {
+		// 探测批次未得出结论（如等待期间 ctx 取消）时归还探测名额
+		defer breaker.releaseProbe()
+	}
+
+	// 等待配额/令牌期间被取消
+	waitCanceled := func(err error) error {
+		e.logger.sampled(ctx, slog.LevelInfo, "batchsql: batch canceled while waiting",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Any("error", err))
+		return err
+	}
+
+	// 可选限速：先等待全局配额，再等待表级配额（等待期间不占用并发令牌）
+	if err := e.rateLimit.wait(ctx, data); err != nil {
+		return waitCanceled(err)
+	}
+	e.schemaRateMu.RLock()
+	schemaLimit := e.schemaRateLimits[schema.Name]
+	e.schemaRateMu.RUnlock()
+	if err := schemaLimit.wait(ctx, data); err != nil {
+		return waitCanceled(err)
+	}
+
+	// 可选并发限流：自适应并发优先；否则当设置了信号量时，进入前需占用一个令牌
+	if e.adaptive != nil {
+		if err := e.adaptive.acquire(ctx); err != nil {
+			return waitCanceled(err)
 		}
+		defer e.adaptive.release()
+	} else if limiter := e.concurrency.Load(); limiter != nil {
+		if err := limiter.acquire(ctx); err != nil {
+			return waitCanceled(err)
+		}
+		defer limiter.release()
 	}
 
 	startTime := time.Now()
@@ -174,22 +307,24 @@ func (e *ThrottledBatchExecutor) ExecuteBatch(ctx context.Context, schema *Schem
 		e.metricsReporter.IncInflight()
 		defer e.metricsReporter.DecInflight()
 	}
+	counters.inFlight.Add(1)
+	defer counters.inFlight.Add(-1)
 
-	var err error
+	policy := e.retryPolicy()
 	attempts := 1
-	if e.retryEnabled && e.retryMaxAttempts > 1 {
-		attempts = e.retryMaxAttempts
+	if policy.enabled && policy.maxAttempts > 1 {
+		attempts = policy.maxAttempts
+		policy.budget.onRequest()
 	}
+	var sleep time.Duration
+	attempt := 1
 
 RETRY:
-	for attempt := 1; attempt <= attempts; attempt++ {
+	for ; attempt <= attempts; attempt++ {
 		// 生成与执行（一次尝试）
-		var operations Operations
-		operations, err = e.processor.GenerateOperations(ctx, schema, data)
-		if err == nil {
-			err = e.processor.ExecuteOperations(ctx, operations)
-		}
+		err = e.executeAttempt(ctx, schema, data, attempt, policy.attemptTimeout)
 
+		breaker.record(err)
 		if err == nil {
 			status = "success"
 			break
@@ -197,34 +332,43 @@ RETRY:
 
 		// 错误分类与重试判定
 		retryable, reason := false, "unknown"
-		if e.retryClassifier != nil {
-			retryable, reason = e.retryClassifier(err)
+		if errors.Is(err, ErrAttemptTimeout) {
+			// 单次尝试超时不交给自定义分类器，始终可重试
+			retryable, reason = true, "timeout"
+		} else if policy.classifier != nil {
+			retryable, reason = policy.classifier(err)
 		}
-		if !e.retryEnabled || attempt == attempts || !retryable {
+		// 自适应并发：超时/死锁等信号触发乘性回退（未配置重试分类器时使用默认分类）
+		if e.adaptive != nil {
+			signal := reason
+			if policy.classifier == nil {
+				_, signal = defaultRetryClassifier(err)
+			}
+			e.adaptive.onFailure(signal)
+		}
+		// 熔断器已打开时不再重试，避免继续冲击下游
+		if !policy.enabled || attempt == attempts || !retryable || breaker.rejecting() || !e.tryRetryBudget(ctx, policy.budget, schema.Name) {
 			status = "fail"
 			if e.metricsReporter != nil {
 				e.metricsReporter.IncError(schema.Name, "final:"+reason)
 			}
+			e.logger.log(ctx, slog.LevelError, "batchsql: batch failed",
+				slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Int("attempt", attempt),
+				slog.String("reason", reason), slog.Duration("duration", time.Since(startTime)), slog.Any("error", err))
 			break
 		}
 
 		// 记录一次重试指标
+		counters.retried.Add(1)
 		if e.metricsReporter != nil {
 			e.metricsReporter.IncError(schema.Name, "retry:"+reason)
 		}
 
-		// 指数退避 + 抖动
-		backoff := e.retryBackoffBase
-		for i := 1; i < attempt; i++ {
-			backoff *= 2
-			if backoff > e.retryMaxBackoff {
-				backoff = e.retryMaxBackoff
-				break
-			}
-		}
-		// 抖动 ±20%
-		jitter := time.Duration(int64(float64(backoff) * 0.2))
-		sleep := backoff - jitter + time.Duration(randInt63n(int64(2*jitter+1)))
+		// 按退避策略等待
+		sleep = policy.backoff.Backoff(attempt, sleep)
+		e.logger.sampled(ctx, slog.LevelWarn, "batchsql: retrying batch",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Int("attempt", attempt),
+			slog.String("reason", reason), slog.Duration("backoff", sleep), slog.Any("error", err))
 		timer := time.NewTimer(sleep)
 		select {
 		case <-ctx.Done():
@@ -237,51 +381,215 @@ RETRY:
 			}
 			status = "fail"
 			err = ctx.Err()
+			e.logger.sampled(ctx, slog.LevelInfo, "batchsql: retry canceled",
+				slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Int("attempt", attempt), slog.Any("error", err))
 			break RETRY
 		case <-timer.C:
 		}
 	}
 
+	if status == "success" {
+		if e.adaptive != nil {
+			e.adaptive.onSuccess(time.Since(startTime))
+		}
+		e.logger.sampled(ctx, slog.LevelDebug, "batchsql: batch executed",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Int("attempt", attempt),
+			slog.Duration("duration", time.Since(startTime)))
+	}
 	if e.metricsReporter != nil {
 		e.metricsReporter.ObserveExecuteDuration(schema.Name, len(data), time.Since(startTime), status)
+		if xr, ok := e.metricsReporter.(ExtendedMetricsReporter); ok {
+			xr.ObserveRetryAttempts(schema.Name, attempt)
+		}
 	}
 	return err
 }
 
+// executeAttempt 执行一次尝试；配置了单次超时时派生子 ctx，超时（父 ctx 仍有效）包装为 ErrAttemptTimeout
+// 配置了钩子时，在执行前后分别调用 Before/After
+func (e *ThrottledBatchExecutor) executeAttempt(ctx context.Context, schema *Schema, data []map[string]any, attempt int, timeout time.Duration) error {
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	attemptCtx, endSpan := startSpan(e.metricsReporter, attemptCtx, SpanInfo{Stage: SpanAttempt, Table: schema.Name, Rows: len(data), Attempt: attempt})
+
+	start := time.Now()
+	info := AttemptInfo{Schema: schema, Rows: len(data), Attempt: attempt}
+	operations, err := e.processor.GenerateOperations(attemptCtx, schema, data)
+	if err == nil {
+		info.Operations = operations
+		if e.hooks.Before != nil {
+			e.hooks.Before(attemptCtx, info)
+		}
+		err = e.processor.ExecuteOperations(attemptCtx, operations)
+	}
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%w after %v: %w", ErrAttemptTimeout, timeout, err)
+	}
+	if e.hooks.After != nil {
+		info.Err = err
+		info.Duration = time.Since(start)
+		e.hooks.After(attemptCtx, info)
+	}
+	endSpan(err)
+	return err
+}
+
+// WithInterceptors 设置拦截器链（包装整个 ExecuteBatch，interceptors[0] 位于最外层；再次调用会替换）
+func (e *ThrottledBatchExecutor) WithInterceptors(interceptors ...Interceptor) *ThrottledBatchExecutor {
+	if len(interceptors) == 0 {
+		e.chain = nil
+		return e
+	}
+	e.chain = chainInterceptors(BatchExecutorFunc(e.executeBatch), interceptors)
+	return e
+}
+
+// WithHooks 设置单次尝试前后的钩子（每次重试均会触发）
+func (e *ThrottledBatchExecutor) WithHooks(hooks BatchHooks) *ThrottledBatchExecutor {
+	e.hooks = hooks
+	return e
+}
+
+// tryRetryBudget 消耗一次重试预算；预算耗尽时记录指标并返回 false
+func (e *ThrottledBatchExecutor) tryRetryBudget(ctx context.Context, budget *retryBudget, table string) bool {
+	if budget.tryRetry() {
+		return true
+	}
+	if e.metricsReporter != nil {
+		e.metricsReporter.IncError(table, "retry_budget_exhausted")
+	}
+	e.logger.sampled(ctx, slog.LevelWarn, "batchsql: retry budget exhausted", slog.String("table", table))
+	return false
+}
+
+// WithLogger 设置结构化日志器（nil 表示关闭）；高频事件按 WithLogSampling（默认 DefaultLogSampling）采样
+func (e *ThrottledBatchExecutor) WithLogger(logger *slog.Logger) *ThrottledBatchExecutor {
+	sampling := DefaultLogSampling
+	if e.logSampling != nil {
+		sampling = *e.logSampling
+	}
+	e.logger = newEventLogger(logger, sampling)
+	return e
+}
+
+// WithLogSampling 设置高频日志事件的采样配置（First <= 0 表示不采样）
+func (e *ThrottledBatchExecutor) WithLogSampling(sampling LogSampling) *ThrottledBatchExecutor {
+	e.logSampling = &sampling
+	e.logger = newEventLogger(e.logger.logger, sampling)
+	return e
+}
+
+// Logger 返回当前日志器（可能为 nil）
+func (e *ThrottledBatchExecutor) Logger() *slog.Logger { return e.logger.logger }
+
+// Stats 返回执行器统计快照（Submitted 与 QueueLength 恒为 0；熔断拒绝等未执行的批次计为失败）
+func (e *ThrottledBatchExecutor) Stats() Stats { return e.stats.snapshot() }
+
 // WithMetricsReporter 设置指标报告器
 func (e *ThrottledBatchExecutor) WithMetricsReporter(metricsReporter MetricsReporter) *ThrottledBatchExecutor {
 	e.metricsReporter = metricsReporter
 	// 注入 reporter 后，立即上报一次当前并发度（如已配置）
 	if e.metricsReporter != nil {
-		if e.semaphore != nil {
-			e.metricsReporter.SetConcurrency(cap(e.semaphore))
-		} else {
-			e.metricsReporter.SetConcurrency(0)
-		}
+		e.metricsReporter.SetConcurrency(e.ConcurrencyLimit())
 	}
 	return e
 }
 
-// WithConcurrencyLimit 设置并发上限（limit <= 0 表示不启用限流）
 func (e *ThrottledBatchExecutor) MetricsReporter() MetricsReporter { return e.metricsReporter }
 
+// ConcurrencyLimit 返回当前并发上限（0 表示不限流；自适应并发时为实时上限）
+func (e *ThrottledBatchExecutor) ConcurrencyLimit() int {
+	if e.adaptive != nil {
+		return e.adaptive.currentLimit()
+	}
+	if limiter := e.concurrency.Load(); limiter != nil {
+		return limiter.currentLimit()
+	}
+	return 0
+}
+
+// WithConcurrencyLimit 设置并发上限（limit <= 0 表示不启用限流）
+// 可在运行时并发调用：调整上限不会中断在途批次，调小时待在途批次归还令牌后生效；
+// 从不限流切换为限流时，切换前已开始的批次不计入新上限
 func (e *ThrottledBatchExecutor) WithConcurrencyLimit(limit int) *ThrottledBatchExecutor {
-	if limit > 0 {
-		e.semaphore = make(chan struct{}, limit)
+	e.concurrencyMu.Lock()
+	if limit <= 0 {
+		e.concurrency.Store(nil)
+		limit = 0
+	} else if limiter := e.concurrency.Load(); limiter != nil {
+		limiter.setLimit(limit)
 	} else {
-		e.semaphore = nil
+		e.concurrency.Store(newConcurrencyLimiter(limit))
+	}
+	e.concurrencyMu.Unlock()
+	// 配置并发上限时，上报 Gauge（0 表示不限流）；自适应并发启用时由其上报实时上限
+	if e.metricsReporter != nil && e.adaptive == nil {
+		e.metricsReporter.SetConcurrency(limit)
 	}
-	// 配置并发上限时，上报 Gauge（0 表示不限流）
+	return e
+}
+
+// WithAdaptiveConcurrency 启用自适应并发（AIMD），启用后优先于 WithConcurrencyLimit 的固定上限
+// 实时上限通过 MetricsReporter.SetConcurrency 上报
+func (e *ThrottledBatchExecutor) WithAdaptiveConcurrency(cfg AdaptiveConcurrencyConfig) *ThrottledBatchExecutor {
+	e.adaptive = newAdaptiveLimiter(cfg, func(limit int) {
+		if e.metricsReporter != nil {
+			e.metricsReporter.SetConcurrency(limit)
+		}
+	})
 	if e.metricsReporter != nil {
-		if e.semaphore != nil {
-			e.metricsReporter.SetConcurrency(cap(e.semaphore))
-		} else {
-			e.metricsReporter.SetConcurrency(0)
+		e.metricsReporter.SetConcurrency(e.adaptive.currentLimit())
+	}
+	return e
+}
+
+// WithRateLimit 设置全局行/字节速率限制（零值配置表示关闭）
+func (e *ThrottledBatchExecutor) WithRateLimit(cfg RateLimitConfig) *ThrottledBatchExecutor {
+	e.rateLimit = newRateLimiter(cfg)
+	return e
+}
+
+// WithSchemaRateLimit 设置单表行/字节速率限制（与全局限制同时生效；零值配置表示移除）
+func (e *ThrottledBatchExecutor) WithSchemaRateLimit(table string, cfg RateLimitConfig) *ThrottledBatchExecutor {
+	e.schemaRateMu.Lock()
+	defer e.schemaRateMu.Unlock()
+	if limiter := newRateLimiter(cfg); limiter != nil {
+		if e.schemaRateLimits == nil {
+			e.schemaRateLimits = make(map[string]*rateLimiter)
 		}
+		e.schemaRateLimits[table] = limiter
+	} else {
+		delete(e.schemaRateLimits, table)
 	}
 	return e
 }
 
+// WithCircuitBreaker 启用熔断（全局或按表）；状态变迁通过 CircuitBreakerMetricsReporter 上报（如实现）
+func (e *ThrottledBatchExecutor) WithCircuitBreaker(cfg CircuitBreakerConfig) *ThrottledBatchExecutor {
+	e.breakers = newCircuitBreakers(cfg, func(key string, from, to CircuitState) {
+		if r, ok := e.metricsReporter.(CircuitBreakerMetricsReporter); ok {
+			r.ObserveCircuitTransition(key, from, to)
+		}
+		level := slog.LevelInfo
+		if to == CircuitOpen {
+			level = slog.LevelWarn
+		}
+		e.logger.log(context.Background(), level, "batchsql: circuit state changed",
+			slog.String("breaker", key), slog.String("from", from.String()), slog.String("to", to.String()))
+	})
+	return e
+}
+
+// CircuitStates 返回各熔断器当前状态（键为表名或 "*"；未启用熔断时为空）
+func (e *ThrottledBatchExecutor) CircuitStates() map[string]CircuitState {
+	return e.breakers.states()
+}
+
 var _ BatchExecutor = (*MockExecutor)(nil)
 
 // Executor 模拟批量执行器（用于测试）
@@ -380,14 +688,3 @@ func (e *MockExecutor) SnapshotExecutedBatches() [][]map[string]any {
 	copy(out, e.ExecutedBatches)
 	return out
 }
-
-// randInt63n 返回 [0,n) 的随机数；避免额外依赖，用 time.Now 纳秒抖动
-func randInt63n(n int64) int64 {
-	if n <= 0 {
-		return 0
-	}
-	// LCG 简易随机（不要求强随机，仅用于退避抖动）
-	seed := time.Now().UnixNano()
-	seed = (seed*6364136223846793005 + 1) & 0x7fffffffffffffff
-	return int64(seed % n)
-}
@@ -0,0 +1,126 @@
+package batchsql_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+type concurrencyGaugeMetrics struct {
+	batchsql.NoopMetricsReporter
+	last int32
+}
+
+func (m *concurrencyGaugeMetrics) SetConcurrency(n int) { atomic.StoreInt32(&m.last, int32(n)) }
+
+func TestAdaptiveConcurrency_AdditiveIncrease(t *testing.T) {
+	m := &concurrencyGaugeMetrics{}
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithMetricsReporter(m).
+		WithAdaptiveConcurrency(batchsql.AdaptiveConcurrencyConfig{
+			MinLimit:      1,
+			MaxLimit:      3,
+			TargetLatency: time.Second,
+		})
+	if exec.ConcurrencyLimit() != 1 {
+		t.Fatalf("initial limit should default to MinLimit, got %d", exec.ConcurrencyLimit())
+	}
+
+	ctx := context.Background()
+	schema := batchsql.NewSchema("users", batchsql.ConflictIgnore, "id")
+	// 1 次成功 -> 2；再 2 次成功 -> 3；之后封顶
+	for i := 0; i < 10; i++ {
+		if err := exec.ExecuteBatch(ctx, schema, []map[string]any{{"id": i}}); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+		if i == 0 && exec.ConcurrencyLimit() != 2 {
+			t.Fatalf("expected limit 2 after first success, got %d", exec.ConcurrencyLimit())
+		}
+	}
+	if exec.ConcurrencyLimit() != 3 {
+		t.Fatalf("limit should be capped at MaxLimit 3, got %d", exec.ConcurrencyLimit())
+	}
+	if atomic.LoadInt32(&m.last) != 3 {
+		t.Fatalf("live limit should be reported via SetConcurrency, got %d", m.last)
+	}
+}
+
+func TestAdaptiveConcurrency_MultiplicativeDecreaseOnDeadlock(t *testing.T) {
+	proc := &fakeProcessor{failCount: 100, failReason: "deadlock found when trying to get lock"}
+	exec := batchsql.NewThrottledBatchExecutor(proc).
+		WithAdaptiveConcurrency(batchsql.AdaptiveConcurrencyConfig{
+			MinLimit:      1,
+			MaxLimit:      16,
+			InitialLimit:  8,
+			TargetLatency: time.Hour, // 冷却期足够长，验证同一冷却期内只回退一次
+		})
+
+	ctx := context.Background()
+	schema := batchsql.NewSchema("orders", batchsql.ConflictIgnore, "id")
+	_ = exec.ExecuteBatch(ctx, schema, []map[string]any{{"id": 1}})
+	if exec.ConcurrencyLimit() != 4 {
+		t.Fatalf("expected limit halved to 4, got %d", exec.ConcurrencyLimit())
+	}
+	_ = exec.ExecuteBatch(ctx, schema, []map[string]any{{"id": 2}})
+	if exec.ConcurrencyLimit() != 4 {
+		t.Fatalf("expected a single decrease within cooldown, got %d", exec.ConcurrencyLimit())
+	}
+
+	// 非回退原因的错误不影响上限
+	nonSignal := batchsql.NewThrottledBatchExecutor(&fakeProcessor{failCount: 100, failReason: "syntax error"}).
+		WithAdaptiveConcurrency(batchsql.AdaptiveConcurrencyConfig{MinLimit: 1, MaxLimit: 16, InitialLimit: 8})
+	_ = nonSignal.ExecuteBatch(ctx, schema, []map[string]any{{"id": 3}})
+	if nonSignal.ConcurrencyLimit() != 8 {
+		t.Fatalf("non-retryable errors must not shrink the limit, got %d", nonSignal.ConcurrencyLimit())
+	}
+}
+
+// slowProcessor 记录同时执行的最大批次数
+type slowProcessor struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (p *slowProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *slowProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	p.mu.Lock()
+	p.current++
+	if p.current > p.max {
+		p.max = p.current
+	}
+	p.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	p.mu.Lock()
+	p.current--
+	p.mu.Unlock()
+	return nil
+}
+
+func TestAdaptiveConcurrency_EnforcesLiveLimit(t *testing.T) {
+	proc := &slowProcessor{}
+	exec := batchsql.NewThrottledBatchExecutor(proc).
+		WithAdaptiveConcurrency(batchsql.AdaptiveConcurrencyConfig{MinLimit: 2, MaxLimit: 2})
+
+	ctx := context.Background()
+	schema := batchsql.NewSchema("users", batchsql.ConflictIgnore, "id")
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			_ = exec.ExecuteBatch(ctx, schema, []map[string]any{{"id": n}})
+		}(i)
+	}
+	wg.Wait()
+	if proc.max > 2 {
+		t.Fatalf("expected at most 2 concurrent batches, got %d", proc.max)
+	}
+}
@@ -0,0 +1,109 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// hangingProcessor 前 hangCount 次执行阻塞直到 ctx 结束（模拟卡住的 ExecContext）
+type hangingProcessor struct {
+	hangCount int32
+	calls     atomic.Int32
+}
+
+func (p *hangingProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *hangingProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	if p.calls.Add(1) <= p.hangCount {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return nil
+}
+
+func TestAttemptTimeout_RetriesHungAttempt(t *testing.T) {
+	p := &hangingProcessor{hangCount: 1}
+	m := &retryMetrics{}
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithMetricsReporter(m).
+		WithRetryConfig(batchsql.RetryConfig{
+			Enabled:        true,
+			MaxAttempts:    2,
+			BackoffBase:    time.Millisecond,
+			AttemptTimeout: 20 * time.Millisecond,
+		})
+
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id")
+	start := time.Now()
+	if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}}); err != nil {
+		t.Fatalf("hung attempt should be retried and succeed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("attempt timeout not applied, elapsed %v", elapsed)
+	}
+	if got := p.calls.Load(); got != 2 {
+		t.Fatalf("expected 2 attempts, got %d", got)
+	}
+	if got := atomic.LoadInt32(&m.retry); got != 1 {
+		t.Fatalf("attempt timeout should be reported as a retry, got %d", got)
+	}
+}
+
+func TestAttemptTimeout_FinalErrorAndParentCancellation(t *testing.T) {
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": 1}}
+
+	// 所有尝试都超时：最终错误为 ErrAttemptTimeout
+	p := &hangingProcessor{hangCount: 100}
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond, AttemptTimeout: 10 * time.Millisecond})
+	err := exec.ExecuteBatch(context.Background(), schema, data)
+	if !errors.Is(err, batchsql.ErrAttemptTimeout) {
+		t.Fatalf("expected ErrAttemptTimeout, got %v", err)
+	}
+	if got := p.calls.Load(); got != 3 {
+		t.Fatalf("expected all 3 attempts, got %d", got)
+	}
+
+	// 父 ctx 先到期：不视为单次超时，不再重试
+	p = &hangingProcessor{hangCount: 100}
+	exec = batchsql.NewThrottledBatchExecutor(p).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond, AttemptTimeout: time.Second})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = exec.ExecuteBatch(ctx, schema, data)
+	if errors.Is(err, batchsql.ErrAttemptTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("parent deadline should surface as context error, got %v", err)
+	}
+	if got := p.calls.Load(); got != 1 {
+		t.Fatalf("parent cancellation must stop retries, attempts=%d", got)
+	}
+}
+
+func TestAttemptTimeout_HooksShareAttemptContext(t *testing.T) {
+	var beforeCtx, afterCtx context.Context
+	exec := batchsql.NewThrottledBatchExecutor(&hangingProcessor{}).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 1, AttemptTimeout: time.Second}).
+		WithHooks(batchsql.BatchHooks{
+			Before: func(ctx context.Context, info batchsql.AttemptInfo) { beforeCtx = ctx },
+			After:  func(ctx context.Context, info batchsql.AttemptInfo) { afterCtx = ctx },
+		})
+
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if beforeCtx == nil || beforeCtx != afterCtx {
+		t.Fatalf("before and after hooks must receive the same attempt ctx")
+	}
+	if _, ok := afterCtx.Deadline(); !ok {
+		t.Fatalf("after hook ctx should carry the attempt deadline")
+	}
+}
@@ -0,0 +1,196 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// switchProcessor 可切换成功/失败的处理器，记录执行次数
+type switchProcessor struct {
+	failing atomic.Bool
+	calls   atomic.Int32
+}
+
+func (p *switchProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *switchProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	p.calls.Add(1)
+	if p.failing.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+type circuitMetrics struct {
+	batchsql.NoopMetricsReporter
+	mu          sync.Mutex
+	transitions []string
+}
+
+func (m *circuitMetrics) ObserveCircuitTransition(key string, from, to batchsql.CircuitState) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transitions = append(m.transitions, key+":"+from.String()+"->"+to.String())
+}
+
+func (m *circuitMetrics) snapshot() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.transitions...)
+}
+
+func TestCircuitBreaker_OpenHalfOpenClose(t *testing.T) {
+	p := &switchProcessor{}
+	p.failing.Store(true)
+	m := &circuitMetrics{}
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithMetricsReporter(m).
+		WithCircuitBreaker(batchsql.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond})
+
+	ctx := context.Background()
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": 1}}
+
+	for i := 0; i < 2; i++ {
+		if err := exec.ExecuteBatch(ctx, schema, data); err == nil || errors.Is(err, batchsql.ErrCircuitOpen) {
+			t.Fatalf("attempt %d should reach processor and fail, got %v", i, err)
+		}
+	}
+	if err := exec.ExecuteBatch(ctx, schema, data); !errors.Is(err, batchsql.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after threshold, got %v", err)
+	}
+	if got := p.calls.Load(); got != 2 {
+		t.Fatalf("open circuit must not reach processor, calls=%d", got)
+	}
+	if st := exec.CircuitStates()["*"]; st != batchsql.CircuitOpen {
+		t.Fatalf("expected global breaker open, got %v", st)
+	}
+
+	// 超时后半开：探测失败重新打开
+	time.Sleep(60 * time.Millisecond)
+	if err := exec.ExecuteBatch(ctx, schema, data); err == nil || errors.Is(err, batchsql.ErrCircuitOpen) {
+		t.Fatalf("probe should reach processor and fail, got %v", err)
+	}
+	if err := exec.ExecuteBatch(ctx, schema, data); !errors.Is(err, batchsql.ErrCircuitOpen) {
+		t.Fatalf("failed probe should reopen circuit, got %v", err)
+	}
+
+	// 再次半开：探测成功后关闭
+	p.failing.Store(false)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := exec.ExecuteBatch(ctx, schema, data); err != nil {
+			t.Fatalf("batch %d after recovery: %v", i, err)
+		}
+	}
+
+	want := []string{
+		"*:closed->open",
+		"*:open->half_open",
+		"*:half_open->open",
+		"*:open->half_open",
+		"*:half_open->closed",
+	}
+	got := m.snapshot()
+	if len(got) != len(want) {
+		t.Fatalf("transitions: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("transitions: got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestCircuitBreaker_HalfOpenAllowsSingleProbe(t *testing.T) {
+	p := &blockingProbeProcessor{release: make(chan struct{}), entered: make(chan struct{}, 1)}
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithCircuitBreaker(batchsql.CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: 20 * time.Millisecond})
+
+	ctx := context.Background()
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": 1}}
+
+	p.fail.Store(true)
+	_ = exec.ExecuteBatch(ctx, schema, data)
+	p.fail.Store(false)
+	time.Sleep(30 * time.Millisecond)
+
+	probeErr := make(chan error, 1)
+	go func() { probeErr <- exec.ExecuteBatch(ctx, schema, data) }()
+	<-p.entered
+
+	if err := exec.ExecuteBatch(ctx, schema, data); !errors.Is(err, batchsql.ErrCircuitOpen) {
+		t.Fatalf("second batch during probe should fail fast, got %v", err)
+	}
+	close(p.release)
+	if err := <-probeErr; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if err := exec.ExecuteBatch(ctx, schema, data); err != nil {
+		t.Fatalf("closed circuit should pass: %v", err)
+	}
+}
+
+type blockingProbeProcessor struct {
+	fail    atomic.Bool
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProbeProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *blockingProbeProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	if p.fail.Load() {
+		return errors.New("connection refused")
+	}
+	select {
+	case p.entered <- struct{}{}:
+		<-p.release
+	default:
+	}
+	return nil
+}
+
+func TestCircuitBreaker_PerSchemaAndRetryStops(t *testing.T) {
+	p := &switchProcessor{}
+	p.failing.Store(true)
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 5, BackoffBase: time.Millisecond}).
+		WithCircuitBreaker(batchsql.CircuitBreakerConfig{FailureThreshold: 2, OpenTimeout: time.Minute, PerSchema: true})
+
+	ctx := context.Background()
+	bad := batchsql.NewSchema("bad", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": 1}}
+
+	if err := exec.ExecuteBatch(ctx, bad, data); err == nil {
+		t.Fatalf("expected failure")
+	}
+	// 第二次失败打开熔断，剩余重试应被中止
+	if got := p.calls.Load(); got != 2 {
+		t.Fatalf("retries should stop once circuit opens, calls=%d", got)
+	}
+	if err := exec.ExecuteBatch(ctx, bad, data); !errors.Is(err, batchsql.ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen for bad table, got %v", err)
+	}
+
+	p.failing.Store(false)
+	good := batchsql.NewSchema("good", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(ctx, good, data); err != nil {
+		t.Fatalf("other table must not be affected: %v", err)
+	}
+	states := exec.CircuitStates()
+	if states["bad"] != batchsql.CircuitOpen || states["good"] != batchsql.CircuitClosed {
+		t.Fatalf("unexpected states: %v", states)
+	}
+}
@@ -0,0 +1,85 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func rateLimitRows(n int, payload string) []map[string]any {
+	out := make([]map[string]any, n)
+	for i := range out {
+		out[i] = map[string]any{"id": int64(i), "payload": payload}
+	}
+	return out
+}
+
+func TestRateLimit_RowsPerSecondDelaysBatches(t *testing.T) {
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithRateLimit(batchsql.RateLimitConfig{RowsPerSecond: 100, RowsBurst: 10})
+
+	ctx := context.Background()
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id", "payload")
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := exec.ExecuteBatch(ctx, schema, rateLimitRows(10, "x")); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	// 首批使用突发容量，后两批各需等待约 100ms
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("expected row budget to delay batches, elapsed %v", elapsed)
+	}
+}
+
+func TestRateLimit_BytesPerSecondAndCancellation(t *testing.T) {
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithRateLimit(batchsql.RateLimitConfig{BytesPerSecond: 1024, BytesBurst: 1024})
+
+	schema := batchsql.NewSchema("blobs", batchsql.ConflictIgnore, "id", "payload")
+	payload := strings.Repeat("a", 1000)
+	if err := exec.ExecuteBatch(context.Background(), schema, rateLimitRows(1, payload)); err != nil {
+		t.Fatalf("first batch within burst should pass: %v", err)
+	}
+
+	// 第二批需要约 1 秒的字节配额，ctx 先到期应立即返回
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := exec.ExecuteBatch(ctx, schema, rateLimitRows(1, payload))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded while waiting for byte budget, got %v", err)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("waiting must respect ctx cancellation")
+	}
+}
+
+func TestRateLimit_PerSchemaOnlyAffectsThatTable(t *testing.T) {
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithSchemaRateLimit("slow", batchsql.RateLimitConfig{RowsPerSecond: 10, RowsBurst: 1})
+
+	ctx := context.Background()
+	fast := batchsql.NewSchema("fast", batchsql.ConflictIgnore, "id", "payload")
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		if err := exec.ExecuteBatch(ctx, fast, rateLimitRows(5, "x")); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("table without limit should not be delayed, elapsed %v", elapsed)
+	}
+
+	slow := batchsql.NewSchema("slow", batchsql.ConflictIgnore, "id", "payload")
+	_ = exec.ExecuteBatch(ctx, slow, rateLimitRows(1, "x"))
+	ctx2, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	if err := exec.ExecuteBatch(ctx2, slow, rateLimitRows(5, "x")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected limited table to wait for budget, got %v", err)
+	}
+}
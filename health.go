@@ -0,0 +1,305 @@
+package batchsql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Pinger 可探测下游连通性的组件（SQLBatchProcessor、RedisBatchProcessor、ThrottledBatchExecutor）
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+var (
+	_ Pinger = (*SQLBatchProcessor)(nil)
+	_ Pinger = (*RedisBatchProcessor)(nil)
+	_ Pinger = (*ThrottledBatchExecutor)(nil)
+)
+
+// Ping 探测数据库连接
+func (bp *SQLBatchProcessor) Ping(ctx context.Context) error {
+	return bp.db.PingContext(ctx)
+}
+
+// Ping 探测 Redis 连接
+func (rp *RedisBatchProcessor) Ping(ctx context.Context) error {
+	return rp.client.Ping(ctx).Err()
+}
+
+// Ping 经处理器探测下游连接；处理器未实现 Pinger 时返回包装 errors.ErrUnsupported 的错误
+func (e *ThrottledBatchExecutor) Ping(ctx context.Context) error {
+	if p, ok := e.processor.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return fmt.Errorf("%w: processor %T does not support ping", errors.ErrUnsupported, e.processor)
+}
+
+// HealthConfig 健康检查阈值（零值字段使用默认值，负值表示不检查）
+type HealthConfig struct {
+	PingTimeout time.Duration // 连通性探测超时（默认 2s）
+	// MaxQueueSaturation 任一管道队列占用比例达到该值时未就绪（默认 0.9）
+	MaxQueueSaturation float64
+	// MaxErrorRate 最近 ErrorRateWindow 内失败批次比例达到该值时未就绪（默认 0.5）
+	MaxErrorRate    float64
+	ErrorRateWindow time.Duration // 错误率统计窗口（默认 1m）
+	MinBatches      int           // 窗口内批次数少于该值时不判定错误率（默认 5）
+	// MaxFlushAge 有排队或在途请求时，距最近一次成功刷新超过该时长则未就绪（默认不检查）
+	MaxFlushAge time.Duration
+}
+
+// HealthStatus 总体健康状态
+type HealthStatus string
+
+const (
+	HealthOK          HealthStatus = "ok"          // 就绪
+	HealthDegraded    HealthStatus = "degraded"    // 就绪，但部分表熔断
+	HealthUnavailable HealthStatus = "unavailable" // 未就绪
+)
+
+// Health 健康检查结果
+type Health struct {
+	Status HealthStatus `json:"status"`
+	Live   bool         `json:"live"`  // BatchSQL 未关闭
+	Ready  bool         `json:"ready"` // 可接收并写入新请求
+	// Reasons 未就绪或降级的原因
+	Reasons []string `json:"reasons,omitempty"`
+
+	Ping         string        `json:"ping"` // ok / failed / skipped（执行器不支持）
+	PingError    string        `json:"ping_error,omitempty"`
+	PingDuration time.Duration `json:"ping_duration"`
+
+	// Circuits 非关闭状态的熔断器（键为表名或 "*"）
+	Circuits map[string]string `json:"circuits,omitempty"`
+
+	QueueLength     int     `json:"queue_length"`
+	QueueSaturation float64 `json:"queue_saturation"` // 各管道队列占用比例的最大值
+
+	LastSuccess time.Time `json:"last_success"` // 最近一次成功刷新（无时为零值）
+	ErrorRate   float64   `json:"error_rate"`   // 最近窗口内失败批次比例
+	Batches     int64     `json:"batches"`      // 最近窗口内结束的批次数
+}
+
+// healthBuckets 错误率窗口的桶数
+const healthBuckets = 10
+
+// healthTracker 最近成功刷新时间与滑动窗口内的批次/失败计数
+type healthTracker struct {
+	started     time.Time
+	lastSuccess atomic.Int64 // UnixNano，0 表示尚无成功批次
+
+	mu      sync.Mutex
+	cfg     HealthConfig
+	width   time.Duration
+	buckets [healthBuckets]struct {
+		slot          int64
+		total, failed int64
+	}
+}
+
+func (t *healthTracker) configure(cfg HealthConfig) {
+	if cfg.PingTimeout == 0 {
+		cfg.PingTimeout = 2 * time.Second
+	}
+	if cfg.MaxQueueSaturation == 0 {
+		cfg.MaxQueueSaturation = 0.9
+	}
+	if cfg.MaxErrorRate == 0 {
+		cfg.MaxErrorRate = 0.5
+	}
+	if cfg.ErrorRateWindow <= 0 {
+		cfg.ErrorRateWindow = time.Minute
+	}
+	if cfg.MinBatches == 0 {
+		cfg.MinBatches = 5
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cfg = cfg
+	t.width = max(cfg.ErrorRateWindow/healthBuckets, time.Millisecond)
+	clear(t.buckets[:])
+}
+
+func (t *healthTracker) config() HealthConfig {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cfg
+}
+
+// record 记录一个批次的结束
+func (t *healthTracker) record(err error) {
+	now := time.Now()
+	if err == nil {
+		t.lastSuccess.Store(now.UnixNano())
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slot := now.UnixNano() / int64(t.width)
+	b := &t.buckets[slot%healthBuckets]
+	if b.slot != slot {
+		b.slot, b.total, b.failed = slot, 0, 0
+	}
+	b.total++
+	if err != nil {
+		b.failed++
+	}
+}
+
+// window 返回窗口内的批次数与失败数
+func (t *healthTracker) window() (total, failed int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	slot := time.Now().UnixNano() / int64(t.width)
+	for _, b := range t.buckets {
+		if slot-b.slot < healthBuckets {
+			total += b.total
+			failed += b.failed
+		}
+	}
+	return total, failed
+}
+
+// WithHealthConfig 设置健康检查阈值（会重置错误率窗口）
+func (b *BatchSQL) WithHealthConfig(cfg HealthConfig) *BatchSQL {
+	b.health.configure(cfg)
+	return b
+}
+
+// Health 检查连通性、熔断、队列占用、最近成功刷新与错误率，可在任意 goroutine 调用
+func (b *BatchSQL) Health(ctx context.Context) Health {
+	cfg := b.health.config()
+	h := Health{Live: !b.closed.Load(), Ping: "skipped"}
+	var reasons, degraded []string
+	if !h.Live {
+		reasons = append(reasons, "closed")
+	}
+
+	// 连通性：经执行器/处理器探测
+	if p, ok := executorAs[Pinger](b.executor); ok {
+		pingCtx := ctx
+		if cfg.PingTimeout > 0 {
+			var cancel context.CancelFunc
+			pingCtx, cancel = context.WithTimeout(ctx, cfg.PingTimeout)
+			defer cancel()
+		}
+		start := time.Now()
+		err := p.Ping(pingCtx)
+		h.PingDuration = time.Since(start)
+		switch {
+		case err == nil:
+			h.Ping = "ok"
+		case errors.Is(err, errors.ErrUnsupported):
+		default:
+			h.Ping, h.PingError = "failed", err.Error()
+			reasons = append(reasons, "ping failed")
+		}
+	}
+
+	// 熔断：全局熔断打开时所有批次快速失败，视为未就绪；按表熔断视为降级
+	if te, ok := executorAs[*ThrottledBatchExecutor](b.executor); ok {
+		for key, state := range te.CircuitStates() {
+			if state == CircuitClosed {
+				continue
+			}
+			if h.Circuits == nil {
+				h.Circuits = make(map[string]string)
+			}
+			h.Circuits[key] = state.String()
+			if key == globalCircuitKey && state == CircuitOpen {
+				reasons = append(reasons, "circuit open")
+			} else {
+				degraded = append(degraded, "circuit "+state.String()+": "+key)
+			}
+		}
+	}
+
+	// 队列占用：取各管道中占用比例最高者
+	b.forEachPipeline(func(p *pipelineHandle) {
+		n := p.queueLength()
+		h.QueueLength += n
+		if c := p.queueCapacity(); c > 0 {
+			h.QueueSaturation = max(h.QueueSaturation, float64(n)/float64(c))
+		}
+	})
+	if cfg.MaxQueueSaturation > 0 && h.QueueSaturation >= cfg.MaxQueueSaturation {
+		reasons = append(reasons, fmt.Sprintf("queue saturation %.2f", h.QueueSaturation))
+	}
+
+	// 错误率
+	total, failed := b.health.window()
+	h.Batches = total
+	if total > 0 {
+		h.ErrorRate = float64(failed) / float64(total)
+	}
+	if cfg.MaxErrorRate > 0 && total >= int64(cfg.MinBatches) && h.ErrorRate >= cfg.MaxErrorRate {
+		reasons = append(reasons, fmt.Sprintf("error rate %.2f", h.ErrorRate))
+	}
+
+	// 最近成功刷新：有待处理请求却长时间没有成功批次
+	last := b.health.started
+	if ns := b.health.lastSuccess.Load(); ns > 0 {
+		h.LastSuccess = time.Unix(0, ns)
+		last = h.LastSuccess
+	}
+	if cfg.MaxFlushAge > 0 && (h.QueueLength > 0 || b.stats.snapshot().InFlight > 0) && time.Since(last) > cfg.MaxFlushAge {
+		reasons = append(reasons, fmt.Sprintf("no successful flush for %v", time.Since(last).Round(time.Millisecond)))
+	}
+
+	h.Ready = len(reasons) == 0
+	switch {
+	case !h.Ready:
+		h.Status = HealthUnavailable
+	case len(degraded) > 0:
+		h.Status = HealthDegraded
+	default:
+		h.Status = HealthOK
+	}
+	h.Reasons = append(reasons, degraded...)
+	return h
+}
+
+// forEachPipeline 遍历共享管道与各独立管道
+func (b *BatchSQL) forEachPipeline(fn func(*pipelineHandle)) {
+	if b.pipeline != nil {
+		fn(b.pipeline)
+	}
+	b.schemaPipelines.Range(func(_, v any) bool {
+		fn(v.(*pipelineHandle))
+		return true
+	})
+}
+
+// queueCapacity 当前管道通道与前置队列的容量
+func (h *pipelineHandle) queueCapacity() int {
+	return cap(h.stage.Load().pipeline.DataChan()) + cap(h.front)
+}
+
+// LivenessHandler 存活探针：BatchSQL 未关闭时返回 200，否则 503（不探测下游）
+func LivenessHandler(b *BatchSQL) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if b.closed.Load() {
+			http.Error(w, "closed", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+// ReadinessHandler 就绪探针：以 JSON 输出 Health，未就绪时状态码为 503
+func ReadinessHandler(b *BatchSQL) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := b.Health(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		if !h.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(h)
+	})
+}
@@ -0,0 +1,123 @@
+package batchsql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// pingProcessor 总是执行失败、Ping 返回 pingErr 的处理器
+type pingProcessor struct {
+	nonRetryProcessor
+	pingErr error
+}
+
+func (p pingProcessor) Ping(ctx context.Context) error { return p.pingErr }
+
+func readiness(t *testing.T, batch *batchsql.BatchSQL) (int, batchsql.Health) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	batchsql.ReadinessHandler(batch).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	var h batchsql.Health
+	if err := json.Unmarshal(rec.Body.Bytes(), &h); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return rec.Code, h
+}
+
+func TestHealth_SQLPingAndLiveness(t *testing.T) {
+	db, _ := openLedgerDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	batch := batchsql.NewSQLiteBatchSQL(ctx, db, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 2, FlushInterval: time.Hour})
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 2; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	waitRowsWritten(t, batch, 2)
+
+	code, h := readiness(t, batch)
+	if code != http.StatusOK || h.Status != batchsql.HealthOK || !h.Ready || h.Ping != "ok" {
+		t.Fatalf("expected ready with successful ping, got %d %+v", code, h)
+	}
+	if h.LastSuccess.IsZero() || h.Batches != 1 || h.ErrorRate != 0 || h.QueueLength != 0 {
+		t.Fatalf("unexpected flush stats: %+v", h)
+	}
+
+	rec := httptest.NewRecorder()
+	batchsql.LivenessHandler(batch).ServeHTTP(rec, httptest.NewRequest("GET", "/livez", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected live, got %d", rec.Code)
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for batch.Health(context.Background()).Live && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	rec = httptest.NewRecorder()
+	batchsql.LivenessHandler(batch).ServeHTTP(rec, httptest.NewRequest("GET", "/livez", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected liveness to fail after close, got %d", rec.Code)
+	}
+	if code, _ := readiness(t, batch); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected readiness to fail after close, got %d", code)
+	}
+}
+
+func TestHealth_PingFailureErrorRateAndCircuit(t *testing.T) {
+	exec := batchsql.NewThrottledBatchExecutor(pingProcessor{pingErr: errors.New("connection refused")}).
+		WithCircuitBreaker(batchsql.CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQL(ctx, 10, 1, time.Hour, exec).
+		WithHealthConfig(batchsql.HealthConfig{MinBatches: 2, MaxErrorRate: 0.5})
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 3; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for batch.Stats().Failed < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	code, h := readiness(t, batch)
+	if code != http.StatusServiceUnavailable || h.Ready || h.Status != batchsql.HealthUnavailable || !h.Live {
+		t.Fatalf("expected unavailable, got %d %+v", code, h)
+	}
+	if h.Ping != "failed" || !strings.Contains(h.PingError, "connection refused") {
+		t.Fatalf("expected failed ping, got %+v", h)
+	}
+	if h.ErrorRate != 1 || h.Batches != 3 || !h.LastSuccess.IsZero() {
+		t.Fatalf("unexpected error rate: %+v", h)
+	}
+	if h.Circuits["*"] != "open" {
+		t.Fatalf("expected global circuit to be open, got %v", h.Circuits)
+	}
+	joined := strings.Join(h.Reasons, ",")
+	for _, want := range []string{"ping failed", "circuit open", "error rate"} {
+		if !strings.Contains(joined, want) {
+			t.Fatalf("expected reason %q in %v", want, h.Reasons)
+		}
+	}
+}
+
+func TestHealth_MockExecutorSkipsPing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, _ := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 2, FlushInterval: time.Hour})
+	h := batch.Health(ctx)
+	if !h.Ready || h.Ping != "skipped" || h.Status != batchsql.HealthOK {
+		t.Fatalf("expected ready with skipped ping, got %+v", h)
+	}
+}
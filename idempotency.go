@@ -0,0 +1,109 @@
+package batchsql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// DefaultIdempotencyTable 默认去重表名
+const DefaultIdempotencyTable = "batchsql_batches"
+
+// IdempotencyConfig 批次幂等配置（零值=关闭）
+/*
+说明：
+- 批次 id 经 ctx 传递，同一批次的各次重试及落盘队列（EnableSpill）重放使用同一 id；来源依次为：
+  调用方通过 WithBatchID 指定；开启 WAL 时由预写日志按批内 LSN 计算并在执行前记录；否则进入
+  ThrottledBatchExecutor 时随机分配（128 位）
+- SQLBatchProcessor 在同一事务内先向去重表插入批次 id（已存在时忽略），影响行数为 0 表示该批次已提交过，
+  回滚并跳过执行；否则执行批量 SQL 后提交。提交成功但返回网络错误时，重试不会重复写入
+- 内容相同的不同批次 id 不同，均会写入
+- WAL 重放时已记录边界的批次按原批次与 id 执行，提交后、checkpoint 前崩溃不会重复写入；
+  WAL 之外的上游重投仍需 WithBatchID 或唯一键去重
+- 去重表需预先创建（主键列 batch_id，DDL 见文档），并按 created_at 定期清理；保留时长需大于最长的重试/重放间隔
+- 驱动需实现 IdempotencyDriver（内置 MySQL/PostgreSQL/SQLite/Mock 驱动均已实现）；Redis 处理器不支持
+*/
+type IdempotencyConfig struct {
+	Enabled bool
+	// Table 去重表名（默认 DefaultIdempotencyTable；须为普通标识符，可用 . 限定库名）
+	Table string
+}
+
+// validate 校验去重表名（表名直接拼入 SQL，仅允许普通标识符）
+func (c IdempotencyConfig) validate() error {
+	if !validIdentifier(c.Table) {
+		return fmt.Errorf("%w: idempotency table %q", ErrInvalidSchema, c.Table)
+	}
+	return nil
+}
+
+// IdempotencyDriver 可选扩展：生成去重表插入语句
+// 语句只有一个参数（批次 id）；id 已存在时不报错且影响行数为 0
+type IdempotencyDriver interface {
+	GenerateMarkSQL(table string) string
+}
+
+type batchIDKey struct{}
+
+// NewBatchID 生成随机批次 id（32 位十六进制）
+func NewBatchID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// WithBatchID 为批次指定 id（幂等模式写入去重表的值，最长 64 字符）
+// 上游已有稳定标识（如消息 id）时，可在调用 ExecuteBatch 前指定，使上游重投同样被去重
+func WithBatchID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, batchIDKey{}, id)
+}
+
+// BatchIDFromContext 返回 ctx 中的批次 id
+func BatchIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(batchIDKey{}).(string)
+	return id, ok && id != ""
+}
+
+// idempotent 处理器是否开启了幂等模式
+func (bp *SQLBatchProcessor) idempotent() bool { return bp.idempotency.Enabled }
+
+// executeIdempotent 在同一事务内记录批次 id 并执行批量 SQL；id 已记录时跳过
+func (bp *SQLBatchProcessor) executeIdempotent(ctx context.Context, operations Operations) error {
+	if bp.idempotencyErr != nil {
+		return bp.idempotencyErr
+	}
+	marker, ok := bp.driver.(IdempotencyDriver)
+	if !ok {
+		return fmt.Errorf("%w: driver %T does not support idempotency", errors.ErrUnsupported, bp.driver)
+	}
+	tx, err := bp.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// 提交后 Rollback 为空操作
+	defer func() { _ = tx.Rollback() }()
+
+	// 直接调用处理器（未经执行器）且未指定 id 时，每次调用各自分配，仅保证写入原子性
+	id, ok := BatchIDFromContext(ctx)
+	if !ok {
+		id = NewBatchID()
+	}
+	res, err := tx.ExecContext(ctx, marker.GenerateMarkSQL(bp.idempotency.Table), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		bp.skipped.Add(1)
+		return nil
+	}
+	if _, err := tx.ExecContext(ctx, operations[0].(string), operations[1:]...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
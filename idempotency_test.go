@@ -0,0 +1,315 @@
+package batchsql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// ledgerDB 内存中的假数据库：去重表 + 目标表行数，支持事务；commitFailures 次提交“已生效但返回网络错误”
+type ledgerDB struct {
+	mu             sync.Mutex
+	batches        map[string]bool
+	rows           int
+	commitFailures int
+}
+
+var (
+	ledgerOnce sync.Once
+	ledgerMu   sync.Mutex
+	ledgers    = map[string]*ledgerDB{}
+)
+
+type ledgerDriver struct{}
+
+func (ledgerDriver) Open(name string) (driver.Conn, error) {
+	ledgerMu.Lock()
+	defer ledgerMu.Unlock()
+	return &ledgerConn{db: ledgers[name]}, nil
+}
+
+func openLedgerDB(t *testing.T) (*sql.DB, *ledgerDB) {
+	t.Helper()
+	ledgerOnce.Do(func() { sql.Register("batchsql-ledger", ledgerDriver{}) })
+	l := &ledgerDB{batches: map[string]bool{}}
+	ledgerMu.Lock()
+	ledgers[t.Name()] = l
+	ledgerMu.Unlock()
+	db, err := sql.Open("batchsql-ledger", t.Name())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, l
+}
+
+type ledgerConn struct {
+	db *ledgerDB
+	tx *ledgerTx
+}
+
+type ledgerTx struct {
+	conn    *ledgerConn
+	batches []string
+	rows    int
+}
+
+func (c *ledgerConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *ledgerConn) Close() error                        { return nil }
+func (c *ledgerConn) Begin() (driver.Tx, error) {
+	c.tx = &ledgerTx{conn: c}
+	return c.tx, nil
+}
+
+func (c *ledgerConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	if strings.Contains(query, batchsql.DefaultIdempotencyTable) {
+		id := args[0].Value.(string)
+		if c.db.batches[id] || (c.tx != nil && slices.Contains(c.tx.batches, id)) {
+			return driver.RowsAffected(0), nil
+		}
+		if c.tx != nil {
+			c.tx.batches = append(c.tx.batches, id)
+		} else {
+			c.db.batches[id] = true
+		}
+		return driver.RowsAffected(1), nil
+	}
+	if c.tx != nil {
+		c.tx.rows += len(args)
+	} else {
+		c.db.rows += len(args)
+	}
+	return driver.RowsAffected(int64(len(args))), nil
+}
+
+func (tx *ledgerTx) Commit() error {
+	db := tx.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tx.conn.tx = nil
+	for _, id := range tx.batches {
+		db.batches[id] = true
+	}
+	db.rows += tx.rows
+	if db.commitFailures > 0 {
+		db.commitFailures--
+		return errors.New("read: connection reset by peer")
+	}
+	return nil
+}
+
+func (tx *ledgerTx) Rollback() error {
+	tx.conn.tx = nil
+	return nil
+}
+
+func (l *ledgerDB) snapshot() (batches, rows int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.batches), l.rows
+}
+
+func TestIdempotency_RetryAfterCommittedNetworkErrorIsSkipped(t *testing.T) {
+	db, ledger := openLedgerDB(t)
+	ledger.commitFailures = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewSQLiteBatchSQL(ctx, db, batchsql.PipelineConfig{
+		BufferSize:    10,
+		FlushSize:     3,
+		FlushInterval: time.Hour,
+		Retry:         batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond, MaxBackoff: time.Millisecond},
+		Idempotency:   batchsql.IdempotencyConfig{Enabled: true},
+	})
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 3; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	waitRowsWritten(t, batch, 3)
+
+	if batches, rows := ledger.snapshot(); batches != 1 || rows != 3 {
+		t.Fatalf("expected 1 recorded batch and 3 rows, got batches=%d rows=%d", batches, rows)
+	}
+	if s := batch.Stats(); s.Retried != 1 {
+		t.Fatalf("expected the failed commit to be retried once, got %d", s.Retried)
+	}
+}
+
+func TestIdempotency_BatchIDAndProcessor(t *testing.T) {
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": int64(1)}}
+	ops, err := batchsql.NewSQLBatchProcessor(nil, batchsql.DefaultMySQLDriver).GenerateOperations(context.Background(), schema, data)
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if a, b := batchsql.NewBatchID(), batchsql.NewBatchID(); a == b || len(a) != 32 {
+		t.Fatalf("expected distinct 32-char batch ids, got %q and %q", a, b)
+	}
+
+	db, ledger := openLedgerDB(t)
+	proc := batchsql.NewSQLBatchProcessor(db, batchsql.DefaultMySQLDriver).WithIdempotency(batchsql.IdempotencyConfig{Enabled: true})
+	// 同一批次 id：第二次执行被跳过
+	ctx := batchsql.WithBatchID(context.Background(), "batch-1")
+	for i := 0; i < 2; i++ {
+		if err := proc.ExecuteOperations(ctx, ops); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	if batches, rows := ledger.snapshot(); batches != 1 || rows != 1 || proc.SkippedBatches() != 1 {
+		t.Fatalf("expected the second execution to be skipped, got batches=%d rows=%d skipped=%d", batches, rows, proc.SkippedBatches())
+	}
+	// 内容相同的不同批次均写入
+	if err := proc.ExecuteOperations(context.Background(), ops); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if batches, rows := ledger.snapshot(); batches != 2 || rows != 2 {
+		t.Fatalf("expected an identical batch with a new id to be written, got batches=%d rows=%d", batches, rows)
+	}
+
+	custom := batchsql.NewSQLBatchProcessor(db, plainDriver{}).WithIdempotency(batchsql.IdempotencyConfig{Enabled: true})
+	if err := custom.ExecuteOperations(context.Background(), ops); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported for a driver without GenerateMarkSQL, got %v", err)
+	}
+}
+
+func TestIdempotency_InvalidTableIsRejected(t *testing.T) {
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": int64(1)}}
+	db, ledger := openLedgerDB(t)
+	for _, table := range []string{"batches; DROP TABLE events", "`batches`", "ops.", "1batches"} {
+		proc := batchsql.NewSQLBatchProcessor(db, batchsql.DefaultMySQLDriver).WithIdempotency(batchsql.IdempotencyConfig{Enabled: true, Table: table})
+		ops, err := proc.GenerateOperations(context.Background(), schema, data)
+		if err != nil {
+			t.Fatalf("generate: %v", err)
+		}
+		if err := proc.ExecuteOperations(context.Background(), ops); !errors.Is(err, batchsql.ErrInvalidSchema) {
+			t.Fatalf("expected ErrInvalidSchema for idempotency table %q, got %v", table, err)
+		}
+	}
+	if batches, rows := ledger.snapshot(); batches != 0 || rows != 0 {
+		t.Fatalf("invalid table must not reach the database, got batches=%d rows=%d", batches, rows)
+	}
+
+	// 限定库名的表名可用
+	proc := batchsql.NewSQLBatchProcessor(db, batchsql.DefaultMySQLDriver).WithIdempotency(batchsql.IdempotencyConfig{Enabled: true, Table: "ops.batchsql_batches"})
+	ops, _ := proc.GenerateOperations(context.Background(), schema, data)
+	if err := proc.ExecuteOperations(context.Background(), ops); err != nil {
+		t.Fatalf("execute with qualified table: %v", err)
+	}
+}
+
+func TestIdempotency_SpillReplayKeepsBatchID(t *testing.T) {
+	db, ledger := openLedgerDB(t)
+	// 首次提交已生效但返回网络错误：批次落盘，重放时沿用批次 id 而被跳过
+	ledger.commitFailures = 1
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proc := batchsql.NewSQLBatchProcessor(db, batchsql.DefaultSQLiteDriver).WithIdempotency(batchsql.IdempotencyConfig{Enabled: true})
+	exec := batchsql.NewThrottledBatchExecutor(proc)
+	if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), Backoff: batchsql.ConstantBackoff{Delay: 5 * time.Millisecond}}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(ctx, schema, []map[string]any{{"id": int64(1)}, {"id": int64(2)}}); err != nil {
+		t.Fatalf("expected the batch to be spilled, got %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for proc.SkippedBatches() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if batches, rows := ledger.snapshot(); batches != 1 || rows != 2 || proc.SkippedBatches() != 1 {
+		t.Fatalf("expected the replayed batch to be skipped, got batches=%d rows=%d skipped=%d", batches, rows, proc.SkippedBatches())
+	}
+}
+
+// crashAfterCommitExecutor 批次提交后模拟进程崩溃：取消 BatchSQL 的 ctx 并等待 WAL 关闭，使 checkpoint 无法写入
+type crashAfterCommitExecutor struct {
+	batchsql.BatchExecutor
+	crash context.CancelFunc
+}
+
+func (e crashAfterCommitExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	if err := e.BatchExecutor.ExecuteBatch(ctx, schema, data); err != nil {
+		return err
+	}
+	e.crash()
+	time.Sleep(50 * time.Millisecond)
+	return nil
+}
+
+func TestIdempotency_WALReplayAfterCrashBeforeCheckpointIsSkipped(t *testing.T) {
+	db, ledger := openLedgerDB(t)
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	cfg := batchsql.PipelineConfig{
+		BufferSize:    10,
+		FlushSize:     3,
+		FlushInterval: time.Hour,
+		Idempotency:   batchsql.IdempotencyConfig{Enabled: true},
+	}
+	newExecutor := func() (*batchsql.SQLBatchProcessor, batchsql.BatchExecutor) {
+		proc := batchsql.NewSQLBatchProcessor(db, batchsql.DefaultSQLiteDriver).WithIdempotency(cfg.Idempotency)
+		return proc, batchsql.NewThrottledBatchExecutor(proc)
+	}
+
+	// 第一次运行：批次已提交，checkpoint 前崩溃
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	_, exec1 := newExecutor()
+	batch1 := batchsql.NewBatchSQLWithConfig(ctx1, cfg, crashAfterCommitExecutor{BatchExecutor: exec1, crash: cancel1})
+	if _, err := batch1.OpenWAL(batchsql.WALConfig{Dir: dir}); err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := batch1.Submit(ctx1, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for batch1.Stats().RowsWritten < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if batches, rows := ledger.snapshot(); batches != 1 || rows != 3 {
+		t.Fatalf("expected the first run to commit 3 rows, got batches=%d rows=%d", batches, rows)
+	}
+
+	// 第二次运行：重放沿用原批次边界与 id，被去重表跳过
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	proc2, exec2 := newExecutor()
+	batch2 := batchsql.NewBatchSQLWithConfig(ctx2, cfg, exec2)
+	if n, err := batch2.OpenWAL(batchsql.WALConfig{Dir: dir}); err != nil || n != 3 {
+		t.Fatalf("expected 3 replayed requests, got n=%d err=%v", n, err)
+	}
+	if batches, rows := ledger.snapshot(); batches != 1 || rows != 3 || proc2.SkippedBatches() != 1 {
+		t.Fatalf("expected the replayed batch to be skipped, got batches=%d rows=%d skipped=%d", batches, rows, proc2.SkippedBatches())
+	}
+	cancel2()
+	time.Sleep(20 * time.Millisecond)
+
+	// 第三次运行：跳过的批次已确认，不再重放
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	_, exec3 := newExecutor()
+	if n, err := batchsql.NewBatchSQLWithConfig(ctx3, cfg, exec3).OpenWAL(batchsql.WALConfig{Dir: dir}); err != nil || n != 0 {
+		t.Fatalf("expected nothing to replay, got n=%d err=%v", n, err)
+	}
+}
+
+// plainDriver 未实现 IdempotencyDriver 的自定义驱动
+type plainDriver struct{}
+
+func (plainDriver) GenerateInsertSQL(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (string, []any, error) {
+	return batchsql.DefaultMySQLDriver.GenerateInsertSQL(ctx, schema, data)
+}
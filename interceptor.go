@@ -0,0 +1,75 @@
+package batchsql
+
+import (
+	"context"
+	"time"
+)
+
+// BatchExecutorFunc 函数适配器：将普通函数作为 BatchExecutor 使用
+type BatchExecutorFunc func(ctx context.Context, schema *Schema, data []map[string]any) error
+
+func (f BatchExecutorFunc) ExecuteBatch(ctx context.Context, schema *Schema, data []map[string]any) error {
+	return f(ctx, schema, data)
+}
+
+// Interceptor 执行器拦截器：包装下一个 BatchExecutor，可用于审计、改写数据、短路或自定义观测
+type Interceptor func(next BatchExecutor) BatchExecutor
+
+// chainedExecutor 拦截器链包装后的执行器；通过 Unwrap 暴露被包装的执行器，保证能力探测可穿透
+type chainedExecutor struct {
+	BatchExecutor
+	inner BatchExecutor
+}
+
+func (c *chainedExecutor) Unwrap() BatchExecutor { return c.inner }
+
+// ChainExecutor 以拦截器包装任意执行器；interceptors[0] 位于最外层
+// 返回值可直接传给 NewBatchSQL，MetricsReporter/ConcurrencyLimit 等能力仍可被探测
+func ChainExecutor(executor BatchExecutor, interceptors ...Interceptor) BatchExecutor {
+	if len(interceptors) == 0 {
+		return executor
+	}
+	return &chainedExecutor{BatchExecutor: chainInterceptors(executor, interceptors), inner: executor}
+}
+
+func chainInterceptors(executor BatchExecutor, interceptors []Interceptor) BatchExecutor {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		executor = interceptors[i](executor)
+	}
+	return executor
+}
+
+// executorAs 沿 Unwrap 链查找实现了指定能力接口的执行器
+func executorAs[T any](executor BatchExecutor) (T, bool) {
+	for executor != nil {
+		if v, ok := executor.(T); ok {
+			return v, true
+		}
+		u, ok := executor.(interface{ Unwrap() BatchExecutor })
+		if !ok {
+			break
+		}
+		executor = u.Unwrap()
+	}
+	var zero T
+	return zero, false
+}
+
+// AttemptInfo 单次执行尝试的上下文信息（传给 BatchHooks）
+type AttemptInfo struct {
+	Schema     *Schema
+	Rows       int
+	Attempt    int           // 尝试序号（从 1 开始）
+	Operations Operations    // 生成的操作（生成失败时为 nil）
+	Err        error         // 尝试结果（仅 After）
+	Duration   time.Duration // 尝试耗时（仅 After）
+}
+
+// BatchHooks 执行尝试前后的钩子（均为可选）
+// Before 在操作生成成功后、执行前调用；After 在每次尝试结束后调用（含生成失败）
+// 两者收到同一个单次尝试的 ctx（含 AttemptTimeout 截止时间与 attempt span）
+// 钩子在执行路径上同步调用，应保持轻量
+type BatchHooks struct {
+	Before func(ctx context.Context, info AttemptInfo)
+	After  func(ctx context.Context, info AttemptInfo)
+}
@@ -0,0 +1,153 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestInterceptors_OrderRewriteAndShortCircuit(t *testing.T) {
+	var mu sync.Mutex
+	var trace []string
+	record := func(s string) {
+		mu.Lock()
+		trace = append(trace, s)
+		mu.Unlock()
+	}
+	named := func(name string) batchsql.Interceptor {
+		return func(next batchsql.BatchExecutor) batchsql.BatchExecutor {
+			return batchsql.BatchExecutorFunc(func(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+				record(name + ":before")
+				err := next.ExecuteBatch(ctx, schema, data)
+				record(name + ":after")
+				return err
+			})
+		}
+	}
+	// 改写数据：丢弃 skip=true 的行
+	filter := func(next batchsql.BatchExecutor) batchsql.BatchExecutor {
+		return batchsql.BatchExecutorFunc(func(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+			kept := data[:0:0]
+			for _, row := range data {
+				if row["skip"] != true {
+					kept = append(kept, row)
+				}
+			}
+			return next.ExecuteBatch(ctx, schema, kept)
+		})
+	}
+
+	var rows atomic.Int32
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithInterceptors(named("outer"), named("inner"), filter).
+		WithHooks(batchsql.BatchHooks{Before: func(ctx context.Context, info batchsql.AttemptInfo) { rows.Add(int32(info.Rows)) }})
+
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id", "skip")
+	data := []map[string]any{{"id": 1, "skip": false}, {"id": 2, "skip": true}}
+	if err := exec.ExecuteBatch(context.Background(), schema, data); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	want := []string{"outer:before", "inner:before", "inner:after", "outer:after"}
+	if len(trace) != len(want) {
+		t.Fatalf("trace: got %v want %v", trace, want)
+	}
+	for i := range want {
+		if trace[i] != want[i] {
+			t.Fatalf("trace: got %v want %v", trace, want)
+		}
+	}
+	if got := rows.Load(); got != 1 {
+		t.Fatalf("interceptor should rewrite data before execution, rows=%d", got)
+	}
+
+	// 短路：拦截器直接返回错误，不进入执行
+	denied := errors.New("denied")
+	exec.WithInterceptors(func(next batchsql.BatchExecutor) batchsql.BatchExecutor {
+		return batchsql.BatchExecutorFunc(func(context.Context, *batchsql.Schema, []map[string]any) error { return denied })
+	})
+	rows.Store(0)
+	if err := exec.ExecuteBatch(context.Background(), schema, data); !errors.Is(err, denied) {
+		t.Fatalf("expected short-circuit error, got %v", err)
+	}
+	if rows.Load() != 0 {
+		t.Fatalf("short-circuited batch must not execute")
+	}
+}
+
+func TestHooks_ReceiveEachAttempt(t *testing.T) {
+	p := &fakeProcessor{failCount: 1, failReason: "deadlock"}
+	var mu sync.Mutex
+	var before, after []batchsql.AttemptInfo
+	exec := batchsql.NewThrottledBatchExecutor(p).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond}).
+		WithHooks(batchsql.BatchHooks{
+			Before: func(ctx context.Context, info batchsql.AttemptInfo) {
+				mu.Lock()
+				before = append(before, info)
+				mu.Unlock()
+			},
+			After: func(ctx context.Context, info batchsql.AttemptInfo) {
+				mu.Lock()
+				after = append(after, info)
+				mu.Unlock()
+			},
+		})
+
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}, {"id": 2}}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+	if len(before) != 2 || len(after) != 2 {
+		t.Fatalf("expected hooks per attempt, before=%d after=%d", len(before), len(after))
+	}
+	for i, info := range after {
+		if info.Schema != schema || info.Rows != 2 || info.Attempt != i+1 {
+			t.Fatalf("unexpected attempt info %d: %+v", i, info)
+		}
+	}
+	if after[0].Err == nil || after[1].Err != nil {
+		t.Fatalf("after hook should carry attempt results: %v, %v", after[0].Err, after[1].Err)
+	}
+}
+
+type batchSizeMetrics struct {
+	batchsql.NoopMetricsReporter
+	batches atomic.Int32
+}
+
+func (m *batchSizeMetrics) ObserveBatchSize(int) { m.batches.Add(1) }
+
+func TestChainExecutor_CapabilitiesStillProbed(t *testing.T) {
+	m := &batchSizeMetrics{}
+	inner := batchsql.NewThrottledBatchExecutor(okProcessor{}).WithMetricsReporter(m)
+	var calls atomic.Int32
+	exec := batchsql.ChainExecutor(inner, func(next batchsql.BatchExecutor) batchsql.BatchExecutor {
+		return batchsql.BatchExecutorFunc(func(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+			calls.Add(1)
+			return next.ExecuteBatch(ctx, schema, data)
+		})
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQL(ctx, 10, 1, 10*time.Millisecond, exec)
+	schema := batchsql.NewSchema("t", batchsql.ConflictIgnore, "id")
+	if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for calls.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if calls.Load() == 0 {
+		t.Fatalf("interceptor not invoked")
+	}
+	if m.batches.Load() == 0 {
+		t.Fatalf("BatchSQL should find the wrapped executor's reporter through the chain")
+	}
+}
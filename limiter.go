@@ -0,0 +1,188 @@
+package batchsql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// concurrencyLimiter 可在运行时调整上限的并发限制器
+// 与固定容量的信号量通道不同，上限可随时调整：调小时已占用的令牌自然归还，不会中断在途批次
+type concurrencyLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	inUse   int
+	changed chan struct{} // 令牌释放或上限变化时关闭并重建，用于唤醒等待者
+}
+
+func newConcurrencyLimiter(limit int) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		limit:   limit,
+		changed: make(chan struct{}),
+	}
+}
+
+// acquire 占用一个令牌；ctx 取消时返回 ctx.Err()
+func (l *concurrencyLimiter) acquire(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		if l.inUse < l.limit {
+			l.inUse++
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release 归还一个令牌
+func (l *concurrencyLimiter) release() {
+	l.mu.Lock()
+	l.inUse--
+	l.broadcastLocked()
+	l.mu.Unlock()
+}
+
+// setLimit 调整上限
+func (l *concurrencyLimiter) setLimit(limit int) {
+	l.mu.Lock()
+	l.limit = limit
+	l.broadcastLocked()
+	l.mu.Unlock()
+}
+
+// currentLimit 返回当前上限
+func (l *concurrencyLimiter) currentLimit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit
+}
+
+func (l *concurrencyLimiter) broadcastLocked() {
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// AdaptiveConcurrencyConfig 自适应并发（AIMD）配置
+/*
+策略：
+- 加性增长：批次成功且执行耗时不超过 TargetLatency 时累计成功数，每累计“当前上限”个成功批次，上限 +IncreaseStep
+- 乘性回退：尝试失败且错误原因（重试分类器返回的 reason）属于 BackoffReasons 时，上限 ×DecreaseFactor
+  同一冷却期（TargetLatency）内最多回退一次，避免并发批次同时失败导致上限被连续削减
+- 上限始终处于 [MinLimit, MaxLimit]，变化时通过 MetricsReporter.SetConcurrency 上报
+*/
+type AdaptiveConcurrencyConfig struct {
+	MinLimit      int           // 最小并发（默认 1）
+	MaxLimit      int           // 最大并发（默认 64）
+	InitialLimit  int           // 初始并发（默认 MinLimit）
+	TargetLatency time.Duration // 批次执行耗时目标（默认 500ms）
+	IncreaseStep  int           // 加性增长步长（默认 1）
+	// DecreaseFactor 乘性回退系数，取值 (0,1)（默认 0.5）
+	DecreaseFactor float64
+	// BackoffReasons 触发回退的错误原因（默认 timeout / deadlock / lock_timeout）
+	BackoffReasons []string
+}
+
+// adaptiveLimiter AIMD 并发控制器
+type adaptiveLimiter struct {
+	*concurrencyLimiter
+	cfg       AdaptiveConcurrencyConfig
+	reasons   map[string]struct{}
+	onChange  func(limit int)
+	mu        sync.Mutex
+	successes int
+	lastDrop  time.Time
+}
+
+func newAdaptiveLimiter(cfg AdaptiveConcurrencyConfig, onChange func(limit int)) *adaptiveLimiter {
+	if cfg.MinLimit <= 0 {
+		cfg.MinLimit = 1
+	}
+	if cfg.MaxLimit <= 0 {
+		cfg.MaxLimit = 64
+	}
+	if cfg.MaxLimit < cfg.MinLimit {
+		cfg.MaxLimit = cfg.MinLimit
+	}
+	if cfg.InitialLimit < cfg.MinLimit || cfg.InitialLimit > cfg.MaxLimit {
+		cfg.InitialLimit = cfg.MinLimit
+	}
+	if cfg.TargetLatency <= 0 {
+		cfg.TargetLatency = 500 * time.Millisecond
+	}
+	if cfg.IncreaseStep <= 0 {
+		cfg.IncreaseStep = 1
+	}
+	if cfg.DecreaseFactor <= 0 || cfg.DecreaseFactor >= 1 {
+		cfg.DecreaseFactor = 0.5
+	}
+	if len(cfg.BackoffReasons) == 0 {
+		cfg.BackoffReasons = []string{"timeout", "deadlock", "lock_timeout"}
+	}
+	reasons := make(map[string]struct{}, len(cfg.BackoffReasons))
+	for _, r := range cfg.BackoffReasons {
+		reasons[r] = struct{}{}
+	}
+	return &adaptiveLimiter{
+		concurrencyLimiter: newConcurrencyLimiter(cfg.InitialLimit),
+		cfg:                cfg,
+		reasons:            reasons,
+		onChange:           onChange,
+	}
+}
+
+// onSuccess 批次成功：耗时达标时累计，满一个窗口后加性增长
+func (a *adaptiveLimiter) onSuccess(latency time.Duration) {
+	if latency > a.cfg.TargetLatency {
+		return
+	}
+	a.mu.Lock()
+	limit := a.currentLimit()
+	a.successes++
+	if a.successes < limit || limit >= a.cfg.MaxLimit {
+		a.mu.Unlock()
+		return
+	}
+	a.successes = 0
+	next := min(limit+a.cfg.IncreaseStep, a.cfg.MaxLimit)
+	a.setLimit(next)
+	a.mu.Unlock()
+	a.notify(next)
+}
+
+// onFailure 尝试失败：原因命中回退集合时乘性回退（带冷却）
+func (a *adaptiveLimiter) onFailure(reason string) {
+	if _, ok := a.reasons[reason]; !ok {
+		return
+	}
+	a.mu.Lock()
+	now := time.Now()
+	if now.Sub(a.lastDrop) < a.cfg.TargetLatency {
+		a.mu.Unlock()
+		return
+	}
+	a.lastDrop = now
+	a.successes = 0
+	limit := a.currentLimit()
+	next := max(int(float64(limit)*a.cfg.DecreaseFactor), a.cfg.MinLimit)
+	if next == limit {
+		a.mu.Unlock()
+		return
+	}
+	a.setLimit(next)
+	a.mu.Unlock()
+	a.notify(next)
+}
+
+func (a *adaptiveLimiter) notify(limit int) {
+	if a.onChange != nil {
+		a.onChange(limit)
+	}
+}
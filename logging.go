@@ -0,0 +1,86 @@
+package batchsql
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// LogSampling 高频日志事件采样（按事件名分别计数）
+// 每个 Tick 周期内，同一事件先输出前 First 条，之后每 Thereafter 条输出一条；First <= 0 表示不采样
+// 仅作用于高频事件（重试、快速拒绝、取消、成功明细等），最终失败与状态变迁始终输出
+type LogSampling struct {
+	First      int
+	Thereafter int
+	Tick       time.Duration
+}
+
+// DefaultLogSampling 设置日志器时默认使用的采样配置
+var DefaultLogSampling = LogSampling{First: 10, Thereafter: 100, Tick: time.Second}
+
+// logSampler 按事件名在固定周期内计数
+type logSampler struct {
+	cfg         LogSampling
+	mu          sync.Mutex
+	windowStart time.Time
+	counts      map[string]int
+}
+
+func newLogSampler(cfg LogSampling) *logSampler {
+	if cfg.First <= 0 {
+		return nil
+	}
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Second
+	}
+	return &logSampler{cfg: cfg, windowStart: time.Now(), counts: make(map[string]int)}
+}
+
+// allow 判断本次事件是否输出
+func (s *logSampler) allow(event string) bool {
+	if s == nil {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now := time.Now(); now.Sub(s.windowStart) >= s.cfg.Tick {
+		s.windowStart = now
+		clear(s.counts)
+	}
+	s.counts[event]++
+	n := s.counts[event]
+	if n <= s.cfg.First {
+		return true
+	}
+	return s.cfg.Thereafter > 0 && (n-s.cfg.First)%s.cfg.Thereafter == 0
+}
+
+// eventLogger 可选结构化日志（零值为关闭）
+type eventLogger struct {
+	logger  *slog.Logger
+	sampler *logSampler
+}
+
+func newEventLogger(logger *slog.Logger, sampling LogSampling) eventLogger {
+	if logger == nil {
+		return eventLogger{}
+	}
+	return eventLogger{logger: logger, sampler: newLogSampler(sampling)}
+}
+
+// log 输出事件（未设置日志器或级别未启用时为空操作）
+func (l eventLogger) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if l.logger == nil || !l.logger.Enabled(ctx, level) {
+		return
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// sampled 输出高频事件（受采样限制）
+func (l eventLogger) sampled(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if l.logger == nil || !l.logger.Enabled(ctx, level) || !l.sampler.allow(msg) {
+		return
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
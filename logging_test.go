@@ -0,0 +1,129 @@
+package batchsql_test
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// recordHandler 记录所有日志事件（消息 + 属性）
+type recordHandler struct {
+	mu      sync.Mutex
+	records []map[string]any
+}
+
+func (h *recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+func (h *recordHandler) WithAttrs([]slog.Attr) slog.Handler       { return h }
+func (h *recordHandler) WithGroup(string) slog.Handler            { return h }
+
+func (h *recordHandler) Handle(_ context.Context, r slog.Record) error {
+	rec := map[string]any{"msg": r.Message, "level": r.Level}
+	r.Attrs(func(a slog.Attr) bool {
+		rec[a.Key] = a.Value.Any()
+		return true
+	})
+	h.mu.Lock()
+	h.records = append(h.records, rec)
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *recordHandler) byMsg(msg string) []map[string]any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var out []map[string]any
+	for _, r := range h.records {
+		if r["msg"] == msg {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func TestLogger_ExecutorRetryAndFinalFailure(t *testing.T) {
+	h := &recordHandler{}
+	exec := batchsql.NewThrottledBatchExecutor(alwaysRetryProcessor{}).
+		WithLogger(slog.New(h)).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond})
+
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}, {"id": 2}}); err == nil {
+		t.Fatalf("expected failure")
+	}
+
+	retries := h.byMsg("batchsql: retrying batch")
+	if len(retries) != 2 {
+		t.Fatalf("expected 2 retry events, got %d", len(retries))
+	}
+	if retries[1]["table"] != "events" || retries[1]["rows"] != int64(2) || retries[1]["attempt"] != int64(2) || retries[1]["reason"] == "" {
+		t.Fatalf("unexpected retry event attrs: %v", retries[1])
+	}
+	failed := h.byMsg("batchsql: batch failed")
+	if len(failed) != 1 || failed[0]["level"] != slog.LevelError || failed[0]["attempt"] != int64(3) {
+		t.Fatalf("expected one error-level final failure at attempt 3, got %v", failed)
+	}
+	if _, ok := failed[0]["duration"].(time.Duration); !ok {
+		t.Fatalf("final failure should carry duration: %v", failed[0])
+	}
+}
+
+func TestLogger_SamplingLimitsHighFrequencyEvents(t *testing.T) {
+	h := &recordHandler{}
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithLogSampling(batchsql.LogSampling{First: 3, Thereafter: 10, Tick: time.Minute}).
+		WithLogger(slog.New(h))
+
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 25; i++ {
+		if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": i}}); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	// 前 3 条 + 第 13、23 条
+	if got := len(h.byMsg("batchsql: batch executed")); got != 5 {
+		t.Fatalf("expected 5 sampled success events, got %d", got)
+	}
+
+	h2 := &recordHandler{}
+	exec.WithLogger(slog.New(h2)).WithLogSampling(batchsql.LogSampling{})
+	for i := 0; i < 25; i++ {
+		_ = exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": i}})
+	}
+	if got := len(h2.byMsg("batchsql: batch executed")); got != 25 {
+		t.Fatalf("sampling disabled should log every event, got %d", got)
+	}
+}
+
+func TestLogger_BatchSQLInheritsExecutorLogger(t *testing.T) {
+	h := &recordHandler{}
+	exec := batchsql.NewThrottledBatchExecutor(nonRetryProcessor{}).WithLogger(slog.New(h))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batch := batchsql.NewBatchSQL(ctx, 10, 1, 10*time.Millisecond, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 1)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(h.byMsg("batchsql: batch dropped")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	dropped := h.byMsg("batchsql: batch dropped")
+	if len(dropped) != 1 || dropped[0]["table"] != "events" || dropped[0]["rows"] != int64(1) {
+		t.Fatalf("expected dropped batch event, got %v", dropped)
+	}
+
+	cancel()
+	deadline = time.Now().Add(2 * time.Second)
+	for len(h.byMsg("batchsql: closed, rejecting further submits")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	_ = batch.Submit(context.Background(), batchsql.NewRequest(schema).SetInt64("id", 2))
+	if len(h.byMsg("batchsql: submit rejected, batch closed")) != 1 {
+		t.Fatalf("expected submit rejection to be logged")
+	}
+}
@@ -0,0 +1,172 @@
+package batchsql
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+)
+
+// MemoryConfig 按估算字节数约束批次与缓冲（零值=关闭，仅按请求数）
+/*
+说明：
+- 字节数由 Request.EstimatedSize 估算（各列值之和，[]byte/string 按长度计）
+- FlushBytes：管道中已送入、尚未刷新的请求累计字节达到阈值时立即刷新（不等待 FlushSize / FlushInterval）；
+  攒批得到的批次再按累计字节切分，每个执行批次不超过阈值（单个请求超过阈值时独占一批），
+  同一 schema 的子批次按顺序执行
+  触发阈值是近似值：刷新函数异步运行，已送入、尚未刷新的字节与当前批次的请求数均按“送入 - 已交给刷新函数”估算，
+  刷新滞后时可能提前或推迟一次刷新、补齐请求数偏差；执行批次的字节上限由切分保证，不受影响
+- MaxBufferedBytes：已入队、尚未执行结束的请求总字节上限；超出时 Submit 阻塞等待释放，
+  Shed 为 true 或 TrySubmit 时直接返回 ErrMemoryBudgetExceeded；缓冲为空时单个超大请求仍可入队
+- 被拒绝的请求计入 Stats.Dropped，并通过 IncSubmitRejected("memory_budget") 上报
+- SubmitMany 直接执行的整批不经过缓冲，不占用预算
+*/
+type MemoryConfig struct {
+	FlushBytes       int64
+	MaxBufferedBytes int64
+	Shed             bool
+}
+
+// memoryBudget 已缓冲字节数计数；释放时唤醒所有等待者
+type memoryBudget struct {
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{} // 有等待者时创建，释放时关闭
+}
+
+// tryAcquire 预算足够（或缓冲为空）时计入 n；否则返回下一次释放的通知通道
+func (m *memoryBudget) tryAcquire(n, limit int64) (bool, <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.used == 0 || m.used+n <= limit {
+		m.used += n
+		return true, nil
+	}
+	if m.freed == nil {
+		m.freed = make(chan struct{})
+	}
+	return false, m.freed
+}
+
+func (m *memoryBudget) release(n int64) {
+	if n == 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.used -= n
+	if m.freed != nil {
+		close(m.freed)
+		m.freed = nil
+	}
+}
+
+func (m *memoryBudget) bufferedBytes() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.used
+}
+
+// reserveMemory 入队前按内存预算为请求预留字节数；try 为 true 时不等待
+func (b *BatchSQL) reserveMemory(ctx context.Context, schema *Schema, request *Request, try bool) error {
+	limit := b.config.Memory.MaxBufferedBytes
+	if limit <= 0 {
+		return nil
+	}
+	size := int64(request.EstimatedSize())
+	for {
+		ok, freed := b.memory.tryAcquire(size, limit)
+		if ok {
+			request.memSize = size
+			return nil
+		}
+		if try || b.config.Memory.Shed {
+			b.stats.table(schema.Name).dropped.Add(1)
+			if xr, ok := b.metricsReporter.(ExtendedMetricsReporter); ok {
+				xr.IncSubmitRejected("memory_budget")
+			}
+			b.logger.sampled(ctx, slog.LevelWarn, "batchsql: request dropped, memory budget exceeded",
+				slog.String("table", schema.Name), slog.Int64("bytes", size), slog.Int64("budget", limit))
+			return ErrMemoryBudgetExceeded
+		}
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-b.ctx.Done():
+			return context.Canceled
+		}
+	}
+}
+
+// releaseMemory 释放请求占用的内存预算（未占用时为空操作）
+func (b *BatchSQL) releaseMemory(requests []*Request) {
+	var n int64
+	for _, r := range requests {
+		n += r.memSize
+		r.memSize = 0
+	}
+	b.memory.release(n)
+}
+
+// splitByBytes 按 FlushBytes 切分同一 schema 的请求（保持顺序）
+func (b *BatchSQL) splitByBytes(requests []*Request) [][]*Request {
+	limit := b.config.Memory.FlushBytes
+	if limit <= 0 || len(requests) < 2 {
+		return [][]*Request{requests}
+	}
+	var (
+		chunks [][]*Request
+		start  int
+		bytes  int64
+	)
+	for i, r := range requests {
+		size := int64(r.EstimatedSize())
+		if i > start && bytes+size > limit {
+			chunks = append(chunks, requests[start:i])
+			start, bytes = i, 0
+		}
+		bytes += size
+	}
+	return append(chunks, requests[start:])
+}
+
+// sentBytes 记录送入管道的请求字节数；达到 FlushBytes 时以空请求补齐当前批次，使其立即刷新
+// sent - taken 只是当前批次请求数的估算（taken 由异步的刷新函数累加），补齐数可能偏差
+// 调用方持有 st.mu 读锁（管道未退役）；补齐为非阻塞发送，通道已满时放弃（管道正忙于刷新）
+func (st *pipelineStage) sentBytes(r *Request) {
+	if st.flushBytes <= 0 {
+		return
+	}
+	if st.pendingBytes.Add(int64(r.EstimatedSize())) < st.flushBytes || !st.forcing.CompareAndSwap(false, true) {
+		return
+	}
+	flushSize := max(int64(st.config.FlushSize), 1)
+	rem := (st.sent.Load() - st.taken.Load()) % flushSize
+	if rem == 0 {
+		// 当前批次已满，会自行刷新
+		return
+	}
+	for i := rem; i < flushSize; i++ {
+		select {
+		case st.pipeline.DataChan() <- nil:
+			st.sent.Add(1)
+		default:
+			return
+		}
+	}
+}
+
+// flushedBytes 批次交给刷新函数时扣除其字节数，并允许下一次补齐
+func (st *pipelineStage) flushedBytes(batchData []*Request) {
+	if st.flushBytes <= 0 {
+		return
+	}
+	var n int64
+	for _, r := range batchData {
+		if r != nil {
+			n += int64(r.EstimatedSize())
+		}
+	}
+	st.pendingBytes.Add(-n)
+	st.forcing.Store(false)
+}
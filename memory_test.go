@@ -0,0 +1,137 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// gateExecutor 在 release 关闭前阻塞所有批次，并记录各批次行数
+type gateExecutor struct {
+	release chan struct{}
+	mu      sync.Mutex
+	sizes   []int
+}
+
+func (e *gateExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	<-e.release
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.sizes = append(e.sizes, len(data))
+	return nil
+}
+
+func blobRequest(schema *batchsql.Schema, id int64, size int) *batchsql.Request {
+	return batchsql.NewRequest(schema).SetInt64("id", id).SetBytes("payload", make([]byte, size))
+}
+
+func waitBufferedBytes(t *testing.T, batch *batchsql.BatchSQL, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for batch.Stats().BufferedBytes != want && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := batch.Stats().BufferedBytes; got != want {
+		t.Fatalf("expected %d buffered bytes, got %d", want, got)
+	}
+}
+
+func TestMemory_EstimatedSizeAndFlushBytes(t *testing.T) {
+	schema := batchsql.NewSchema("docs", batchsql.ConflictIgnore, "id", "payload")
+	if n := blobRequest(schema, 1, 992).SetString("note", "abc").EstimatedSize(); n != 1003 {
+		t.Fatalf("expected estimated size 1003, got %d", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := &gateExecutor{release: make(chan struct{})}
+	close(exec.release)
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     100,
+		FlushInterval: time.Hour,
+		Memory:        batchsql.MemoryConfig{FlushBytes: 2500},
+	}, exec)
+	// 第 3 个请求使累计字节超过阈值：不等待 FlushSize / FlushInterval 立即刷新，执行时再按字节切分
+	for i := 0; i < 3; i++ {
+		if err := batch.Submit(ctx, blobRequest(schema, int64(i), 992)); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	waitRowsWritten(t, batch, 3)
+
+	exec.mu.Lock()
+	sizes := append([]int(nil), exec.sizes...)
+	exec.mu.Unlock()
+	if len(sizes) != 2 || sizes[0] != 2 || sizes[1] != 1 {
+		t.Fatalf("expected the flushed batch to be split into chunks of 2 and 1 rows, got %v", sizes)
+	}
+
+	// 未达阈值的请求继续留在缓冲中
+	if err := batch.Submit(ctx, blobRequest(schema, 3, 992)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := batch.Stats().RowsWritten; got != 3 {
+		t.Fatalf("expected request below the byte threshold to stay buffered, got %d rows written", got)
+	}
+}
+
+func TestMemory_BudgetShedsOrBlocks(t *testing.T) {
+	schema := batchsql.NewSchema("docs", batchsql.ConflictIgnore, "id", "payload")
+	newBatch := func(t *testing.T, shed bool) (*batchsql.BatchSQL, *gateExecutor) {
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		exec := &gateExecutor{release: make(chan struct{})}
+		batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+			BufferSize:    100,
+			FlushSize:     1,
+			FlushInterval: 10 * time.Millisecond,
+			Memory:        batchsql.MemoryConfig{MaxBufferedBytes: 2500, Shed: shed},
+		}, exec)
+		for i := 0; i < 2; i++ {
+			if err := batch.Submit(ctx, blobRequest(schema, int64(i), 992)); err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+		}
+		return batch, exec
+	}
+
+	t.Run("shed", func(t *testing.T) {
+		batch, exec := newBatch(t, true)
+		if err := batch.Submit(context.Background(), blobRequest(schema, 2, 992)); !errors.Is(err, batchsql.ErrMemoryBudgetExceeded) {
+			t.Fatalf("expected ErrMemoryBudgetExceeded, got %v", err)
+		}
+		if s := batch.Stats(); s.BufferedBytes != 2000 || s.Dropped != 1 {
+			t.Fatalf("unexpected stats: %+v", s)
+		}
+		close(exec.release)
+		waitBufferedBytes(t, batch, 0)
+	})
+
+	t.Run("block", func(t *testing.T) {
+		batch, exec := newBatch(t, false)
+		if err := batch.TrySubmit(context.Background(), blobRequest(schema, 2, 992)); !errors.Is(err, batchsql.ErrMemoryBudgetExceeded) {
+			t.Fatalf("expected TrySubmit to shed, got %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() { done <- batch.Submit(context.Background(), blobRequest(schema, 3, 992)) }()
+		select {
+		case err := <-done:
+			t.Fatalf("submit should block while over budget, got %v", err)
+		case <-time.After(30 * time.Millisecond):
+		}
+
+		close(exec.release)
+		if err := <-done; err != nil {
+			t.Fatalf("submit after release: %v", err)
+		}
+		waitRowsWritten(t, batch, 3)
+		waitBufferedBytes(t, batch, 0)
+	})
+}
@@ -0,0 +1,111 @@
+package batchsql_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// extendedMetrics 记录 ExtendedMetricsReporter 的观测
+type extendedMetrics struct {
+	batchsql.NoopMetricsReporter
+	mu       sync.Mutex
+	rows     map[string]int // table/status -> rows
+	attempts []int
+	payload  map[string]int
+	assemble map[string]int
+	rejected map[string]int
+}
+
+func newExtendedMetrics() *extendedMetrics {
+	return &extendedMetrics{
+		rows:     make(map[string]int),
+		payload:  make(map[string]int),
+		assemble: make(map[string]int),
+		rejected: make(map[string]int),
+	}
+}
+
+func (m *extendedMetrics) AddRows(table string, n int, status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rows[table+"/"+status] += n
+}
+
+func (m *extendedMetrics) ObserveRetryAttempts(table string, attempts int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.attempts = append(m.attempts, attempts)
+}
+
+func (m *extendedMetrics) ObservePayloadBytes(table string, bytes int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.payload[table] += bytes
+}
+
+func (m *extendedMetrics) ObserveTableAssemble(table string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.assemble[table]++
+}
+
+func (m *extendedMetrics) IncSubmitRejected(reason string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rejected[reason]++
+}
+
+func (m *extendedMetrics) rowsFor(key string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.rows[key]
+}
+
+func TestExtendedMetrics_RowsPayloadAssembleAndRejections(t *testing.T) {
+	m := newExtendedMetrics()
+	exec := batchsql.NewThrottledBatchExecutor(&fakeProcessor{failCount: 1, failReason: "deadlock"}).
+		WithMetricsReporter(m).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batch := batchsql.NewBatchSQL(ctx, 10, 3, 10*time.Millisecond, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id", "payload")
+	for i := 0; i < 3; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i)).SetString("payload", "0123456789")); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for m.rowsFor("events/success") < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	m.mu.Lock()
+	if m.rows["events/success"] != 3 {
+		t.Fatalf("expected 3 successful rows, got %v", m.rows)
+	}
+	if len(m.attempts) != 1 || m.attempts[0] != 2 {
+		t.Fatalf("expected one batch with 2 attempts, got %v", m.attempts)
+	}
+	// 每行至少包含 8 字节 id + 10 字节 payload
+	if m.payload["events"] < 3*18 {
+		t.Fatalf("payload bytes too small: %d", m.payload["events"])
+	}
+	if m.assemble["events"] != 1 {
+		t.Fatalf("expected per-table assemble observation, got %v", m.assemble)
+	}
+	m.mu.Unlock()
+
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+	_ = batch.Submit(context.Background(), batchsql.NewRequest(schema).SetInt64("id", 9))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rejected["closed"] != 1 {
+		t.Fatalf("expected submit rejection after close to be counted, got %v", m.rejected)
+	}
+}
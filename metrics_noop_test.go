@@ -21,3 +21,20 @@ func TestNoopMetricsReporter_SafeCalls(t *testing.T) {
 	m.IncError("users", "retry:timeout")
 	// 没有断言，只要不 panic 即可
 }
+
+// 默认 Noop 不实现可选扩展接口，避免未启用时引入额外开销
+func TestNoopMetricsReporter_NoOptionalExtensions(t *testing.T) {
+	var m any = batchsql.NewNoopMetricsReporter()
+	checks := map[string]bool{}
+	_, checks["TracingMetricsReporter"] = m.(batchsql.TracingMetricsReporter)
+	_, checks["ExtendedMetricsReporter"] = m.(batchsql.ExtendedMetricsReporter)
+	_, checks["DedupMetricsReporter"] = m.(batchsql.DedupMetricsReporter)
+	_, checks["CircuitBreakerMetricsReporter"] = m.(batchsql.CircuitBreakerMetricsReporter)
+	_, checks["SpillMetricsReporter"] = m.(batchsql.SpillMetricsReporter)
+	_, checks["AutoTuneMetricsReporter"] = m.(batchsql.AutoTuneMetricsReporter)
+	for name, implemented := range checks {
+		if implemented {
+			t.Fatalf("NoopMetricsReporter should not implement %s", name)
+		}
+	}
+}
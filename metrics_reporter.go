@@ -1,6 +1,9 @@
 package batchsql
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 // MetricsConfig 指标导出配置（Step 1：骨架；默认关闭采样）
 type MetricsConfig struct {
@@ -24,9 +27,86 @@ type MetricsReporter interface {
 	DecInflight()
 }
 
+// DedupMetricsReporter 可选扩展：批内去重折叠的行数
+// 通过类型断言探测，未实现时忽略，保持 MetricsReporter 向后兼容
+type DedupMetricsReporter interface {
+	ObserveDedupCollapsed(table string, n int)
+}
+
+// CircuitBreakerMetricsReporter 可选扩展：熔断器状态变迁
+// key 为表名（按表熔断）或 "*"（全局熔断）
+type CircuitBreakerMetricsReporter interface {
+	ObserveCircuitTransition(key string, from, to CircuitState)
+}
+
+// ExtendedMetricsReporter 可选扩展：行数、重试次数、负载大小、按表组装耗时与提交拒绝
+type ExtendedMetricsReporter interface {
+	// AddRows 批次结束时的行数（status: success/fail）；由 BatchSQL 上报，适用于任意执行器
+	AddRows(table string, n int, status string)
+	// ObserveRetryAttempts 批次最终使用的尝试次数（含首轮）；由 ThrottledBatchExecutor 上报
+	ObserveRetryAttempts(table string, attempts int)
+	// ObservePayloadBytes 批次负载估算字节数（参数值大小之和）
+	ObservePayloadBytes(table string, bytes int)
+	// ObserveTableAssemble 按表组装耗时（ObserveBatchAssemble 的按表版本）
+	ObserveTableAssemble(table string, d time.Duration)
+	// IncSubmitRejected Submit 被拒绝（reason 如 "closed"）
+	IncSubmitRejected(reason string)
+}
+
+// SpillMetricsReporter 可选扩展：落盘队列（EnableSpill）
+type SpillMetricsReporter interface {
+	// SetSpoolDepth 落盘队列深度（批次数与字节数）
+	SetSpoolDepth(batches int, bytes int64)
+	// IncSpillEvent 落盘事件（event: spilled/quota_exceeded/replayed/replay_failed/dead）
+	IncSpillEvent(table string, event string)
+}
+
+// AutoTuneMetricsReporter 可选扩展：FlushSize 自动调优（PipelineConfig.AutoTune）
+type AutoTuneMetricsReporter interface {
+	// SetFlushSize 调优后的 FlushSize
+	SetFlushSize(n int)
+}
+
+// SpanStage 链路追踪阶段
+type SpanStage string
+
+const (
+	SpanSubmit   SpanStage = "submit"   // Submit -> 入队（含排队等待）
+	SpanBatch    SpanStage = "batch"    // 单表批次（组装 + 执行），关联批内各请求的 submit span
+	SpanAssemble SpanStage = "assemble" // 组装/去重
+	SpanExecute  SpanStage = "execute"  // 执行器 ExecuteBatch（含限速、并发等待与重试）
+	SpanAttempt  SpanStage = "attempt"  // 单次执行尝试
+)
+
+// SpanInfo 追踪阶段信息
+type SpanInfo struct {
+	Stage   SpanStage
+	Table   string
+	Rows    int
+	Attempt int               // 仅 SpanAttempt：尝试序号（从 1 开始）
+	Links   []context.Context // 仅 SpanBatch：批内各请求 Submit 时的 ctx（已含 submit span）
+}
+
+// TracingMetricsReporter 可选扩展：链路追踪（NoopMetricsReporter 不实现：未启用时 Submit 不保留 ctx、批次不收集 link）
+// StartSpan 返回派生 ctx（后续阶段以其为父）与结束函数（err 为该阶段结果）
+type TracingMetricsReporter interface {
+	StartSpan(ctx context.Context, info SpanInfo) (context.Context, func(err error))
+}
+
+// startSpan 开始追踪阶段；reporter 未实现 TracingMetricsReporter 时为空操作
+func startSpan(reporter MetricsReporter, ctx context.Context, info SpanInfo) (context.Context, func(error)) {
+	if tr, ok := reporter.(TracingMetricsReporter); ok {
+		return tr.StartSpan(ctx, info)
+	}
+	return ctx, noopEndSpan
+}
+
+func noopEndSpan(error) {}
+
 var _ MetricsReporter = (*NoopMetricsReporter)(nil)
 
 // NoopMetricsReporter 默认关闭时的无操作实现（零开销路径）
+// 仅实现 MetricsReporter：可选扩展接口均不实现，使依赖类型断言的额外统计（负载估算、按表耗时、span 等）在默认路径上跳过
 type NoopMetricsReporter struct{}
 
 func NewNoopMetricsReporter() *NoopMetricsReporter { return &NoopMetricsReporter{} }
@@ -0,0 +1,179 @@
+package batchsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// OrderingMode 批次执行顺序保证模式
+type OrderingMode uint8
+
+const (
+	// OrderingNone 不保证顺序（默认）：同一表的不同批次可能并发、乱序执行
+	OrderingNone OrderingMode = iota
+	// OrderingPerSchema 同一表的批次按提交顺序串行执行，不同表之间并行
+	OrderingPerSchema
+	// OrderingPerKey 同一表内相同分区键的数据按提交顺序串行执行，不同键之间并行
+	OrderingPerKey
+)
+
+// OrderingConfig 顺序保证配置（零值=关闭）
+/*
+实现说明：
+- 提交侧：同一管道内的序号分配与入队原子完成，保证通道顺序即提交顺序
+- 执行侧：各批次按起始序号依次放行到“顺序键”对应的串行队列，同键串行、异键并行
+- 代价：同一管道的 Submit 串行化；OrderingPerKey 下同一批次会按键拆分为多个子批次
+- 与落盘队列（ThrottledBatchExecutor.EnableSpill）同用：某顺序键已有批次落盘时，该键后续批次不再直接执行，
+  而是排在其后落盘，重放后仍保持提交顺序（last-write-wins 不被旧数据覆盖）
+*/
+type OrderingConfig struct {
+	Mode OrderingMode
+	// PartitionKey 返回请求的分区键（仅 OrderingPerKey 使用；为 nil 时退化为按表保证顺序）
+	PartitionKey func(*Request) string
+}
+
+// orderKey 计算请求所属的顺序键
+func (c OrderingConfig) orderKey(request *Request) string {
+	if c.Mode == OrderingPerKey && c.PartitionKey != nil {
+		return request.Schema().Name + "\x00" + c.PartitionKey(request)
+	}
+	return request.Schema().Name
+}
+
+type orderKeyCtxKey struct{}
+
+// withOrderKey 在 ctx 中标记批次所属的顺序键（执行器据此保证落盘与直接执行之间的顺序）
+func withOrderKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, orderKeyCtxKey{}, key)
+}
+
+// orderKeyFromContext 返回 ctx 中的顺序键（未启用顺序保证时不存在）
+func orderKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(orderKeyCtxKey{}).(string)
+	return key, ok
+}
+
+// orderedJob 顺序队列中的一个执行单元（同一顺序键的一组请求）
+type orderedJob struct {
+	key  string
+	run  func() error
+	done chan error
+}
+
+// orderedBatch 等待放行的批次（按起始序号排队）
+type orderedBatch struct {
+	last uint64
+	jobs []*orderedJob
+}
+
+// orderedDispatcher 按提交序号放行批次，并将其拆分到各顺序键的串行队列
+type orderedDispatcher struct {
+	mu      sync.Mutex
+	next    uint64                   // 下一个应放行批次的起始序号
+	pending map[uint64]*orderedBatch // 起始序号 -> 乱序到达、等待放行的批次
+	queues  map[string][]*orderedJob // 顺序键 -> 待执行任务（存在即表示该键有工作协程）
+}
+
+func newOrderedDispatcher() *orderedDispatcher {
+	return &orderedDispatcher{
+		next:    1,
+		pending: make(map[uint64]*orderedBatch),
+		queues:  make(map[string][]*orderedJob),
+	}
+}
+
+// dispatch 登记一个批次（[first, last] 为其请求序号区间），并放行所有已连续到达的批次
+func (d *orderedDispatcher) dispatch(first, last uint64, jobs []*orderedJob) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.pending[first] = &orderedBatch{last: last, jobs: jobs}
+	for {
+		batch, ok := d.pending[d.next]
+		if !ok {
+			return
+		}
+		delete(d.pending, d.next)
+		d.next = batch.last + 1
+		for _, job := range batch.jobs {
+			queue, running := d.queues[job.key]
+			d.queues[job.key] = append(queue, job)
+			if !running {
+				go d.drain(job.key)
+			}
+		}
+	}
+}
+
+// drain 串行执行某个顺序键的任务；队列清空后退出并移除该键
+func (d *orderedDispatcher) drain(key string) {
+	for {
+		d.mu.Lock()
+		queue := d.queues[key]
+		if len(queue) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+		job := queue[0]
+		d.queues[key] = queue[1:]
+		d.mu.Unlock()
+
+		job.done <- job.safeRun()
+	}
+}
+
+// safeRun 执行任务并将 panic 转为错误，保证调度器总能收到结果并继续放行后续批次
+func (j *orderedJob) safeRun() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrBatchPanicked, r)
+		}
+	}()
+	return j.run()
+}
+
+// flushOrdered 顺序模式下的刷新函数：按顺序键拆分批次，交由调度器按提交顺序执行并等待结果
+func (b *BatchSQL) flushOrdered(ctx context.Context, dispatcher *orderedDispatcher, batchData []*Request) error {
+	if len(batchData) == 0 {
+		return nil
+	}
+
+	type group struct {
+		key    string
+		schema *Schema
+	}
+	groups := make(map[group][]*Request)
+	order := make([]group, 0, 1)
+	for _, request := range batchData {
+		g := group{key: b.config.Ordering.orderKey(request), schema: request.Schema()}
+		if _, ok := groups[g]; !ok {
+			order = append(order, g)
+		}
+		groups[g] = append(groups[g], request)
+	}
+
+	jobs := make([]*orderedJob, len(order))
+	for i, g := range order {
+		schema, requests := g.schema, groups[g]
+		keyCtx := withOrderKey(ctx, g.key)
+		jobs[i] = &orderedJob{
+			key:  g.key,
+			run:  func() error { return b.executeGroup(keyCtx, schema, requests) },
+			done: make(chan error, 1),
+		}
+	}
+
+	// 无论 ctx 是否已取消都必须登记，否则后续批次将永远等待该序号
+	dispatcher.dispatch(batchData[0].seq, batchData[len(batchData)-1].seq, jobs)
+
+	var errs []error
+	for _, job := range jobs {
+		if err := <-job.done; err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,332 @@
+package batchsql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// OutboxConfig 事务型 outbox 中继配置
+/*
+流程（每次拉取）：
+- 开启源库事务，SELECT ... ORDER BY IDColumn LIMIT BatchSize FOR UPDATE SKIP LOCKED（PostgreSQL / MySQL 8），多个中继实例互不阻塞
+- 每行转换为 Schema 的 Request（默认按 Schema 列名取同名列），设置 OnComplete 后经 BatchSQL 提交
+- 等待各请求完成（至多 CompletionTimeout），仅对成功的行在同一事务内 DELETE（或 MarkColumn 非空时 UPDATE 标记）后提交
+- 提交失败、执行失败、转换失败或超时未完成的行保留在源表，下次拉取重试（至少一次语义，
+  目标端需有唯一键；PipelineConfig.Idempotency 只能避免同一批次重试时的重复，无法去重重新拉取的行）
+- 等待期间事务持有所拉取行的锁，CompletionTimeout 应大于 FlushInterval 与批次执行耗时之和
+- 等待期间 ctx 取消时，已成功的行仍会确认（脱离取消、至多 outboxAckTimeout），其余行保留
+- Table/IDColumn/Columns/MarkColumn 直接拼入 SQL，须为普通标识符（字母、数字、下划线，可用 . 限定库/模式名）
+*/
+type OutboxConfig struct {
+	Table  string  // 源表（必填）
+	Schema *Schema // 目标 schema（必填）
+
+	IDColumn string   // 源表主键列（默认 "id"）
+	Columns  []string // 读取的列（默认 Schema.Columns）
+	// MarkColumn 非空时不删除源行，而是将该列更新为当前时间，拉取时只读取该列为 NULL 的行
+	MarkColumn string
+	// Dialect 源库方言："mysql"（默认）或 "postgresql"（决定占位符格式）
+	Dialect string
+
+	BatchSize         int           // 每次拉取的最大行数（默认 500）
+	PollInterval      time.Duration // 未拉满时的轮询间隔（默认 1s）
+	CompletionTimeout time.Duration // 等待请求完成的最长时间（默认 30s）
+
+	// Convert 可选自定义转换（row 为列名 -> 值，含 IDColumn）；返回错误的行保留在源表
+	Convert func(row map[string]any) (*Request, error)
+}
+
+// outboxAckTimeout ctx 取消后确认已成功行的最长时间
+const outboxAckTimeout = 5 * time.Second
+
+// OutboxStats 中继计数
+type OutboxStats struct {
+	Polls   int64 // 拉取次数
+	Relayed int64 // 已写入目标并从源表删除/标记的行数
+	Failed  int64 // 未成功（提交/执行失败、转换失败或超时）而保留的行数
+}
+
+// OutboxRelay 从源表拉取行并经 BatchSQL 写入目标存储
+type OutboxRelay struct {
+	db    *sql.DB
+	batch *BatchSQL
+	cfg   OutboxConfig
+
+	polls, relayed, failed atomic.Int64
+}
+
+// NewOutboxRelay 创建 outbox 中继（db 为源库连接，batch 为目标端 BatchSQL）
+func NewOutboxRelay(db *sql.DB, batch *BatchSQL, cfg OutboxConfig) (*OutboxRelay, error) {
+	if cfg.Table == "" {
+		return nil, ErrEmptySchemaName
+	}
+	if cfg.Schema == nil {
+		return nil, ErrInvalidSchema
+	}
+	if cfg.IDColumn == "" {
+		cfg.IDColumn = "id"
+	}
+	if len(cfg.Columns) == 0 {
+		cfg.Columns = cfg.Schema.Columns
+	}
+	for _, name := range append([]string{cfg.Table, cfg.IDColumn, cfg.MarkColumn}, cfg.Columns...) {
+		if name != "" && !validIdentifier(name) {
+			return nil, fmt.Errorf("%w: outbox identifier %q", ErrInvalidSchema, name)
+		}
+	}
+	switch cfg.Dialect {
+	case "":
+		cfg.Dialect = "mysql"
+	case "mysql", "postgresql":
+	default:
+		return nil, fmt.Errorf("%w: outbox dialect %q", errors.ErrUnsupported, cfg.Dialect)
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.CompletionTimeout <= 0 {
+		cfg.CompletionTimeout = 30 * time.Second
+	}
+	return &OutboxRelay{db: db, batch: batch, cfg: cfg}, nil
+}
+
+// Run 循环拉取直到 ctx 取消；单次拉取失败时记录日志并在轮询间隔后重试
+func (r *OutboxRelay) Run(ctx context.Context) error {
+	for {
+		n, err := r.RelayOnce(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			r.batch.logger.log(ctx, slog.LevelWarn, "batchsql: outbox relay incomplete",
+				slog.String("table", r.cfg.Table), slog.Int("relayed", n), slog.Any("error", err))
+		}
+		if err == nil && n >= r.cfg.BatchSize {
+			// 拉满说明仍有积压，立即继续
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.cfg.PollInterval):
+		}
+	}
+}
+
+// RelayOnce 执行一次拉取-提交-确认，返回成功中继的行数
+// 部分行未成功时返回的错误包含失败行数与首个错误，成功的行仍会被确认
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	r.polls.Add(1)
+	// 事务不随 ctx 取消自动回滚：取消后仍需确认已成功的行（语句各自使用 ctx 或确认用的 ctx）
+	tx, err := r.db.BeginTx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	ids, rows, err := r.fetch(ctx, tx)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// 提交并等待完成回调
+	type result struct {
+		index int
+		err   error
+	}
+	results := make(chan result, len(rows))
+	errs := make([]error, len(rows))
+	pending := 0
+	for i, row := range rows {
+		request, err := r.convert(row)
+		if err == nil {
+			request.OnComplete(func(err error) { results <- result{index: i, err: err} })
+			err = r.batch.Submit(ctx, request)
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		pending++
+	}
+	timer := time.NewTimer(r.cfg.CompletionTimeout)
+	defer timer.Stop()
+	// 未收到回调的行视为未完成
+	done := make([]bool, len(rows))
+	canceled := false
+WAIT:
+	for ; pending > 0; pending-- {
+		select {
+		case res := <-results:
+			done[res.index] = true
+			errs[res.index] = res.err
+		case <-timer.C:
+			break WAIT
+		case <-ctx.Done():
+			canceled = true
+			break WAIT
+		}
+	}
+
+	var (
+		succeeded []any
+		failed    int
+		firstErr  error
+	)
+	for i, id := range ids {
+		switch {
+		case errs[i] != nil:
+		case !done[i] && canceled:
+			errs[i] = ctx.Err()
+		case !done[i]:
+			errs[i] = fmt.Errorf("outbox: request not completed within %v", r.cfg.CompletionTimeout)
+		default:
+			succeeded = append(succeeded, id)
+			continue
+		}
+		failed++
+		if firstErr == nil {
+			firstErr = errs[i]
+		}
+	}
+	r.failed.Add(int64(failed))
+
+	ackCtx := ctx
+	if canceled {
+		// 已写入目标的行若不确认，下次拉取会重复写入
+		var cancel context.CancelFunc
+		ackCtx, cancel = context.WithTimeout(context.WithoutCancel(ctx), outboxAckTimeout)
+		defer cancel()
+	}
+	if len(succeeded) > 0 {
+		if err := r.acknowledge(ackCtx, tx, succeeded); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	r.relayed.Add(int64(len(succeeded)))
+	if canceled {
+		return len(succeeded), ctx.Err()
+	}
+	if failed > 0 {
+		return len(succeeded), fmt.Errorf("outbox: %d of %d rows not relayed: %w", failed, len(ids), firstErr)
+	}
+	return len(succeeded), nil
+}
+
+// Stats 返回中继计数快照
+func (r *OutboxRelay) Stats() OutboxStats {
+	return OutboxStats{Polls: r.polls.Load(), Relayed: r.relayed.Load(), Failed: r.failed.Load()}
+}
+
+// fetch 锁定并读取一批源行，返回各行主键与列名 -> 值
+func (r *OutboxRelay) fetch(ctx context.Context, tx *sql.Tx) ([]any, []map[string]any, error) {
+	columns := append([]string{r.cfg.IDColumn}, r.cfg.Columns...)
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(columns, ", "), r.cfg.Table)
+	if r.cfg.MarkColumn != "" {
+		query += fmt.Sprintf(" WHERE %s IS NULL", r.cfg.MarkColumn)
+	}
+	query += fmt.Sprintf(" ORDER BY %s LIMIT %d FOR UPDATE SKIP LOCKED", r.cfg.IDColumn, r.cfg.BatchSize)
+
+	rs, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rs.Close()
+	var (
+		ids  []any
+		rows []map[string]any
+	)
+	for rs.Next() {
+		values := make([]any, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rs.Scan(dest...); err != nil {
+			return nil, nil, err
+		}
+		row := make(map[string]any, len(columns))
+		for i, col := range columns {
+			row[col] = values[i]
+		}
+		ids = append(ids, values[0])
+		rows = append(rows, row)
+	}
+	return ids, rows, rs.Err()
+}
+
+// convert 将源行转换为目标请求（默认按 Schema 列名取值）
+func (r *OutboxRelay) convert(row map[string]any) (*Request, error) {
+	if r.cfg.Convert != nil {
+		return r.cfg.Convert(row)
+	}
+	request := NewRequest(r.cfg.Schema)
+	for _, col := range r.cfg.Schema.Columns {
+		v, ok := row[col]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMissingColumn, col)
+		}
+		request.Set(col, v)
+	}
+	return request, nil
+}
+
+// acknowledge 在拉取事务内删除或标记已成功中继的源行
+func (r *OutboxRelay) acknowledge(ctx context.Context, tx *sql.Tx, ids []any) error {
+	if r.cfg.MarkColumn == "" {
+		query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)", r.cfg.Table, r.cfg.IDColumn, r.placeholders(0, len(ids)))
+		_, err := tx.ExecContext(ctx, query, ids...)
+		return err
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s IN (%s)",
+		r.cfg.Table, r.cfg.MarkColumn, r.placeholder(0), r.cfg.IDColumn, r.placeholders(1, len(ids)))
+	_, err := tx.ExecContext(ctx, query, append([]any{time.Now()}, ids...)...)
+	return err
+}
+
+// validIdentifier 是否为可直接拼入 SQL 的普通标识符（可用 . 限定）
+func validIdentifier(name string) bool {
+	for _, part := range strings.Split(name, ".") {
+		if part == "" {
+			return false
+		}
+		for i, c := range part {
+			switch {
+			case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			case c >= '0' && c <= '9' && i > 0:
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// placeholder 第 i 个参数（从 0 开始）的占位符
+func (r *OutboxRelay) placeholder(i int) string {
+	if r.cfg.Dialect == "postgresql" {
+		return fmt.Sprintf("$%d", i+1)
+	}
+	return "?"
+}
+
+// placeholders 从第 offset 个参数开始的 n 个占位符
+func (r *OutboxRelay) placeholders(offset, n int) string {
+	ph := make([]string, n)
+	for i := range ph {
+		ph[i] = r.placeholder(offset + i)
+	}
+	return strings.Join(ph, ", ")
+}
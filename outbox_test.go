@@ -0,0 +1,327 @@
+package batchsql_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// outboxSource 内存中的假源库：outbox 行 + 已执行语句；删除在事务提交时生效
+type outboxSource struct {
+	mu      sync.Mutex
+	rows    map[int64]string // id -> payload
+	queries []string
+}
+
+var (
+	outboxOnce    sync.Once
+	outboxMu      sync.Mutex
+	outboxSources = map[string]*outboxSource{}
+)
+
+type outboxDriver struct{}
+
+func (outboxDriver) Open(name string) (driver.Conn, error) {
+	outboxMu.Lock()
+	defer outboxMu.Unlock()
+	return &outboxConn{src: outboxSources[name]}, nil
+}
+
+type outboxConn struct {
+	src     *outboxSource
+	deletes []int64
+}
+
+func (c *outboxConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *outboxConn) Close() error                        { return nil }
+func (c *outboxConn) Begin() (driver.Tx, error)           { return c, nil }
+
+func (c *outboxConn) Commit() error {
+	c.src.mu.Lock()
+	defer c.src.mu.Unlock()
+	for _, id := range c.deletes {
+		delete(c.src.rows, id)
+	}
+	c.deletes = nil
+	return nil
+}
+
+func (c *outboxConn) Rollback() error {
+	c.deletes = nil
+	return nil
+}
+
+func (c *outboxConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.src.mu.Lock()
+	defer c.src.mu.Unlock()
+	c.src.queries = append(c.src.queries, query)
+	rows := &outboxRows{}
+	for id := int64(1); id <= 100; id++ {
+		if payload, ok := c.src.rows[id]; ok {
+			rows.data = append(rows.data, []driver.Value{id, payload})
+		}
+	}
+	return rows, nil
+}
+
+func (c *outboxConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.src.mu.Lock()
+	c.src.queries = append(c.src.queries, query)
+	c.src.mu.Unlock()
+	for _, a := range args {
+		c.deletes = append(c.deletes, a.Value.(int64))
+	}
+	return driver.RowsAffected(int64(len(args))), nil
+}
+
+type outboxRows struct {
+	data [][]driver.Value
+}
+
+func (r *outboxRows) Columns() []string { return []string{"id", "payload"} }
+func (r *outboxRows) Close() error      { return nil }
+func (r *outboxRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
+
+func (s *outboxSource) remaining() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []int64
+	for id := int64(1); id <= 100; id++ {
+		if _, ok := s.rows[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// payloadExecutor 包含 payload="bad" 的批次失败，其余记录已写入的 payload
+type payloadExecutor struct {
+	mu      sync.Mutex
+	written []string
+}
+
+func (e *payloadExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	for _, row := range data {
+		if row["payload"] == "bad" {
+			return errors.New("target rejected row")
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, row := range data {
+		e.written = append(e.written, row["payload"].(string))
+	}
+	return nil
+}
+
+func TestOutboxRelay_DeletesOnlyCompletedRows(t *testing.T) {
+	outboxOnce.Do(func() { sql.Register("batchsql-outbox", outboxDriver{}) })
+	src := &outboxSource{rows: map[int64]string{1: "a", 2: "bad", 3: "c"}}
+	outboxMu.Lock()
+	outboxSources[t.Name()] = src
+	outboxMu.Unlock()
+	db, err := sql.Open("batchsql-outbox", t.Name())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := &payloadExecutor{}
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    10,
+		FlushSize:     1,
+		FlushInterval: 5 * time.Millisecond,
+	}, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "payload")
+	relay, err := batchsql.NewOutboxRelay(db, batch, batchsql.OutboxConfig{
+		Table:             "outbox",
+		Schema:            schema,
+		Dialect:           "postgresql",
+		CompletionTimeout: time.Second,
+	})
+	if err != nil {
+		t.Fatalf("new relay: %v", err)
+	}
+
+	n, err := relay.RelayOnce(ctx)
+	if n != 2 || err == nil || !strings.Contains(err.Error(), "target rejected row") {
+		t.Fatalf("expected 2 rows relayed and the bad row reported, got n=%d err=%v", n, err)
+	}
+	if ids := src.remaining(); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("expected only the failed row to remain, got %v", ids)
+	}
+	exec.mu.Lock()
+	written := strings.Join(exec.written, ",")
+	exec.mu.Unlock()
+	if written != "a,c" && written != "c,a" {
+		t.Fatalf("unexpected rows written to target: %s", written)
+	}
+	if s := relay.Stats(); s.Polls != 1 || s.Relayed != 2 || s.Failed != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	src.mu.Lock()
+	queries := strings.Join(src.queries, "\n")
+	src.mu.Unlock()
+	for _, want := range []string{
+		"SELECT id, payload FROM outbox ORDER BY id LIMIT 500 FOR UPDATE SKIP LOCKED",
+		"DELETE FROM outbox WHERE id IN ($1, $2)",
+	} {
+		if !strings.Contains(queries, want) {
+			t.Fatalf("expected query %q, got:\n%s", want, queries)
+		}
+	}
+
+	if _, err := batchsql.NewOutboxRelay(db, batch, batchsql.OutboxConfig{Table: "outbox", Schema: schema, Dialect: "oracle"}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported for unknown dialect, got %v", err)
+	}
+}
+
+// openOutboxSource 注册假源库并返回连接
+func openOutboxSource(t *testing.T, rows map[int64]string) (*sql.DB, *outboxSource) {
+	t.Helper()
+	outboxOnce.Do(func() { sql.Register("batchsql-outbox", outboxDriver{}) })
+	src := &outboxSource{rows: rows}
+	outboxMu.Lock()
+	outboxSources[t.Name()] = src
+	outboxMu.Unlock()
+	db, err := sql.Open("batchsql-outbox", t.Name())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, src
+}
+
+// slowPayloadExecutor payload="slow" 的批次阻塞到 release 关闭，其余批次立即成功
+type slowPayloadExecutor struct {
+	release chan struct{}
+	written chan string
+}
+
+func (e *slowPayloadExecutor) ExecuteBatch(ctx context.Context, schema *batchsql.Schema, data []map[string]any) error {
+	for _, row := range data {
+		if row["payload"] == "slow" {
+			select {
+			case <-e.release:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		e.written <- row["payload"].(string)
+	}
+	return nil
+}
+
+func TestOutboxRelay_CancelAcksCompletedRows(t *testing.T) {
+	db, src := openOutboxSource(t, map[int64]string{1: "a", 2: "slow"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := &slowPayloadExecutor{release: make(chan struct{}), written: make(chan string, 2)}
+	defer close(exec.release)
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 1, FlushInterval: 5 * time.Millisecond}, exec)
+	relay, err := batchsql.NewOutboxRelay(db, batch, batchsql.OutboxConfig{
+		Table:             "outbox",
+		Schema:            batchsql.NewSchema("events", batchsql.ConflictIgnore, "payload"),
+		CompletionTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("new relay: %v", err)
+	}
+
+	relayCtx, cancelRelay := context.WithCancel(ctx)
+	type result struct {
+		n   int
+		err error
+	}
+	out := make(chan result, 1)
+	go func() {
+		n, err := relay.RelayOnce(relayCtx)
+		out <- result{n, err}
+	}()
+	if got := <-exec.written; got != "a" {
+		t.Fatalf("expected row a to be written first, got %q", got)
+	}
+	// 等待 a 的完成回调送达后再取消
+	time.Sleep(20 * time.Millisecond)
+	cancelRelay()
+
+	res := <-out
+	if res.n != 1 || !errors.Is(res.err, context.Canceled) {
+		t.Fatalf("expected 1 row relayed and context.Canceled, got n=%d err=%v", res.n, res.err)
+	}
+	if ids := src.remaining(); len(ids) != 1 || ids[0] != 2 {
+		t.Fatalf("expected only the unfinished row to remain, got %v", ids)
+	}
+}
+
+func TestOutboxRelay_RejectsUnsafeIdentifiers(t *testing.T) {
+	db, _ := openOutboxSource(t, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, _ := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 10, FlushInterval: time.Hour})
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "payload")
+
+	for _, cfg := range []batchsql.OutboxConfig{
+		{Table: "outbox; DROP TABLE users", Schema: schema},
+		{Table: "outbox", Schema: schema, IDColumn: "id)--"},
+		{Table: "outbox", Schema: schema, Columns: []string{"payload", "1col"}},
+		{Table: "outbox", Schema: schema, MarkColumn: "sent at"},
+		{Table: "app..outbox", Schema: schema},
+	} {
+		if _, err := batchsql.NewOutboxRelay(db, batch, cfg); !errors.Is(err, batchsql.ErrInvalidSchema) {
+			t.Fatalf("expected ErrInvalidSchema for %+v, got %v", cfg, err)
+		}
+	}
+	if _, err := batchsql.NewOutboxRelay(db, batch, batchsql.OutboxConfig{Table: "app.outbox_v2", Schema: schema, MarkColumn: "sent_at"}); err != nil {
+		t.Fatalf("expected qualified identifier to be accepted, got %v", err)
+	}
+}
+
+func TestOutboxRelay_SpilledBatchIsNotAcknowledged(t *testing.T) {
+	db, src := openOutboxSource(t, map[int64]string{1: "a", 2: "b"})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	proc := &outageProcessor{err: errors.New("dial tcp: connection refused")}
+	exec := batchsql.NewThrottledBatchExecutor(proc)
+	// 重放退避足够长：批次停留在落盘队列中
+	if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), Backoff: batchsql.ConstantBackoff{Delay: time.Hour}}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 2, FlushInterval: 5 * time.Millisecond}, exec)
+	relay, err := batchsql.NewOutboxRelay(db, batch, batchsql.OutboxConfig{
+		Table:             "outbox",
+		Schema:            batchsql.NewSchema("events", batchsql.ConflictIgnore, "payload"),
+		CompletionTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("new relay: %v", err)
+	}
+
+	if n, err := relay.RelayOnce(ctx); n != 0 || err == nil {
+		t.Fatalf("expected no rows relayed while the batch is spilled, got n=%d err=%v", n, err)
+	}
+	if depth, _ := exec.SpoolDepth(); depth != 1 {
+		t.Fatalf("expected the batch to be spilled, spool depth=%d", depth)
+	}
+	if ids := src.remaining(); len(ids) != 2 {
+		t.Fatalf("expected spilled rows to stay in the outbox, got %v", ids)
+	}
+}
@@ -0,0 +1,183 @@
+package batchsql
+
+import (
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"time"
+)
+
+// OverflowPolicy 缓冲区写满时 Submit 的处理策略
+type OverflowPolicy uint8
+
+const (
+	// OverflowBlock 阻塞直到有空位或 ctx 结束（默认，与历史行为一致）
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest 丢弃新请求，立即返回 ErrQueueFull
+	OverflowDropNewest
+	// OverflowDropOldest 丢弃缓冲区中最旧的请求，为新请求腾出空间
+	OverflowDropOldest
+	// OverflowSpill 将新请求写入执行器的落盘队列（需 ThrottledBatchExecutor.EnableSpill），
+	// 由落盘队列直接重放到数据库；不可用或失败时返回 ErrQueueFull。
+	// 转存的请求不经过批内去重与 WAL（落盘队列自身持久化），重放结束后才调用 OnComplete
+	OverflowSpill
+	// OverflowSample 按 SampleRate 保留部分请求（阻塞入队），其余丢弃并返回 ErrQueueFull
+	OverflowSample
+)
+
+// String 返回策略名（用于日志）
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowSpill:
+		return "spill"
+	case OverflowSample:
+		return "sample"
+	default:
+		return "block"
+	}
+}
+
+// OverflowConfig 缓冲区溢出配置（零值=阻塞）
+/*
+说明：
+- 仅在缓冲区已满时生效；未满时所有策略均直接入队
+- TrySubmit 从不阻塞：OverflowBlock 与 OverflowSample 下缓冲区满时直接返回 ErrQueueFull
+- OverflowDropOldest 需在管道前增加一层同容量的前置队列（淘汰只发生在前置队列中）；
+  顺序模式（Ordering）下淘汰会破坏序号连续性，退化为 OverflowDropNewest
+- OverflowSpill 转存的请求计入 Stats.Spilled，重放成功后计入 RowsWritten、无法恢复时计入 FailedRows，
+  OnComplete 在重放结束后调用（进程退出前未重放的请求不会调用，下次启动仍会重放）；
+  顺序模式下转存会越过缓冲区中同键的旧请求，退化为 OverflowBlock
+- 被丢弃的请求通过 ExtendedMetricsReporter.IncSubmitRejected 上报（reason：queue_full/sampled_out/evicted），并计入 Stats.Dropped
+*/
+type OverflowConfig struct {
+	Policy OverflowPolicy
+	// SampleRate OverflowSample 下保留的比例 (0,1]；<=0 表示全部丢弃
+	SampleRate float64
+}
+
+// evicting 是否使用前置队列淘汰最旧请求
+func (c PipelineConfig) evicting() bool {
+	return c.Overflow.Policy == OverflowDropOldest && c.Ordering.Mode == OrderingNone
+}
+
+// overflowSpiller 可接收溢出请求的执行器（ThrottledBatchExecutor 开启落盘队列时）
+type overflowSpiller interface {
+	spillOverflow(ctx context.Context, schema *Schema, data []map[string]any, onDone func(error)) bool
+}
+
+// spillOverflow 将溢出的请求写入落盘队列，成功返回 true；onDone 在重放结束后调用
+func (e *ThrottledBatchExecutor) spillOverflow(ctx context.Context, schema *Schema, data []map[string]any, onDone func(error)) bool {
+	if e.spill == nil {
+		return false
+	}
+	if err := e.spill.push(schema, data, "", "", onDone); err != nil {
+		e.logger.sampled(ctx, slog.LevelError, "batchsql: spill failed",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Any("error", err))
+		return false
+	}
+	e.spill.event(schema.Name, "spilled")
+	return true
+}
+
+// startEvictionPump 前置队列 -> 管道通道的转发协程（OverflowDropOldest）
+func (b *BatchSQL) startEvictionPump(h *pipelineHandle, size uint32) {
+	h.front = make(chan *Request, max(size, 1))
+	go func() {
+		for {
+			select {
+			case r := <-h.front:
+				if !h.sendStage(b.ctx.Done(), r) {
+					return
+				}
+			case <-b.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// overflow 缓冲区已满时按策略处理；queued 表示请求已进入管道，err 为 nil 且未入队表示已转存到落盘队列
+// 顺序模式下调用方持有提交锁，未入队时负责回收序号
+func (b *BatchSQL) overflow(ctx context.Context, h *pipelineHandle, schema *Schema, request *Request, try, logWAL bool) (queued bool, err error) {
+	switch b.config.Overflow.Policy {
+	case OverflowDropOldest:
+		if h.front == nil {
+			return false, b.dropRequest(ctx, schema, request, logWAL, "queue_full")
+		}
+		for {
+			select {
+			case h.front <- request:
+				return true, nil
+			default:
+			}
+			select {
+			case evicted := <-h.front:
+				evicted.complete(b.dropRequest(ctx, evicted.schema, evicted, b.wal != nil, "evicted"))
+			default:
+			}
+		}
+	case OverflowSpill:
+		// 顺序模式下转存会越过缓冲区中同键的旧请求，退化为阻塞入队
+		if h.ordered() {
+			if try {
+				return false, b.dropRequest(ctx, schema, request, logWAL, "queue_full")
+			}
+			break
+		}
+		onDone := func(err error) {
+			b.stats.recordSpilledRow(schema.Name, err)
+			request.complete(err)
+		}
+		if sp, ok := executorAs[overflowSpiller](b.executor); ok && sp.spillOverflow(ctx, schema, []map[string]any{request.columns}, onDone) {
+			if logWAL {
+				// 已由落盘队列接管持久化
+				_ = b.wal.ack([]*Request{request})
+			}
+			b.stats.table(schema.Name).spilled.Add(1)
+			return false, nil
+		}
+		return false, b.dropRequest(ctx, schema, request, logWAL, "queue_full")
+	case OverflowSample:
+		if try || rand.Float64() >= b.config.Overflow.SampleRate {
+			return false, b.dropRequest(ctx, schema, request, logWAL, "sampled_out")
+		}
+	case OverflowDropNewest:
+		return false, b.dropRequest(ctx, schema, request, logWAL, "queue_full")
+	default:
+		if try {
+			return false, b.dropRequest(ctx, schema, request, logWAL, "queue_full")
+		}
+	}
+
+	// 阻塞入队（OverflowBlock / 采样保留）
+	enqueueStart := time.Now()
+	if h.send(ctx.Done(), request) {
+		return true, nil
+	}
+	if logWAL {
+		// 未入队的请求立即确认，避免下次启动时重放调用方已知失败的提交
+		_ = b.wal.ack([]*Request{request})
+	}
+	b.logger.sampled(ctx, slog.LevelDebug, "batchsql: submit canceled",
+		slog.String("table", schema.Name), slog.Duration("duration", time.Since(enqueueStart)), slog.Any("error", ctx.Err()))
+	return false, ctx.Err()
+}
+
+// dropRequest 丢弃请求：确认 WAL、计数并上报
+func (b *BatchSQL) dropRequest(ctx context.Context, schema *Schema, request *Request, logWAL bool, reason string) error {
+	if logWAL {
+		_ = b.wal.ack([]*Request{request})
+	}
+	b.releaseMemory([]*Request{request})
+	b.stats.table(schema.Name).dropped.Add(1)
+	if xr, ok := b.metricsReporter.(ExtendedMetricsReporter); ok {
+		xr.IncSubmitRejected(reason)
+	}
+	b.logger.sampled(ctx, slog.LevelWarn, "batchsql: request dropped, queue full",
+		slog.String("table", schema.Name), slog.String("policy", b.config.Overflow.Policy.String()), slog.String("reason", reason))
+	return ErrQueueFull
+}
@@ -0,0 +1,244 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// floodSubmit 多个协程并发提交，缓冲区极小以触发溢出；返回成功与 ErrQueueFull 的数量
+func floodSubmit(t *testing.T, schema *batchsql.Schema, submit func(context.Context, *batchsql.Request) error) (ok, full int64) {
+	t.Helper()
+	var wg sync.WaitGroup
+	var okN, fullN atomic.Int64
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				err := submit(context.Background(), batchsql.NewRequest(schema).SetInt64("id", int64(g*500+i)))
+				switch {
+				case err == nil:
+					okN.Add(1)
+				case errors.Is(err, batchsql.ErrQueueFull):
+					fullN.Add(1)
+				default:
+					t.Errorf("unexpected submit error: %v", err)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	return okN.Load(), fullN.Load()
+}
+
+// gateProcessor 执行阻塞直到 gate 关闭（模拟卡住的数据库）
+type gateProcessor struct {
+	gate chan struct{}
+}
+
+func (p *gateProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *gateProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	select {
+	case <-p.gate:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newOverflowBatch(t *testing.T, overflow batchsql.OverflowConfig, m *extendedMetrics) *batchsql.BatchSQL {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	exec := batchsql.NewThrottledBatchExecutor(&fakeProcessor{}).WithMetricsReporter(m)
+	return batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    1,
+		FlushSize:     1000,
+		FlushInterval: 5 * time.Millisecond,
+		Overflow:      overflow,
+	}, exec)
+}
+
+func TestOverflow_TrySubmitAndDropNewestRejectWhenFull(t *testing.T) {
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+	cases := []struct {
+		name   string
+		policy batchsql.OverflowPolicy
+		try    bool
+	}{
+		{"block_try_submit", batchsql.OverflowBlock, true},
+		{"drop_newest", batchsql.OverflowDropNewest, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newExtendedMetrics()
+			batch := newOverflowBatch(t, batchsql.OverflowConfig{Policy: tc.policy}, m)
+			submit := batch.Submit
+			if tc.try {
+				submit = batch.TrySubmit
+			}
+			ok, full := floodSubmit(t, schema, submit)
+			if full == 0 {
+				t.Fatalf("expected some requests to be rejected with ErrQueueFull")
+			}
+			waitRowsWritten(t, batch, ok)
+			s := batch.Stats()
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			if s.Dropped != full || s.Submitted != ok || int64(m.rejected["queue_full"]) != full {
+				t.Fatalf("unexpected counters: stats=%+v rejected=%v full=%d", s, m.rejected, full)
+			}
+		})
+	}
+}
+
+func TestOverflow_DropOldestEvictsBufferedRequests(t *testing.T) {
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	m := newExtendedMetrics()
+	batch := newOverflowBatch(t, batchsql.OverflowConfig{Policy: batchsql.OverflowDropOldest}, m)
+
+	ok, full := floodSubmit(t, schema, batch.Submit)
+	if full != 0 || ok != 4000 {
+		t.Fatalf("drop-oldest should accept every submit, ok=%d full=%d", ok, full)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if s := batch.Stats(); s.RowsWritten+s.Dropped == ok {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s := batch.Stats()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.RowsWritten+s.Dropped != ok || int64(m.rejected["evicted"]) != s.Dropped {
+		t.Fatalf("unexpected counters: stats=%+v rejected=%v", s, m.rejected)
+	}
+}
+
+func TestOverflow_SpillAndSample(t *testing.T) {
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+	t.Run("spill", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		proc := &outageProcessor{}
+		sm := newSpillMetrics()
+		exec := batchsql.NewThrottledBatchExecutor(proc).WithMetricsReporter(sm)
+		if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), Backoff: batchsql.ConstantBackoff{Delay: 5 * time.Millisecond}}); err != nil {
+			t.Fatalf("enable spill: %v", err)
+		}
+		batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+			BufferSize:    1,
+			FlushSize:     1000,
+			FlushInterval: 5 * time.Millisecond,
+			Overflow:      batchsql.OverflowConfig{Policy: batchsql.OverflowSpill},
+		}, exec)
+
+		ok, full := floodSubmit(t, schema, batch.Submit)
+		if full != 0 || ok != 4000 {
+			t.Fatalf("spill should accept every submit, ok=%d full=%d", ok, full)
+		}
+		if sm.event("spilled") == 0 {
+			t.Fatalf("expected overflowed requests to be spilled")
+		}
+		waitSpoolDrained(t, exec)
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			rows := 0
+			for _, b := range proc.executed() {
+				rows += len(b)
+			}
+			if rows == 4000 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected all 4000 rows to be written, got %d", rows)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		if s := batch.Stats(); s.Submitted != 4000 || s.Dropped != 0 || s.Spilled == 0 || s.RowsWritten != 4000 {
+			t.Fatalf("unexpected stats: %+v", s)
+		}
+	})
+
+	t.Run("spill completes after replay", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		proc := &gateProcessor{gate: make(chan struct{})}
+		exec := batchsql.NewThrottledBatchExecutor(proc).WithConcurrencyLimit(1)
+		if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), Backoff: batchsql.ConstantBackoff{Delay: 5 * time.Millisecond}}); err != nil {
+			t.Fatalf("enable spill: %v", err)
+		}
+		batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+			BufferSize:    1,
+			FlushSize:     1,
+			FlushInterval: 5 * time.Millisecond,
+			Overflow:      batchsql.OverflowConfig{Policy: batchsql.OverflowSpill},
+		}, exec)
+
+		var completed atomic.Int64
+		submitted := int64(0)
+		for batch.Stats().Spilled == 0 && submitted < 100 {
+			req := batchsql.NewRequest(schema).SetInt64("id", submitted).OnComplete(func(err error) {
+				if err == nil {
+					completed.Add(1)
+				}
+			})
+			if err := batch.Submit(ctx, req); err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+			submitted++
+		}
+		if batch.Stats().Spilled == 0 {
+			t.Fatalf("expected an overflowed request to be spilled")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if n := completed.Load(); n != 0 {
+			t.Fatalf("OnComplete must wait until rows reach the database, got %d completions", n)
+		}
+
+		close(proc.gate)
+		waitSpoolDrained(t, exec)
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) && completed.Load() != submitted {
+			time.Sleep(5 * time.Millisecond)
+		}
+		if n := completed.Load(); n != submitted {
+			t.Fatalf("expected %d completions after replay, got %d", submitted, n)
+		}
+		if s := batch.Stats(); s.RowsWritten != submitted {
+			t.Fatalf("spilled rows should be counted once replayed: %+v", s)
+		}
+	})
+
+	t.Run("sample", func(t *testing.T) {
+		m := newExtendedMetrics()
+		batch := newOverflowBatch(t, batchsql.OverflowConfig{Policy: batchsql.OverflowSample, SampleRate: 0}, m)
+		ok, full := floodSubmit(t, schema, batch.Submit)
+		if full == 0 {
+			t.Fatalf("expected requests to be sampled out")
+		}
+		waitRowsWritten(t, batch, ok)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if int64(m.rejected["sampled_out"]) != full || batch.Stats().Dropped != full {
+			t.Fatalf("unexpected counters: rejected=%v full=%d", m.rejected, full)
+		}
+
+		keep := newOverflowBatch(t, batchsql.OverflowConfig{Policy: batchsql.OverflowSample, SampleRate: 1}, newExtendedMetrics())
+		if ok, full := floodSubmit(t, schema, keep.Submit); full != 0 || ok != 4000 {
+			t.Fatalf("sample rate 1 should keep every request, ok=%d full=%d", ok, full)
+		}
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"sync/atomic"
 
 	"github.com/redis/go-redis/v9"
 )
@@ -26,6 +27,11 @@ var _ BatchProcessor = (*SQLBatchProcessor)(nil)
 type SQLBatchProcessor struct {
 	db     *sql.DB   // 数据库连接
 	driver SQLDriver // SQL生成器（数据库特定）
+
+	// 可选幂等模式（WithIdempotency）
+	idempotency    IdempotencyConfig
+	idempotencyErr error        // 幂等配置校验错误（执行时返回）
+	skipped        atomic.Int64 // 因批次 id 已记录而跳过的批次数
 }
 
 // NewSQLBatchProcessor 创建SQL批量处理器
@@ -39,6 +45,22 @@ func NewSQLBatchProcessor(db *sql.DB, driver SQLDriver) *SQLBatchProcessor {
 	}
 }
 
+// WithIdempotency 设置批次幂等模式（需在使用前调用；Enabled 为 false 时关闭）
+// Table 不是合法标识符时，开启幂等后每次执行返回包装 ErrInvalidSchema 的错误，不会拼入 SQL
+func (bp *SQLBatchProcessor) WithIdempotency(cfg IdempotencyConfig) *SQLBatchProcessor {
+	if cfg.Table == "" {
+		cfg.Table = DefaultIdempotencyTable
+	}
+	bp.idempotency = cfg
+	bp.idempotencyErr = cfg.validate()
+	return bp
+}
+
+// SkippedBatches 幂等模式下因批次 id 已记录而跳过执行的批次数
+func (bp *SQLBatchProcessor) SkippedBatches() int64 {
+	return bp.skipped.Load()
+}
+
 func (bp *SQLBatchProcessor) GenerateOperations(ctx context.Context, schema *Schema, data []map[string]any) (operations Operations, err error) {
 	sql, args, innerErr := bp.driver.GenerateInsertSQL(ctx, schema, data)
 	if innerErr != nil {
@@ -51,6 +73,9 @@ func (bp *SQLBatchProcessor) GenerateOperations(ctx context.Context, schema *Sch
 
 func (bp *SQLBatchProcessor) ExecuteOperations(ctx context.Context, operations Operations) error {
 	if sql, ok := operations[0].(string); ok {
+		if bp.idempotency.Enabled {
+			return bp.executeIdempotent(ctx, operations)
+		}
 		args := operations[1:]
 		_, err := bp.db.ExecContext(ctx, sql, args...)
 		return err
@@ -0,0 +1,112 @@
+package batchsql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimitConfig 行速率/字节速率限制（令牌桶；零值字段表示该维度不限）
+/*
+说明：
+- 行数按批次行数计，字节数按参数值估算（字符串/[]byte 取长度，数值按定长）
+- 单个批次超过突发容量时允许“透支”，后续批次等待补足，保证大批次也能前进
+- 限速在 ExecuteBatch 入口生效（重试不重复扣减），等待期间不占用并发令牌，可响应 ctx 取消
+*/
+type RateLimitConfig struct {
+	RowsPerSecond  float64 // 每秒行数上限
+	BytesPerSecond float64 // 每秒字节数上限
+	RowsBurst      int     // 行突发容量（默认 1 秒配额）
+	BytesBurst     int     // 字节突发容量（默认 1 秒配额）
+}
+
+// tokenBucket 令牌桶（允许透支）
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	b := float64(burst)
+	if b <= 0 {
+		b = rate
+	}
+	return &tokenBucket{rate: rate, burst: b, tokens: b, last: time.Now()}
+}
+
+// reserve 预占 n 个令牌，返回需要等待的时长（令牌不足时记为透支）
+func (b *tokenBucket) reserve(n float64) time.Duration {
+	if b == nil || n <= 0 {
+		return 0
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= n
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel 归还预占的令牌（等待被取消时调用）
+func (b *tokenBucket) cancel(n float64) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.tokens = min(b.burst, b.tokens+n)
+	b.mu.Unlock()
+}
+
+// rateLimiter 行 + 字节双维度限速器
+type rateLimiter struct {
+	rows  *tokenBucket
+	bytes *tokenBucket
+}
+
+func newRateLimiter(cfg RateLimitConfig) *rateLimiter {
+	l := &rateLimiter{
+		rows:  newTokenBucket(cfg.RowsPerSecond, cfg.RowsBurst),
+		bytes: newTokenBucket(cfg.BytesPerSecond, cfg.BytesBurst),
+	}
+	if l.rows == nil && l.bytes == nil {
+		return nil
+	}
+	return l
+}
+
+// wait 等待直到本批次的行/字节配额可用；ctx 取消时归还配额并返回 ctx.Err()
+func (l *rateLimiter) wait(ctx context.Context, data []map[string]any) error {
+	if l == nil {
+		return nil
+	}
+	rows := float64(len(data))
+	var bytes float64
+	if l.bytes != nil {
+		bytes = float64(estimateRowsSize(data))
+	}
+
+	delay := max(l.rows.reserve(rows), l.bytes.reserve(bytes))
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.rows.cancel(rows)
+		l.bytes.cancel(bytes)
+		return ctx.Err()
+	}
+}
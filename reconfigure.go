@@ -0,0 +1,272 @@
+package batchsql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	gopipeline "github.com/rushairer/go-pipeline/v2"
+)
+
+// RuntimeConfig 运行时可调整的参数（零值/nil 字段表示保持不变）
+/*
+说明：
+- FlushSize / FlushInterval：go-pipeline 的配置不可变，调整时为每个管道启动新一代管道，新提交进入新管道；
+  旧管道停止接收，立即刷新剩余请求后退出，不丢数据（顺序模式下仍按提交顺序执行）
+- 按 schema 隔离模式下作用于全局值；SchemaPipelines 中显式覆盖的字段不受影响
+- ConcurrencyLimit / Retry：转交执行器（需为 ThrottledBatchExecutor，可被拦截器包装），对之后开始的批次生效；
+  执行器启用自适应并发（WithAdaptiveConcurrency）时固定上限不生效，ConcurrencyLimit 返回 ErrUnsupported
+- BufferSize 与其他 PipelineConfig 字段不支持运行时调整
+*/
+type RuntimeConfig struct {
+	FlushSize     uint32
+	FlushInterval time.Duration
+	// ConcurrencyLimit 执行器并发上限（<= 0 表示不限流）
+	ConcurrencyLimit *int
+	// Retry 执行器重试策略
+	Retry *RetryConfig
+}
+
+// flushSettings 当前攒批参数
+type flushSettings struct {
+	size     uint32
+	interval time.Duration
+}
+
+// pipelineStage 一代 go-pipeline 实例（配置不可变）
+type pipelineStage struct {
+	pipeline *gopipeline.StandardPipeline[*Request]
+	config   gopipeline.PipelineConfig
+	cancel   context.CancelFunc
+
+	// 发送方持读锁；退役时持写锁置 retired，此后不再有请求送入
+	mu      sync.RWMutex
+	retired bool
+	sent    atomic.Int64 // 已送入的请求数
+	taken   atomic.Int64 // 已交给刷新函数的请求数
+
+	// MemoryConfig.FlushBytes：已送入、尚未刷新的估算字节数达到阈值时补齐当前批次使其立即刷新
+	// taken 在异步的刷新函数中累加，会滞后于 sent，pendingBytes 与补齐数均为近似值
+	flushBytes   int64
+	pendingBytes atomic.Int64
+	forcing      atomic.Bool // 已补齐、等待刷新（避免并发提交重复补齐）
+}
+
+// Reconfigure 在运行时调整攒批与执行参数，可与 Submit 并发调用
+// 执行器不支持所需调整时返回包装 errors.ErrUnsupported 的错误，且不做任何修改
+func (b *BatchSQL) Reconfigure(cfg RuntimeConfig) error {
+	var executor *ThrottledBatchExecutor
+	if cfg.ConcurrencyLimit != nil || cfg.Retry != nil {
+		var ok bool
+		if executor, ok = executorAs[*ThrottledBatchExecutor](b.executor); !ok {
+			return fmt.Errorf("%w: executor %T does not support runtime concurrency or retry changes", errors.ErrUnsupported, b.executor)
+		}
+	}
+	if cfg.ConcurrencyLimit != nil && executor.adaptive != nil {
+		return fmt.Errorf("%w: concurrency limit is managed by adaptive concurrency", errors.ErrUnsupported)
+	}
+	if cfg.ConcurrencyLimit != nil {
+		executor.WithConcurrencyLimit(*cfg.ConcurrencyLimit)
+	}
+	if cfg.Retry != nil {
+		executor.WithRetryConfig(*cfg.Retry)
+	}
+
+	// 与独立管道的懒创建互斥：新建的管道要么在此之前创建（随后被替换），要么使用新参数
+	b.schemaPipelinesMu.Lock()
+	defer b.schemaPipelinesMu.Unlock()
+	cur := b.settings.Load()
+	next := *cur
+	if cfg.FlushSize > 0 {
+		next.size = cfg.FlushSize
+	}
+	if cfg.FlushInterval > 0 {
+		next.interval = cfg.FlushInterval
+	}
+	if next == *cur {
+		return nil
+	}
+	b.settings.Store(&next)
+	if b.pipeline != nil {
+		b.replaceStage(b.pipeline, b.pipelineConfig(""))
+	}
+	b.schemaPipelines.Range(func(k, v any) bool {
+		b.replaceStage(v.(*pipelineHandle), b.pipelineConfig(k.(string)))
+		return true
+	})
+	b.logger.log(context.Background(), slog.LevelInfo, "batchsql: reconfigured",
+		slog.Uint64("flush_size", uint64(next.size)), slog.Duration("flush_interval", next.interval))
+	return nil
+}
+
+// pipelineConfig 按当前攒批参数生成管道配置（name 为空表示共享管道）
+func (b *BatchSQL) pipelineConfig(name string) gopipeline.PipelineConfig {
+	cfg := b.config
+	if cur := b.settings.Load(); cur != nil {
+		cfg.FlushSize, cfg.FlushInterval = cur.size, cur.interval
+	}
+	if name == "" {
+		return gopipeline.PipelineConfig{
+			BufferSize:    cfg.BufferSize,
+			FlushSize:     cfg.FlushSize,
+			FlushInterval: cfg.FlushInterval,
+		}
+	}
+	return cfg.schemaPipelineConfig(name)
+}
+
+// startStage 创建并异步启动一代管道
+// 刷新使用 BatchSQL 生命周期 ctx：旧管道退役（结束其循环）不影响进行中的刷新；错误汇总到统一错误通道
+func (b *BatchSQL) startStage(h *pipelineHandle, config gopipeline.PipelineConfig) *pipelineStage {
+	ctx, cancel := context.WithCancel(b.ctx)
+	st := &pipelineStage{config: config, cancel: cancel, flushBytes: b.config.Memory.FlushBytes}
+	st.pipeline = gopipeline.NewStandardPipeline(config, func(_ context.Context, batchData []*Request) error {
+		st.taken.Add(int64(len(batchData)))
+		st.flushedBytes(batchData)
+		if batchData = dropFillers(batchData); len(batchData) == 0 {
+			return nil
+		}
+		if err := h.flushFunc(b.ctx, batchData); err != nil {
+			// 非阻塞投递，满则丢弃（与 go-pipeline 错误通道语义一致）
+			select {
+			case b.mergedErrorChan(0) <- err:
+			default:
+			}
+		}
+		return nil
+	})
+	go func() {
+		_ = st.pipeline.AsyncPerform(ctx)
+	}()
+	return st
+}
+
+// replaceStage 以新配置替换管道，旧管道在后台排空后退役
+func (b *BatchSQL) replaceStage(h *pipelineHandle, config gopipeline.PipelineConfig) {
+	old := h.stage.Load()
+	if old.config == config {
+		return
+	}
+	h.stage.Store(b.startStage(h, config))
+	go b.retireStage(old)
+}
+
+// retireStage 停止向旧管道送入，待已送入的请求全部交给刷新函数后结束其循环
+// go-pipeline 没有主动刷新接口：通道排空后以空请求补齐当前批次使其立即刷新，不必等待旧的刷新间隔
+func (b *BatchSQL) retireStage(st *pipelineStage) {
+	st.mu.Lock()
+	st.retired = true
+	st.mu.Unlock()
+
+	flushSize := int64(st.config.FlushSize)
+	ticker := time.NewTicker(min(max(st.config.FlushInterval/4, time.Millisecond), 50*time.Millisecond))
+	defer ticker.Stop()
+	for {
+		pending := st.sent.Load() - st.taken.Load()
+		if pending <= 0 {
+			break
+		}
+		if rem := pending % max(flushSize, 1); rem > 0 && len(st.pipeline.DataChan()) == 0 {
+			for i := rem; i < flushSize; i++ {
+				select {
+				case st.pipeline.DataChan() <- nil:
+					st.sent.Add(1)
+				case <-b.ctx.Done():
+					return
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-b.ctx.Done():
+			return
+		}
+	}
+	st.cancel()
+}
+
+// dropFillers 过滤退役时补齐批次用的空请求
+func dropFillers(batchData []*Request) []*Request {
+	for i, r := range batchData {
+		if r == nil {
+			out := batchData[:i:i]
+			for _, r := range batchData[i+1:] {
+				if r != nil {
+					out = append(out, r)
+				}
+			}
+			return out
+		}
+	}
+	return batchData
+}
+
+// trySend 非阻塞送入前置队列或当前管道
+func (h *pipelineHandle) trySend(r *Request) bool {
+	if h.front != nil {
+		select {
+		case h.front <- r:
+			return true
+		default:
+			return false
+		}
+	}
+	for {
+		st := h.stage.Load()
+		st.mu.RLock()
+		if st.retired {
+			// 已被替换，重新读取当前管道
+			st.mu.RUnlock()
+			continue
+		}
+		select {
+		case st.pipeline.DataChan() <- r:
+			st.sent.Add(1)
+			st.sentBytes(r)
+			st.mu.RUnlock()
+			return true
+		default:
+			st.mu.RUnlock()
+			return false
+		}
+	}
+}
+
+// send 阻塞送入前置队列或当前管道，done 关闭时放弃并返回 false
+func (h *pipelineHandle) send(done <-chan struct{}, r *Request) bool {
+	if h.front != nil {
+		select {
+		case h.front <- r:
+			return true
+		case <-done:
+			return false
+		}
+	}
+	return h.sendStage(done, r)
+}
+
+// sendStage 阻塞送入当前管道（绕过前置队列）
+func (h *pipelineHandle) sendStage(done <-chan struct{}, r *Request) bool {
+	for {
+		st := h.stage.Load()
+		st.mu.RLock()
+		if st.retired {
+			st.mu.RUnlock()
+			continue
+		}
+		select {
+		case st.pipeline.DataChan() <- r:
+			st.sent.Add(1)
+			st.sentBytes(r)
+			st.mu.RUnlock()
+			return true
+		case <-done:
+			st.mu.RUnlock()
+			return false
+		}
+	}
+}
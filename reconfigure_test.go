@@ -0,0 +1,181 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestReconfigure_FlushSizeAndIntervalWithoutLosingRequests(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     100,
+		FlushInterval: time.Hour,
+	})
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 7; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+
+	// 旧管道中的 7 个请求应立即刷新，而不是等待一小时的旧刷新间隔
+	if err := batch.Reconfigure(batchsql.RuntimeConfig{FlushSize: 5, FlushInterval: 20 * time.Millisecond}); err != nil {
+		t.Fatalf("reconfigure: %v", err)
+	}
+	waitRowsWritten(t, batch, 7)
+
+	for i := 7; i < 17; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	waitRowsWritten(t, batch, 17)
+	batches := mock.SnapshotExecutedBatches()
+	for _, b := range batches[1:] {
+		if len(b) > 5 {
+			t.Fatalf("expected batches of at most 5 rows after reconfigure, got %d", len(b))
+		}
+	}
+}
+
+func TestReconfigure_ConcurrentWithSubmitKeepsOrder(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	exec := &orderRecordingExecutor{seen: make(map[string][]int64)}
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    64,
+		FlushSize:     8,
+		FlushInterval: 5 * time.Millisecond,
+		Ordering:      batchsql.OrderingConfig{Mode: batchsql.OrderingPerSchema},
+	}, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_ = batch.Reconfigure(batchsql.RuntimeConfig{FlushSize: uint32(3 + i%7), FlushInterval: time.Duration(1+i%3) * time.Millisecond})
+			time.Sleep(time.Millisecond)
+		}
+	}()
+	const total = 500
+	for i := 0; i < total; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	wg.Wait()
+	waitRowsWritten(t, batch, total)
+
+	ids := exec.snapshot("events")
+	if len(ids) != total {
+		t.Fatalf("expected %d rows, got %d", total, len(ids))
+	}
+	for i, id := range ids {
+		if id != int64(i) {
+			t.Fatalf("rows executed out of order at %d: %v", i, id)
+		}
+	}
+}
+
+// limitProbeProcessor 记录并发执行的最大批次数
+type limitProbeProcessor struct {
+	active, peak atomic.Int32
+	calls        atomic.Int32
+}
+
+func (p *limitProbeProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	return batchsql.Operations{}, nil
+}
+
+func (p *limitProbeProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	n := p.active.Add(1)
+	defer p.active.Add(-1)
+	for {
+		peak := p.peak.Load()
+		if n <= peak || p.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if p.calls.Add(1) == 1 {
+		return errors.New("deadlock detected")
+	}
+	return nil
+}
+
+func TestReconfigure_ExecutorConcurrencyAndRetry(t *testing.T) {
+	proc := &limitProbeProcessor{}
+	exec := batchsql.NewThrottledBatchExecutor(proc).WithConcurrencyLimit(8)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQL(ctx, 100, 10, time.Hour, exec)
+
+	limit := 2
+	if err := batch.Reconfigure(batchsql.RuntimeConfig{
+		ConcurrencyLimit: &limit,
+		Retry:            &batchsql.RetryConfig{Enabled: true, MaxAttempts: 2, BackoffBase: time.Millisecond, MaxBackoff: time.Millisecond},
+	}); err != nil {
+		t.Fatalf("reconfigure: %v", err)
+	}
+	if exec.ConcurrencyLimit() != 2 {
+		t.Fatalf("expected concurrency limit 2, got %d", exec.ConcurrencyLimit())
+	}
+
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	var wg sync.WaitGroup
+	var failed atomic.Int32
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := exec.ExecuteBatch(ctx, schema, []map[string]any{{"id": int64(i)}}); err != nil {
+				failed.Add(1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if proc.peak.Load() > 2 {
+		t.Fatalf("expected at most 2 concurrent batches, got %d", proc.peak.Load())
+	}
+	if failed.Load() != 0 || exec.Stats().Retried != 1 {
+		t.Fatalf("expected the failed attempt to be retried, failed=%d retried=%d", failed.Load(), exec.Stats().Retried)
+	}
+
+	mockBatch, _ := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 10, FlushInterval: time.Hour})
+	if err := mockBatch.Reconfigure(batchsql.RuntimeConfig{ConcurrencyLimit: &limit}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported for mock executor, got %v", err)
+	}
+}
+
+func TestReconfigure_ConcurrencyLimitRejectedUnderAdaptive(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := batchsql.NewThrottledBatchExecutor(okProcessor{}).
+		WithAdaptiveConcurrency(batchsql.AdaptiveConcurrencyConfig{MinLimit: 2, MaxLimit: 8, TargetLatency: time.Second})
+	before := exec.ConcurrencyLimit()
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{BufferSize: 10, FlushSize: 10, FlushInterval: time.Hour}, exec)
+
+	limit := 1
+	if err := batch.Reconfigure(batchsql.RuntimeConfig{ConcurrencyLimit: &limit, FlushSize: 5}); !errors.Is(err, errors.ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported under adaptive concurrency, got %v", err)
+	}
+	if got := exec.ConcurrencyLimit(); got != before {
+		t.Fatalf("adaptive limit must be unchanged, got %d want %d", got, before)
+	}
+
+	// 不涉及并发上限的调整照常生效
+	if err := batch.Reconfigure(batchsql.RuntimeConfig{FlushSize: 5}); err != nil {
+		t.Fatalf("reconfigure flush size: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package batchsql
 
 import (
+	"context"
 	"fmt"
 	"time"
 )
@@ -9,6 +10,16 @@ import (
 type Request struct {
 	schema  *Schema
 	columns map[string]any // 使用 map 存储列名到值的映射
+	seq     uint64         // 顺序模式下的提交序号（由 BatchSQL 分配）
+	// 链路追踪：Submit 时的 ctx（含 submit span），用于关联批次 span；未启用追踪时为 nil
+	traceCtx context.Context
+	// 预写日志：请求所在日志段与 LSN（未启用 WAL 或已确认时 walSeg 为 nil）
+	walSeg *walSegment
+	walLSN uint64
+	// 内存预算：入队时计入的估算字节数（未计入或已释放时为 0）
+	memSize int64
+	// 完成回调（OnComplete），调用后置空
+	onComplete func(err error)
 }
 
 func NewRequest(schema *Schema) *Request {
@@ -37,6 +48,23 @@ func (r *Request) GetOrderedValues() []any {
 	return values
 }
 
+// OnComplete 设置完成回调：请求所在批次执行结束（成功为 nil，失败为批次错误）或在缓冲区中被淘汰（ErrQueueFull）时调用一次
+// 批次落盘或溢出转存到落盘队列（OverflowSpill）的请求在重放结束后调用：重放成功为 nil，判定无法恢复而转为 .dead 时为重放错误；
+// 进程退出前未重放、Submit 返回错误（未入队）或 BatchSQL 关闭时仍在缓冲区的请求不会调用
+// 回调在刷新 goroutine 中执行，应尽快返回；需在 Submit 前设置
+func (r *Request) OnComplete(fn func(err error)) *Request {
+	r.onComplete = fn
+	return r
+}
+
+// complete 调用完成回调（至多一次）
+func (r *Request) complete(err error) {
+	if fn := r.onComplete; fn != nil {
+		r.onComplete = nil
+		fn(err)
+	}
+}
+
 // 类型化的设置方法
 func (r *Request) SetInt32(colName string, value int32) *Request {
 	r.columns[colName] = value
@@ -156,6 +184,15 @@ func (r *Request) GetTime(colName string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("column %s is not time.Time", colName)
 }
 
+// EstimatedSize 估算请求写入数据库时的字节数（各列值之和，不追求精确）
+func (r *Request) EstimatedSize() int {
+	n := 0
+	for _, v := range r.columns {
+		n += estimateValueSize(v)
+	}
+	return n
+}
+
 // 验证请求是否包含所有必需的列
 func (r *Request) Validate() error {
 	for _, colName := range r.schema.Columns {
@@ -14,6 +14,8 @@ type Schema struct {
 	Name             string
 	Columns          []string
 	ConflictStrategy ConflictStrategy
+	// ConflictColumns 冲突键列（唯一键/主键）；为空时默认取第一列
+	ConflictColumns []string
 }
 
 // NewSchema 创建新的Schema实例
@@ -28,3 +30,20 @@ func NewSchema(
 		Columns:          columns,
 	}
 }
+
+// WithConflictColumns 设置冲突键列（用于 PostgreSQL ON CONFLICT 目标与批内去重）
+func (s *Schema) WithConflictColumns(columns ...string) *Schema {
+	s.ConflictColumns = columns
+	return s
+}
+
+// ConflictKeyColumns 返回冲突键列；未设置时默认取第一列（与历史行为一致）
+func (s *Schema) ConflictKeyColumns() []string {
+	if len(s.ConflictColumns) > 0 {
+		return s.ConflictColumns
+	}
+	if len(s.Columns) > 0 {
+		return s.Columns[:1]
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package batchsql_test
 
 import (
+	"context"
+	"strings"
 	"testing"
 
 	"github.com/rushairer/batchsql"
@@ -18,3 +20,23 @@ func TestNewSchema_Basic(t *testing.T) {
 		t.Fatalf("columns order unexpected: %#v", s.Columns)
 	}
 }
+
+func TestSchema_ConflictKeyColumns(t *testing.T) {
+	s := batchsql.NewSchema("users", batchsql.ConflictUpdate, "id", "name")
+	if got := s.ConflictKeyColumns(); len(got) != 1 || got[0] != "id" {
+		t.Fatalf("default conflict key should be first column, got %#v", got)
+	}
+
+	s.WithConflictColumns("tenant", "id")
+	if got := s.ConflictKeyColumns(); len(got) != 2 || got[0] != "tenant" || got[1] != "id" {
+		t.Fatalf("unexpected conflict key columns: %#v", got)
+	}
+
+	sql, _, err := batchsql.DefaultPostgreSQLDriver.GenerateInsertSQL(context.Background(), s, []map[string]any{{"id": 1, "name": "a"}})
+	if err != nil {
+		t.Fatalf("generate sql: %v", err)
+	}
+	if !strings.Contains(sql, "ON CONFLICT (tenant, id) DO UPDATE") {
+		t.Fatalf("postgres conflict target should use conflict columns: %s", sql)
+	}
+}
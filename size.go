@@ -0,0 +1,36 @@
+package batchsql
+
+import "time"
+
+// estimateValueSize 粗略估算单个值写入数据库时的字节数（用于限速与内存预算，不追求精确）
+func estimateValueSize(v any) int {
+	switch x := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return len(x)
+	case []byte:
+		return len(x)
+	case bool, int8, uint8:
+		return 1
+	case int16, uint16:
+		return 2
+	case int32, uint32, float32:
+		return 4
+	case int, int64, uint, uint64, float64, time.Time:
+		return 8
+	default:
+		return 16
+	}
+}
+
+// estimateRowsSize 估算一批行数据的字节数
+func estimateRowsSize(data []map[string]any) int {
+	n := 0
+	for _, row := range data {
+		for _, v := range row {
+			n += estimateValueSize(v)
+		}
+	}
+	return n
+}
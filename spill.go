@@ -0,0 +1,499 @@
+package batchsql
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SpillConfig 落盘队列配置（ThrottledBatchExecutor.EnableSpill）
+//
+// 数据库长时间不可用时，最终失败（或被熔断拒绝）的批次写入本地文件队列并视为成功返回，
+// 管道得以继续刷新、生产者不再阻塞；后台重放协程按退避策略持续尝试，数据库恢复后按落盘顺序排空。
+// 经 BatchSQL 执行的批次落盘后，其请求的 OnComplete 推迟到重放结束时调用（成功为 nil，转为 .dead 时为错误）
+//
+// 与 PipelineConfig.Ordering 同用时，队列中仍有某顺序键的批次期间，该键的新批次直接排在其后落盘，
+// 不会先于旧批次写入数据库；未启用顺序保证时，新批次照常直接执行，重放的旧数据可能覆盖较新的同键数据
+type SpillConfig struct {
+	// Dir 队列目录（不存在时自动创建）；重启后继续重放目录中已有的批次
+	Dir string
+	// MaxBytes 磁盘配额；超出后不再落盘，批次按原错误失败；<=0 使用默认值 1GB
+	MaxBytes int64
+	// Backoff 重放失败后的退避策略；默认 ExponentialBackoff{Base: 500ms, Max: 30s, Jitter: 0.2}
+	Backoff BackoffStrategy
+	// ShouldSpill 判断失败的批次是否落盘（可选）；默认：熔断拒绝、单次超时与重试分类器判定为可重试的错误
+	// 重放时返回 false 的批次视为无法恢复，改名为 .dead 保留在目录中供人工处理
+	ShouldSpill func(error) bool
+}
+
+const (
+	defaultSpillMaxBytes    = 1 << 30
+	defaultSpillBackoffBase = 500 * time.Millisecond
+	defaultSpillBackoffMax  = 30 * time.Second
+
+	spillFileExt = ".spill"
+	spillDeadExt = ".dead"
+	spillTempExt = ".tmp"
+)
+
+// errSpillQuotaExceeded 落盘队列超出磁盘配额
+var errSpillQuotaExceeded = errors.New("batchsql: spill quota exceeded")
+
+// spillEntry 队列中的一个批次文件
+type spillEntry struct {
+	seq     uint64
+	path    string
+	size    int64
+	batchID string // 幂等模式下的批次 id（文件名中十六进制编码），重放时沿用
+	keyHash string // 顺序键摘要（文件名第三段，未启用顺序保证时为空）
+}
+
+// spillQueue 文件队列：每个批次一个文件（按序号命名），先进先出
+type spillQueue struct {
+	cfg      SpillConfig
+	mu       sync.Mutex
+	entries  []spillEntry
+	keys     map[string]int         // 顺序键摘要 -> 队列中的批次数
+	onDone   map[uint64]func(error) // 序号 -> 重放结束回调（仅本进程内落盘的溢出请求）
+	bytes    int64
+	nextSeq  uint64
+	notify   chan struct{}
+	reporter func() MetricsReporter
+}
+
+func openSpillQueue(cfg SpillConfig, reporter func() MetricsReporter) (*spillQueue, error) {
+	if cfg.MaxBytes <= 0 {
+		cfg.MaxBytes = defaultSpillMaxBytes
+	}
+	if cfg.Backoff == nil {
+		cfg.Backoff = ExponentialBackoff{Base: defaultSpillBackoffBase, Max: defaultSpillBackoffMax, Jitter: 0.2}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("batchsql: spill: %w", err)
+	}
+	files, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("batchsql: spill: %w", err)
+	}
+
+	q := &spillQueue{cfg: cfg, nextSeq: 1, keys: make(map[string]int), onDone: make(map[uint64]func(error)), notify: make(chan struct{}, 1), reporter: reporter}
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, spillTempExt) {
+			// 崩溃时未完成的写入：对应批次当时未确认落盘，直接清理
+			_ = os.Remove(filepath.Join(cfg.Dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, spillFileExt) {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimSuffix(name, spillFileExt), "-", 3)
+		seq, err := strconv.ParseUint(parts[0], 16, 64)
+		if err != nil {
+			continue
+		}
+		var batchID []byte
+		if len(parts) > 1 {
+			if batchID, err = hex.DecodeString(parts[1]); err != nil {
+				continue
+			}
+		}
+		var keyHash string
+		if len(parts) > 2 {
+			keyHash = parts[2]
+		}
+		info, err := f.Info()
+		if err != nil {
+			return nil, fmt.Errorf("batchsql: spill: %w", err)
+		}
+		q.entries = append(q.entries, spillEntry{seq: seq, path: filepath.Join(cfg.Dir, name), size: info.Size(), batchID: string(batchID), keyHash: keyHash})
+		if keyHash != "" {
+			q.keys[keyHash]++
+		}
+		q.bytes += info.Size()
+		if seq >= q.nextSeq {
+			q.nextSeq = seq + 1
+		}
+	}
+	sort.Slice(q.entries, func(i, j int) bool { return q.entries[i].seq < q.entries[j].seq })
+	q.reportDepth()
+	return q, nil
+}
+
+// reportDepth 上报队列深度（调用方持有锁或处于初始化阶段）
+func (q *spillQueue) reportDepth() {
+	if sr, ok := q.reporter().(SpillMetricsReporter); ok {
+		sr.SetSpoolDepth(len(q.entries), q.bytes)
+	}
+}
+
+func (q *spillQueue) event(table, event string) {
+	if sr, ok := q.reporter().(SpillMetricsReporter); ok {
+		sr.IncSpillEvent(table, event)
+	}
+}
+
+// depth 当前队列深度
+func (q *spillQueue) depth() (int, int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries), q.bytes
+}
+
+// orderKeyHash 顺序键摘要（编码进文件名，分区键可能很长或含任意字符）
+func orderKeyHash(key string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
+
+// spillKeyHash 返回 ctx 中顺序键的摘要（未启用顺序保证时为空）
+func spillKeyHash(ctx context.Context) string {
+	if key, ok := orderKeyFromContext(ctx); ok {
+		return orderKeyHash(key)
+	}
+	return ""
+}
+
+type spillCompletionKey struct{}
+
+// spillCompletion 批次的完成回调接管点：executeChunk 经 ctx 传入，批次落盘成功后由落盘队列在重放结束时调用
+type spillCompletion struct {
+	onDone func(error)
+	taken  atomic.Bool
+}
+
+func withSpillCompletion(ctx context.Context, c *spillCompletion) context.Context {
+	return context.WithValue(ctx, spillCompletionKey{}, c)
+}
+
+func spillCompletionFromContext(ctx context.Context) *spillCompletion {
+	c, _ := ctx.Value(spillCompletionKey{}).(*spillCompletion)
+	return c
+}
+
+// callback 交给落盘队列的回调（nil 接收者返回 nil）
+func (c *spillCompletion) callback() func(error) {
+	if c == nil {
+		return nil
+	}
+	return c.onDone
+}
+
+// take 落盘成功后标记回调已由落盘队列接管
+func (c *spillCompletion) take() {
+	if c != nil {
+		c.taken.Store(true)
+	}
+}
+
+// holds 队列中是否还有该顺序键（摘要）的批次
+func (q *spillQueue) holds(keyHash string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.keys[keyHash] > 0
+}
+
+// push 将批次写入队列：先写临时文件并 fsync，再原子改名，保证队列中只存在完整的批次
+// batchID、顺序键摘要非空时编码进文件名（<seq>-<hex(id)>[-<keyhash>].spill）
+// onDone 非空时在该批次重放成功（nil）或判定无法恢复（错误）后调用；进程退出前未重放则不会调用
+// （请求的完成回调随之丢失，重启后目录中的批次照常重放）
+func (q *spillQueue) push(schema *Schema, data []map[string]any, batchID, keyHash string, onDone func(error)) error {
+	var buf, payload []byte
+	for _, row := range data {
+		var err error
+		if payload, err = appendRequest(payload[:0], &Request{schema: schema, columns: row}); err != nil {
+			return err
+		}
+		buf = appendFrame(buf, payload)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.bytes+int64(len(buf)) > q.cfg.MaxBytes {
+		return errSpillQuotaExceeded
+	}
+	seq := q.nextSeq
+	name := fmt.Sprintf("%016x", seq)
+	if batchID != "" || keyHash != "" {
+		name += "-" + hex.EncodeToString([]byte(batchID))
+	}
+	if keyHash != "" {
+		name += "-" + keyHash
+	}
+	path := filepath.Join(q.cfg.Dir, name+spillFileExt)
+	if err := writeFileSync(path+spillTempExt, buf); err != nil {
+		return err
+	}
+	if err := os.Rename(path+spillTempExt, path); err != nil {
+		_ = os.Remove(path + spillTempExt)
+		return fmt.Errorf("batchsql: spill: %w", err)
+	}
+	q.nextSeq++
+	q.entries = append(q.entries, spillEntry{seq: seq, path: path, size: int64(len(buf)), batchID: batchID, keyHash: keyHash})
+	if keyHash != "" {
+		q.keys[keyHash]++
+	}
+	if onDone != nil {
+		q.onDone[seq] = onDone
+	}
+	q.bytes += int64(len(buf))
+	q.reportDepth()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("batchsql: spill: %w", err)
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return fmt.Errorf("batchsql: spill: %w", err)
+	}
+	return nil
+}
+
+// peek 返回最早的批次
+func (q *spillQueue) peek() (spillEntry, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 {
+		return spillEntry{}, false
+	}
+	return q.entries[0], true
+}
+
+// load 读取批次文件
+func (q *spillQueue) load(entry spillEntry) (*Schema, []map[string]any, error) {
+	raw, err := os.ReadFile(entry.path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("batchsql: spill: %w", err)
+	}
+	schemas := make(schemaCache)
+	var (
+		schema *Schema
+		data   []map[string]any
+	)
+	for off := 0; off < len(raw); {
+		payload, next, ok := nextFrame(raw, off)
+		if !ok {
+			return nil, nil, fmt.Errorf("batchsql: spill file %s: %w", entry.path, errCorruptRecord)
+		}
+		r, err := decodeRequest(payload, schemas)
+		if err != nil {
+			return nil, nil, fmt.Errorf("batchsql: spill file %s: %w", entry.path, err)
+		}
+		schema = r.schema
+		data = append(data, r.columns)
+		off = next
+	}
+	if schema == nil {
+		return nil, nil, fmt.Errorf("batchsql: spill file %s: %w", entry.path, ErrEmptyBatch)
+	}
+	return schema, data, nil
+}
+
+// done 从队列中移除批次：重放成功（err 为 nil）时删除文件，无法恢复时改名为 .dead；随后调用重放结束回调
+func (q *spillQueue) done(entry spillEntry, err error) {
+	if err != nil {
+		_ = os.Rename(entry.path, strings.TrimSuffix(entry.path, spillFileExt)+spillDeadExt)
+	} else {
+		_ = os.Remove(entry.path)
+	}
+	q.mu.Lock()
+	if len(q.entries) > 0 && q.entries[0].seq == entry.seq {
+		q.entries = q.entries[1:]
+		q.bytes -= entry.size
+		if entry.keyHash != "" {
+			if q.keys[entry.keyHash]--; q.keys[entry.keyHash] <= 0 {
+				delete(q.keys, entry.keyHash)
+			}
+		}
+	}
+	onDone := q.onDone[entry.seq]
+	delete(q.onDone, entry.seq)
+	q.reportDepth()
+	q.mu.Unlock()
+	if onDone != nil {
+		onDone(err)
+	}
+}
+
+// EnableSpill 开启落盘队列并启动后台重放协程（ctx 结束时停止）；目录中已有的批次会继续重放
+// 落盘成功的批次对上游视为成功（BatchSQL 的 WAL 会据此 checkpoint，由落盘队列接管持久化）
+// 需在开始执行批次前调用且只能调用一次
+func (e *ThrottledBatchExecutor) EnableSpill(ctx context.Context, cfg SpillConfig) error {
+	if e.spill != nil {
+		return fmt.Errorf("batchsql: spill already enabled")
+	}
+	q, err := openSpillQueue(cfg, func() MetricsReporter { return e.metricsReporter })
+	if err != nil {
+		return err
+	}
+	e.spill = q
+	go e.replaySpill(ctx, q)
+	return nil
+}
+
+// SpoolDepth 返回落盘队列中的批次数与字节数（未开启时为 0）
+func (e *ThrottledBatchExecutor) SpoolDepth() (batches int, bytes int64) {
+	if e.spill == nil {
+		return 0, 0
+	}
+	return e.spill.depth()
+}
+
+// shouldSpill 判断最终失败的批次是否落盘
+func (e *ThrottledBatchExecutor) shouldSpill(err error) bool {
+	if e.spill.cfg.ShouldSpill != nil {
+		return e.spill.cfg.ShouldSpill(err)
+	}
+	if errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrAttemptTimeout) {
+		return true
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	classify := e.retryPolicy().classifier
+	if classify == nil {
+		classify = defaultRetryClassifier
+	}
+	retryable, _ := classify(err)
+	return retryable
+}
+
+// spillBatch 尝试将失败的批次落盘；成功返回 nil，否则返回原错误
+func (e *ThrottledBatchExecutor) spillBatch(ctx context.Context, schema *Schema, data []map[string]any, cause error) error {
+	if !e.shouldSpill(cause) {
+		return cause
+	}
+	batchID, _ := BatchIDFromContext(ctx)
+	completion := spillCompletionFromContext(ctx)
+	if err := e.spill.push(schema, data, batchID, spillKeyHash(ctx), completion.callback()); err != nil {
+		event := "spill_failed"
+		if errors.Is(err, errSpillQuotaExceeded) {
+			event = "quota_exceeded"
+		}
+		e.spill.event(schema.Name, event)
+		e.logger.sampled(ctx, slog.LevelError, "batchsql: spill failed",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Any("error", err))
+		return errors.Join(cause, err)
+	}
+	completion.take()
+	e.spill.event(schema.Name, "spilled")
+	e.logger.sampled(ctx, slog.LevelWarn, "batchsql: batch spilled",
+		slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Any("error", cause))
+	return nil
+}
+
+// spillBehind 顺序模式下，队列中已有同一顺序键的批次时，新批次不执行而直接排在其后落盘
+// 落盘失败时返回错误（不能越过队列中的旧批次直接执行）
+func (e *ThrottledBatchExecutor) spillBehind(ctx context.Context, schema *Schema, data []map[string]any, keyHash string) error {
+	batchID, _ := BatchIDFromContext(ctx)
+	completion := spillCompletionFromContext(ctx)
+	if err := e.spill.push(schema, data, batchID, keyHash, completion.callback()); err != nil {
+		event := "spill_failed"
+		if errors.Is(err, errSpillQuotaExceeded) {
+			event = "quota_exceeded"
+		}
+		e.spill.event(schema.Name, event)
+		e.logger.sampled(ctx, slog.LevelError, "batchsql: spill failed",
+			slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.Any("error", err))
+		return fmt.Errorf("batchsql: ordered batch queued behind spilled batches: %w", err)
+	}
+	completion.take()
+	e.spill.event(schema.Name, "spilled")
+	return nil
+}
+
+// replaySpill 后台重放：按落盘顺序逐个执行，失败时退避后从队首重试
+func (e *ThrottledBatchExecutor) replaySpill(ctx context.Context, q *spillQueue) {
+	var (
+		failures int
+		sleep    time.Duration
+	)
+	for {
+		entry, ok := q.peek()
+		if !ok {
+			select {
+			case <-q.notify:
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		schema, data, err := q.load(entry)
+		if err != nil {
+			q.done(entry, err)
+			q.event("", "dead")
+			e.logger.log(ctx, slog.LevelError, "batchsql: spilled batch unreadable", slog.String("file", entry.path), slog.Any("error", err))
+			continue
+		}
+
+		replayCtx := ctx
+		if entry.batchID != "" {
+			replayCtx = WithBatchID(ctx, entry.batchID)
+		}
+		replayCtx = e.withBatchID(replayCtx)
+		if e.chain != nil {
+			err = e.chain.ExecuteBatch(replayCtx, schema, data)
+		} else {
+			err = e.executeBatch(replayCtx, schema, data)
+		}
+		if err == nil {
+			q.done(entry, nil)
+			q.event(schema.Name, "replayed")
+			failures, sleep = 0, 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if !e.shouldSpill(err) {
+			q.done(entry, err)
+			q.event(schema.Name, "dead")
+			e.logger.log(ctx, slog.LevelError, "batchsql: spilled batch dead",
+				slog.String("table", schema.Name), slog.Int("rows", len(data)), slog.String("file", entry.path), slog.Any("error", err))
+			continue
+		}
+
+		failures++
+		sleep = q.cfg.Backoff.Backoff(failures, sleep)
+		q.event(schema.Name, "replay_failed")
+		timer := time.NewTimer(sleep)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// outageProcessor 按当前设置返回错误（once 仅作用于下一次执行），并记录成功执行的批次
+type outageProcessor struct {
+	mu      sync.Mutex
+	err     error
+	once    error
+	batches [][]map[string]any
+	pending [][]map[string]any
+}
+
+func (p *outageProcessor) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+func (p *outageProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, data)
+	return batchsql.Operations{}, nil
+}
+
+func (p *outageProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data := p.pending[len(p.pending)-1]
+	p.pending = p.pending[:len(p.pending)-1]
+	if err := p.once; err != nil {
+		p.once = nil
+		return err
+	}
+	if p.err != nil {
+		return p.err
+	}
+	p.batches = append(p.batches, data)
+	return nil
+}
+
+func (p *outageProcessor) executed() [][]map[string]any {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([][]map[string]any(nil), p.batches...)
+}
+
+// spillMetrics 记录落盘事件与队列深度
+type spillMetrics struct {
+	batchsql.NoopMetricsReporter
+	mu     sync.Mutex
+	events map[string]int
+	depth  int
+}
+
+func newSpillMetrics() *spillMetrics { return &spillMetrics{events: make(map[string]int)} }
+
+func (m *spillMetrics) SetSpoolDepth(batches int, bytes int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.depth = batches
+}
+
+func (m *spillMetrics) IncSpillEvent(table string, event string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[event]++
+}
+
+func (m *spillMetrics) event(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.events[name]
+}
+
+func waitSpoolDrained(t *testing.T, exec *batchsql.ThrottledBatchExecutor) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if n, _ := exec.SpoolDepth(); n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	n, _ := exec.SpoolDepth()
+	t.Fatalf("spool not drained, %d batches left", n)
+}
+
+func TestSpill_OutageSpillsAndReplaysWhenHealthy(t *testing.T) {
+	proc := &outageProcessor{err: errors.New("dial tcp: connection refused")}
+	m := newSpillMetrics()
+	exec := batchsql.NewThrottledBatchExecutor(proc).WithMetricsReporter(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), Backoff: batchsql.ConstantBackoff{Delay: 5 * time.Millisecond}}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id", "amount")
+	for i := 0; i < 2; i++ {
+		data := []map[string]any{{"id": int64(i), "amount": 9.5}}
+		if err := exec.ExecuteBatch(context.Background(), schema, data); err != nil {
+			t.Fatalf("spilled batch should be reported as success, got %v", err)
+		}
+	}
+	if n, bytes := exec.SpoolDepth(); n != 2 || bytes == 0 {
+		t.Fatalf("expected 2 spooled batches, got %d (%d bytes)", n, bytes)
+	}
+	if m.event("spilled") != 2 {
+		t.Fatalf("expected 2 spilled events, got %v", m.events)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	if m.event("replay_failed") == 0 {
+		t.Fatalf("expected replay attempts during the outage")
+	}
+
+	proc.setErr(nil)
+	waitSpoolDrained(t, exec)
+	batches := proc.executed()
+	if len(batches) != 2 || batches[0][0]["id"] != int64(0) || batches[1][0]["id"] != int64(1) || batches[1][0]["amount"] != 9.5 {
+		t.Fatalf("expected spooled batches replayed in order, got %v", batches)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.events["replayed"] != 2 || m.depth != 0 {
+		t.Fatalf("unexpected spill metrics: events=%v depth=%d", m.events, m.depth)
+	}
+}
+
+func TestSpill_NonRetryableAndQuota(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id")
+	data := []map[string]any{{"id": int64(1)}}
+
+	exec := batchsql.NewThrottledBatchExecutor(nonRetryProcessor{})
+	if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	if err := exec.ExecuteBatch(context.Background(), schema, data); err == nil {
+		t.Fatalf("non-retryable failure should not be spilled")
+	}
+
+	m := newSpillMetrics()
+	full := batchsql.NewThrottledBatchExecutor(&outageProcessor{err: errors.New("connection refused")}).WithMetricsReporter(m)
+	if err := full.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), MaxBytes: 8}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	if err := full.ExecuteBatch(context.Background(), schema, data); err == nil {
+		t.Fatalf("expected original error when quota is exceeded")
+	}
+	if n, _ := full.SpoolDepth(); n != 0 || m.event("quota_exceeded") != 1 {
+		t.Fatalf("expected quota rejection, depth=%d events=%v", n, m.events)
+	}
+}
+
+func TestSpill_ResumesAfterRestartAndQuarantinesDeadBatches(t *testing.T) {
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id")
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	down := batchsql.NewThrottledBatchExecutor(&outageProcessor{err: errors.New("connection refused")})
+	if err := down.EnableSpill(ctx1, batchsql.SpillConfig{Dir: dir, Backoff: batchsql.ConstantBackoff{Delay: time.Hour}}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := down.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": int64(i)}}); err != nil {
+			t.Fatalf("execute: %v", err)
+		}
+	}
+	cancel1()
+
+	// 重启后：第一个批次变为不可重试错误（进入 .dead），第二个成功
+	proc := &outageProcessor{once: errors.New("syntax error near 'VALUES'")}
+	m := newSpillMetrics()
+	up := batchsql.NewThrottledBatchExecutor(proc).WithMetricsReporter(m)
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	if err := up.EnableSpill(ctx2, batchsql.SpillConfig{Dir: dir}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	waitSpoolDrained(t, up)
+	if m.event("dead") != 1 {
+		t.Fatalf("expected one dead batch event, got %v", m.events)
+	}
+
+	if dead, _ := filepath.Glob(filepath.Join(dir, "*.dead")); len(dead) != 1 {
+		t.Fatalf("expected one quarantined batch, got %v", dead)
+	}
+	if batches := proc.executed(); len(batches) != 1 || batches[0][0]["id"] != int64(1) {
+		t.Fatalf("expected the second batch to be replayed, got %v", batches)
+	}
+}
+
+// keyedStateProcessor 按 id 保存最后写入的值（模拟 upsert）；block 中的值在恢复前执行失败
+type keyedStateProcessor struct {
+	mu      sync.Mutex
+	block   string
+	state   map[int64]string
+	pending [][]map[string]any
+}
+
+func (p *keyedStateProcessor) unblock() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.block = ""
+}
+
+func (p *keyedStateProcessor) value(id int64) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state[id]
+}
+
+func (p *keyedStateProcessor) GenerateOperations(ctx context.Context, schema *batchsql.Schema, data []map[string]any) (batchsql.Operations, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append(p.pending, data)
+	return batchsql.Operations{}, nil
+}
+
+func (p *keyedStateProcessor) ExecuteOperations(ctx context.Context, ops batchsql.Operations) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	data := p.pending[len(p.pending)-1]
+	p.pending = p.pending[:len(p.pending)-1]
+	for _, row := range data {
+		if p.block != "" && row["v"] == p.block {
+			return errors.New("dial tcp: connection refused")
+		}
+	}
+	for _, row := range data {
+		p.state[row["id"].(int64)] = row["v"].(string)
+	}
+	return nil
+}
+
+func TestSpill_OrderedKeyQueuesBehindSpilledBatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	proc := &keyedStateProcessor{block: "A", state: make(map[int64]string)}
+	exec := batchsql.NewThrottledBatchExecutor(proc)
+	if err := exec.EnableSpill(ctx, batchsql.SpillConfig{Dir: t.TempDir(), Backoff: batchsql.ConstantBackoff{Delay: 5 * time.Millisecond}}); err != nil {
+		t.Fatalf("enable spill: %v", err)
+	}
+	schema := batchsql.NewSchema("accounts", batchsql.ConflictUpdate, "id", "v")
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    10,
+		FlushSize:     1,
+		FlushInterval: 5 * time.Millisecond,
+		Ordering: batchsql.OrderingConfig{
+			Mode:         batchsql.OrderingPerKey,
+			PartitionKey: func(r *batchsql.Request) string { return fmt.Sprint(r.GetOrderedValues()[0]) },
+		},
+	}, exec)
+
+	waitDepth := func(want int) {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			if n, _ := exec.SpoolDepth(); n == want {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		n, _ := exec.SpoolDepth()
+		t.Fatalf("expected spool depth %d, got %d", want, n)
+	}
+
+	// A 执行失败并落盘；B 本可直接成功，但必须排在 A 之后
+	if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 1).SetString("v", "A")); err != nil {
+		t.Fatalf("submit A: %v", err)
+	}
+	waitDepth(1)
+	if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 1).SetString("v", "B")); err != nil {
+		t.Fatalf("submit B: %v", err)
+	}
+	waitDepth(2)
+	if v := proc.value(1); v != "" {
+		t.Fatalf("B must not overtake the spilled A, state=%q", v)
+	}
+
+	// 其他键不受影响，照常直接执行
+	if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", 2).SetString("v", "C")); err != nil {
+		t.Fatalf("submit C: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && proc.value(2) == "" {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if proc.value(2) != "C" {
+		t.Fatalf("other keys should execute directly")
+	}
+
+	proc.unblock()
+	waitSpoolDrained(t, exec)
+	if v := proc.value(1); v != "B" {
+		t.Fatalf("replay must preserve submission order, final value %q", v)
+	}
+}
@@ -0,0 +1,161 @@
+package batchsql
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TableStats 单表统计快照
+type TableStats struct {
+	Submitted   int64     `json:"submitted"`            // 成功入队的请求数（仅 BatchSQL）
+	Dropped     int64     `json:"dropped"`              // 因缓冲区满被丢弃的请求数（仅 BatchSQL，见 OverflowConfig）
+	Spilled     int64     `json:"spilled"`              // 溢出转存到落盘队列的请求数（仅 BatchSQL，OverflowSpill）
+	Flushed     int64     `json:"flushed"`              // 已结束（成功或失败）的批次数
+	RowsWritten int64     `json:"rows_written"`         // 成功写入的行数
+	Failed      int64     `json:"failed"`               // 失败的批次数
+	FailedRows  int64     `json:"failed_rows"`          // 失败批次中的行数
+	Retried     int64     `json:"retried"`              // 重试次数（由 ThrottledBatchExecutor 统计）
+	InFlight    int64     `json:"in_flight"`            // 在途批次数
+	LastError   string    `json:"last_error,omitempty"` // 最近一次错误
+	LastErrorAt time.Time `json:"last_error_at"`        // 最近一次错误时间（无错误时为零值）
+}
+
+// Stats 统计快照；汇总字段为各表之和
+type Stats struct {
+	Submitted     int64                 `json:"submitted"`
+	Dropped       int64                 `json:"dropped"`
+	Spilled       int64                 `json:"spilled"`
+	Flushed       int64                 `json:"flushed"`
+	RowsWritten   int64                 `json:"rows_written"`
+	Failed        int64                 `json:"failed"`
+	FailedRows    int64                 `json:"failed_rows"`
+	Retried       int64                 `json:"retried"`
+	InFlight      int64                 `json:"in_flight"`
+	QueueLength   int                   `json:"queue_length"`   // 管道队列长度（近似，仅 BatchSQL）
+	BufferedBytes int64                 `json:"buffered_bytes"` // 已缓冲请求的估算字节数（仅 BatchSQL 且启用 MemoryConfig.MaxBufferedBytes）
+	Tables        map[string]TableStats `json:"tables"`
+}
+
+// StatsProvider 可提供统计快照的组件（BatchSQL、ThrottledBatchExecutor）
+type StatsProvider interface {
+	Stats() Stats
+}
+
+var (
+	_ StatsProvider = (*BatchSQL)(nil)
+	_ StatsProvider = (*ThrottledBatchExecutor)(nil)
+)
+
+// tableCounters 单表计数器（原子操作，热路径无锁）
+type tableCounters struct {
+	submitted   atomic.Int64
+	dropped     atomic.Int64
+	spilled     atomic.Int64
+	flushed     atomic.Int64
+	rowsWritten atomic.Int64
+	failed      atomic.Int64
+	failedRows  atomic.Int64
+	retried     atomic.Int64
+	inFlight    atomic.Int64
+	lastError   atomic.Pointer[lastError]
+}
+
+type lastError struct {
+	msg string
+	at  time.Time
+}
+
+// statsCollector 按表懒创建计数器
+type statsCollector struct {
+	tables sync.Map // table -> *tableCounters
+}
+
+func (s *statsCollector) table(name string) *tableCounters {
+	if v, ok := s.tables.Load(name); ok {
+		return v.(*tableCounters)
+	}
+	v, _ := s.tables.LoadOrStore(name, &tableCounters{})
+	return v.(*tableCounters)
+}
+
+// recordBatch 记录一个批次的结束
+func (s *statsCollector) recordBatch(table string, rows int, err error) {
+	t := s.table(table)
+	t.flushed.Add(1)
+	if err == nil {
+		t.rowsWritten.Add(int64(rows))
+		return
+	}
+	t.failed.Add(1)
+	t.failedRows.Add(int64(rows))
+	t.lastError.Store(&lastError{msg: err.Error(), at: time.Now()})
+}
+
+// recordSpilledRow 记录一个溢出转存请求的重放结果（不计为批次）
+func (s *statsCollector) recordSpilledRow(table string, err error) {
+	t := s.table(table)
+	if err == nil {
+		t.rowsWritten.Add(1)
+		return
+	}
+	t.failedRows.Add(1)
+	t.lastError.Store(&lastError{msg: err.Error(), at: time.Now()})
+}
+
+// snapshot 生成快照并汇总
+func (s *statsCollector) snapshot() Stats {
+	out := Stats{Tables: make(map[string]TableStats)}
+	s.tables.Range(func(k, v any) bool {
+		t := v.(*tableCounters)
+		ts := TableStats{
+			Submitted:   t.submitted.Load(),
+			Dropped:     t.dropped.Load(),
+			Spilled:     t.spilled.Load(),
+			Flushed:     t.flushed.Load(),
+			RowsWritten: t.rowsWritten.Load(),
+			Failed:      t.failed.Load(),
+			FailedRows:  t.failedRows.Load(),
+			Retried:     t.retried.Load(),
+			InFlight:    t.inFlight.Load(),
+		}
+		if le := t.lastError.Load(); le != nil {
+			ts.LastError, ts.LastErrorAt = le.msg, le.at
+		}
+		out.Tables[k.(string)] = ts
+		out.add(ts)
+		return true
+	})
+	return out
+}
+
+func (s *Stats) add(ts TableStats) {
+	s.Submitted += ts.Submitted
+	s.Dropped += ts.Dropped
+	s.Spilled += ts.Spilled
+	s.Flushed += ts.Flushed
+	s.RowsWritten += ts.RowsWritten
+	s.Failed += ts.Failed
+	s.FailedRows += ts.FailedRows
+	s.Retried += ts.Retried
+	s.InFlight += ts.InFlight
+}
+
+// StatsHandler 以 JSON 输出统计快照（可挂载到任意路由，如 /debug/batchsql）
+func StatsHandler(provider StatsProvider) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(provider.Stats())
+	})
+}
+
+// PublishStats 将统计快照注册为 expvar 变量（/debug/vars 中可见）
+// 与 expvar.Publish 一致：同名重复注册会 panic
+func PublishStats(name string, provider StatsProvider) {
+	expvar.Publish(name, expvar.Func(func() any { return provider.Stats() }))
+}
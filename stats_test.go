@@ -0,0 +1,88 @@
+package batchsql_test
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestStats_ExecutorCountsRetriesRowsAndFailures(t *testing.T) {
+	exec := batchsql.NewThrottledBatchExecutor(&fakeProcessor{failCount: 1, failReason: "deadlock"}).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond})
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	if err := exec.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}, {"id": 2}}); err != nil {
+		t.Fatalf("execute: %v", err)
+	}
+
+	s := exec.Stats()
+	if s.Flushed != 1 || s.RowsWritten != 2 || s.Retried != 1 || s.Failed != 0 || s.InFlight != 0 {
+		t.Fatalf("unexpected executor stats: %+v", s)
+	}
+
+	failing := batchsql.NewThrottledBatchExecutor(nonRetryProcessor{})
+	if err := failing.ExecuteBatch(context.Background(), schema, []map[string]any{{"id": 1}}); err == nil {
+		t.Fatalf("expected failure")
+	}
+	ts := failing.Stats().Tables["events"]
+	if ts.Failed != 1 || ts.FailedRows != 1 || ts.RowsWritten != 0 {
+		t.Fatalf("unexpected failure stats: %+v", ts)
+	}
+	if !strings.Contains(ts.LastError, "syntax error") || ts.LastErrorAt.IsZero() {
+		t.Fatalf("expected last error to be recorded, got %+v", ts)
+	}
+}
+
+func TestStats_BatchSQLSnapshotHandlerAndExpvar(t *testing.T) {
+	exec := batchsql.NewThrottledBatchExecutor(&fakeProcessor{failCount: 1, failReason: "deadlock"}).
+		WithRetryConfig(batchsql.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffBase: time.Millisecond})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQL(ctx, 10, 3, 10*time.Millisecond, exec)
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id")
+	for i := 0; i < 3; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for batch.Stats().Flushed < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	s := batch.Stats()
+	if s.Submitted != 3 || s.Flushed != 1 || s.RowsWritten != 3 || s.Retried != 1 || s.InFlight != 0 || s.QueueLength != 0 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if ts := s.Tables["events"]; ts.Submitted != 3 || ts.Retried != 1 {
+		t.Fatalf("unexpected table stats: %+v", ts)
+	}
+
+	rec := httptest.NewRecorder()
+	batchsql.StatsHandler(batch).ServeHTTP(rec, httptest.NewRequest("GET", "/debug/batchsql", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("unexpected content type %q", ct)
+	}
+	var decoded batchsql.Stats
+	if err := json.Unmarshal(rec.Body.Bytes(), &decoded); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if decoded.RowsWritten != 3 || decoded.Tables["events"].Submitted != 3 {
+		t.Fatalf("unexpected handler payload: %s", rec.Body.String())
+	}
+
+	// expvar 名称全局唯一（-count>1 时重复运行）
+	name := fmt.Sprintf("batchsql_stats_test_%d", time.Now().UnixNano())
+	batchsql.PublishStats(name, batch)
+	v := expvar.Get(name)
+	if v == nil || !strings.Contains(v.String(), `"rows_written":3`) {
+		t.Fatalf("expected stats to be published via expvar, got %v", v)
+	}
+}
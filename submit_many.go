@@ -0,0 +1,162 @@
+package batchsql
+
+import (
+	"context"
+	"fmt"
+)
+
+// SubmitMany 批量提交，返回与 requests 等长的错误切片（errs[i] 对应 requests[i]，可用 errors.Join 汇总）
+/*
+说明：
+- ctx 与生命周期只检查一次，同一 schema 只校验一次
+- 同一 schema 的请求数达到 FlushSize（按 schema 隔离时为该表的覆盖值）时按 FlushSize 切分，整批不经缓冲区直接交给刷新路径异步执行
+  （受执行器并发上限约束）；errs[i] 为 nil 表示已受理，执行结果与 Submit 一样通过 OnComplete 与 ErrorChan 通知
+- 剩余不足一批的请求按原顺序逐个入队（语义同 Submit，受溢出策略约束）
+- 启用顺序保证（Ordering）、内存预算（Memory）或预写日志（OpenWAL）时不走整批路径，全部按原顺序入队
+*/
+func (b *BatchSQL) SubmitMany(ctx context.Context, requests []*Request) []error {
+	errs := make([]error, len(requests))
+	fail := func(err error) []error {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+	if err := ctx.Err(); err != nil {
+		return fail(err)
+	}
+	if err := b.checkOpen(ctx); err != nil {
+		return fail(err)
+	}
+
+	// 按 schema 分组（组内保持提交顺序）
+	type submitGroup struct {
+		err     error
+		ctx     context.Context
+		end     func(error)
+		indexes []int
+	}
+	groups := make(map[*Schema]*submitGroup)
+	var order []*Schema
+	for i, request := range requests {
+		if request == nil {
+			errs[i] = ErrEmptyRequest
+			continue
+		}
+		g, ok := groups[request.schema]
+		if !ok {
+			g = &submitGroup{err: validateSchema(request.schema), ctx: ctx, end: noopEndSpan}
+			groups[request.schema] = g
+			order = append(order, request.schema)
+		}
+		if g.err != nil {
+			errs[i] = g.err
+			continue
+		}
+		g.indexes = append(g.indexes, i)
+	}
+
+	// 可选链路追踪：每个 schema 一个 submit span
+	if _, ok := b.metricsReporter.(TracingMetricsReporter); ok {
+		for _, schema := range order {
+			if g := groups[schema]; g.err == nil {
+				g.ctx, g.end = startSpan(b.metricsReporter, ctx, SpanInfo{Stage: SpanSubmit, Table: schema.Name, Rows: len(g.indexes)})
+				for _, i := range g.indexes {
+					requests[i].traceCtx = g.ctx
+				}
+			}
+		}
+	}
+
+	// 整批直接交给刷新路径（组级并发上限与执行器并发上限保持一致，<= 0 表示不限）
+	handled := make([]bool, len(requests))
+	if b.directEligible() {
+		var semaphore chan struct{}
+		if limit := executorConcurrencyLimit(b.executor); limit > 0 {
+			semaphore = make(chan struct{}, limit)
+		}
+		for _, schema := range order {
+			g := groups[schema]
+			// 与管道路径一致：按 schema 隔离时使用该表的 FlushSize 覆盖
+			name := ""
+			if b.config.PerSchemaPipeline {
+				name = schema.Name
+			}
+			flushSize := int(b.pipelineConfig(name).FlushSize)
+			if flushSize <= 0 {
+				continue
+			}
+			full := len(g.indexes) / flushSize * flushSize
+			for start := 0; start < full; start += flushSize {
+				indexes := g.indexes[start : start+flushSize]
+				chunk := make([]*Request, len(indexes))
+				for j, i := range indexes {
+					chunk[j] = requests[i]
+					handled[i] = true
+				}
+				b.submitDirect(schema, chunk, semaphore)
+			}
+		}
+	}
+
+	// 剩余请求按原顺序入队
+	for i, request := range requests {
+		if handled[i] || errs[i] != nil {
+			continue
+		}
+		g := groups[request.schema]
+		errs[i] = b.enqueue(g.ctx, request.schema, request, b.wal != nil, false)
+	}
+
+	for _, schema := range order {
+		g := groups[schema]
+		var firstErr error
+		for _, i := range g.indexes {
+			if errs[i] != nil {
+				firstErr = errs[i]
+				break
+			}
+		}
+		g.end(firstErr)
+	}
+	return errs
+}
+
+// directEligible 是否可绕过缓冲区整批执行：顺序调度、内存预算与预写日志均依赖请求经过缓冲区
+func (b *BatchSQL) directEligible() bool {
+	return b.config.Ordering.Mode == OrderingNone &&
+		b.config.Memory.FlushBytes <= 0 && b.config.Memory.MaxBufferedBytes <= 0 &&
+		b.wal == nil
+}
+
+// submitDirect 将一个整批交给刷新路径异步执行（SubmitMany），错误投递到 ErrorChan
+func (b *BatchSQL) submitDirect(schema *Schema, requests []*Request, semaphore chan struct{}) {
+	b.stats.table(schema.Name).submitted.Add(int64(len(requests)))
+	go func() {
+		if semaphore != nil {
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-b.ctx.Done():
+				// 生命周期已结束：executeChunk 立即以 ctx 错误结束并通知完成回调
+			}
+		}
+		if err := b.executeDirect(schema, requests); err != nil {
+			// 非阻塞投递，满则丢弃（与管道错误通道语义一致）
+			select {
+			case b.mergedErrorChan(0) <- err:
+			default:
+			}
+		}
+	}()
+}
+
+// executeDirect 使用 BatchSQL 生命周期 ctx 执行整批；panic 转为错误（完成回调已由 executeChunk 通知）
+func (b *BatchSQL) executeDirect(schema *Schema, requests []*Request) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &SchemaError{Table: schema.Name, Err: fmt.Errorf("%w: %v", ErrBatchPanicked, r)}
+		}
+	}()
+	return b.executeGroup(b.ctx, schema, requests)
+}
@@ -0,0 +1,178 @@
+package batchsql_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+func TestSubmitMany_DirectBatchesAndPerIndexErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:    1000,
+		FlushSize:     100,
+		FlushInterval: 10 * time.Millisecond,
+	})
+
+	users := batchsql.NewSchema("users", batchsql.ConflictIgnore, "id")
+	orders := batchsql.NewSchema("orders", batchsql.ConflictIgnore, "id")
+	invalid := &batchsql.Schema{Columns: []string{"id"}}
+
+	var requests []*batchsql.Request
+	for i := 0; i < 250; i++ {
+		requests = append(requests, batchsql.NewRequest(users).SetInt64("id", int64(i)))
+		if i%100 == 0 {
+			requests = append(requests, batchsql.NewRequest(orders).SetInt64("id", int64(i)))
+		}
+	}
+	requests = append(requests, nil, batchsql.NewRequest(invalid).SetInt64("id", 1))
+
+	errs := batch.SubmitMany(ctx, requests)
+	if len(errs) != len(requests) {
+		t.Fatalf("expected %d errors, got %d", len(requests), len(errs))
+	}
+	n := len(requests)
+	if !errors.Is(errs[n-2], batchsql.ErrEmptyRequest) || !errors.Is(errs[n-1], batchsql.ErrEmptySchemaName) {
+		t.Fatalf("unexpected validation errors: %v, %v", errs[n-2], errs[n-1])
+	}
+	if err := errors.Join(errs[:n-2]...); err != nil {
+		t.Fatalf("unexpected submit error: %v", err)
+	}
+
+	waitRowsWritten(t, batch, 253)
+
+	// 两个整批不经过缓冲区，按 FlushSize 原样执行（异步，彼此顺序不定）
+	var full []int64
+	for _, b := range mock.SnapshotExecutedBatches() {
+		if len(b) == 100 {
+			full = append(full, b[0]["id"].(int64))
+		}
+	}
+	if len(full) != 2 || full[0]+full[1] != 100 {
+		t.Fatalf("expected two direct batches of users starting at 0 and 100, got %v", full)
+	}
+	if s := batch.Stats(); s.Submitted != 253 || s.Tables["orders"].RowsWritten != 3 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestSubmitMany_DirectFailureAndClosed(t *testing.T) {
+	schema := batchsql.NewSchema("users", batchsql.ConflictIgnore, "id")
+	requests := []*batchsql.Request{
+		batchsql.NewRequest(schema).SetInt64("id", 1),
+		batchsql.NewRequest(schema).SetInt64("id", 2),
+	}
+
+	completed := make(chan error, len(requests))
+	for _, r := range requests {
+		r.OnComplete(func(err error) { completed <- err })
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batch := batchsql.NewBatchSQL(ctx, 10, 2, time.Hour, batchsql.NewThrottledBatchExecutor(nonRetryProcessor{}))
+	errc := batch.ErrorChan(10)
+	if err := errors.Join(batch.SubmitMany(ctx, requests)...); err != nil {
+		t.Fatalf("direct batch should be accepted, got %v", err)
+	}
+	for i := range requests {
+		select {
+		case err := <-completed:
+			var se *batchsql.SchemaError
+			if !errors.As(err, &se) || se.Table != "users" {
+				t.Fatalf("expected SchemaError for request %d, got %v", i, err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected completion for request %d", i)
+		}
+	}
+	select {
+	case err := <-errc:
+		var se *batchsql.SchemaError
+		if !errors.As(err, &se) {
+			t.Fatalf("expected SchemaError on ErrorChan, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected direct batch failure on ErrorChan")
+	}
+
+	cancel()
+	time.Sleep(10 * time.Millisecond)
+	for i, err := range batch.SubmitMany(context.Background(), requests) {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected closed batch to reject request %d, got %v", i, err)
+		}
+	}
+}
+
+func TestSubmitMany_DirectPanicDoesNotReachCaller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	exec := &panicOnceExecutor{}
+	batch := batchsql.NewBatchSQL(ctx, 10, 2, time.Hour, exec)
+	schema := batchsql.NewSchema("users", batchsql.ConflictIgnore, "id")
+	completed := make(chan error, 2)
+	requests := []*batchsql.Request{
+		batchsql.NewRequest(schema).SetInt64("id", 1).OnComplete(func(err error) { completed <- err }),
+		batchsql.NewRequest(schema).SetInt64("id", 2).OnComplete(func(err error) { completed <- err }),
+	}
+	if err := errors.Join(batch.SubmitMany(ctx, requests)...); err != nil {
+		t.Fatalf("submit many: %v", err)
+	}
+	for range requests {
+		select {
+		case err := <-completed:
+			if !errors.Is(err, batchsql.ErrBatchPanicked) {
+				t.Fatalf("expected ErrBatchPanicked, got %v", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected completion after panic")
+		}
+	}
+
+	// 之后的整批照常执行
+	if err := errors.Join(batch.SubmitMany(ctx, []*batchsql.Request{
+		batchsql.NewRequest(schema).SetInt64("id", 3),
+		batchsql.NewRequest(schema).SetInt64("id", 4),
+	})...); err != nil {
+		t.Fatalf("submit many: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) && exec.rows.Load() != 2 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if exec.rows.Load() != 2 {
+		t.Fatalf("expected later direct batch to execute, rows=%d", exec.rows.Load())
+	}
+}
+
+func TestSubmitMany_DirectBatchesUseSchemaFlushSize(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, mock := batchsql.NewBatchSQLWithMock(ctx, batchsql.PipelineConfig{
+		BufferSize:        1000,
+		FlushSize:         100,
+		FlushInterval:     time.Hour,
+		PerSchemaPipeline: true,
+		SchemaPipelines:   map[string]batchsql.SchemaPipelineConfig{"users": {FlushSize: 10}},
+	})
+	users := batchsql.NewSchema("users", batchsql.ConflictIgnore, "id")
+
+	var requests []*batchsql.Request
+	for i := 0; i < 30; i++ {
+		requests = append(requests, batchsql.NewRequest(users).SetInt64("id", int64(i)))
+	}
+	if err := errors.Join(batch.SubmitMany(ctx, requests)...); err != nil {
+		t.Fatalf("submit many: %v", err)
+	}
+	waitRowsWritten(t, batch, 30)
+	for _, b := range mock.SnapshotExecutedBatches() {
+		if len(b) != 10 {
+			t.Fatalf("expected direct batches of the overridden FlushSize 10, got %d rows", len(b))
+		}
+	}
+}
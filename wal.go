@@ -0,0 +1,488 @@
+package batchsql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WALConfig 预写日志配置（Dir 为空=关闭）
+//
+// 启用后 Submit 先将请求追加到日志段再入队，批次执行成功后写入确认（checkpoint）；
+// 进程崩溃或上下文取消时仍在缓冲/在途的请求，会在下次 OpenWAL 时重放，提供至少一次（at-least-once）投递
+type WALConfig struct {
+	// Dir 日志目录（不存在时自动创建）；同一目录同一时刻只能被一个 BatchSQL 使用
+	Dir string
+	// SegmentSize 单个日志段的最大字节数，写满后轮转；<=0 使用默认值 64MB
+	SegmentSize int64
+	// SyncWrites 每次写入后 fsync（可抵御掉电，代价是显著增加 Submit 延迟）；
+	// 默认仅保证写入操作系统页缓存，可抵御进程崩溃/OOM
+	SyncWrites bool
+}
+
+const (
+	defaultWALSegmentSize = 64 << 20
+	walSegmentExt         = ".wal"
+
+	walRecordEntry byte = 1 // 负载：LSN + 编码后的请求
+	walRecordAck   byte = 2 // 负载：已确认的 LSN 列表
+	walRecordBatch byte = 3 // 负载：批次 id + 批内 LSN 列表（幂等模式下执行前写入）
+)
+
+// walSegment 日志段；条目与其确认记录写在同一段内，段内条目全部确认后即可独立删除
+type walSegment struct {
+	id      uint64
+	path    string
+	file    *os.File
+	size    int64
+	pending int  // 未确认条目数
+	sealed  bool // 已轮转（不再追加新条目）
+}
+
+// writeAheadLog 按段组织的预写日志
+type writeAheadLog struct {
+	cfg      WALConfig
+	mu       sync.Mutex
+	closed   bool
+	nextLSN  uint64
+	nextID   uint64
+	active   *walSegment
+	segments map[uint64]*walSegment
+	buf      []byte
+	epoch    [16]byte // 本次打开的随机标识，参与批次 id 计算（目录清空后 LSN 会从 1 重新开始）
+}
+
+// walBatchRecord 日志中记录的批次边界
+type walBatchRecord struct {
+	id   string
+	lsns []uint64
+}
+
+// walBatch 重放时按记录恢复的原批次
+type walBatch struct {
+	id       string
+	requests []*Request
+}
+
+// openWAL 打开日志目录，返回日志、已记录边界的未确认批次与其余需要重放的未确认请求（均按写入顺序）
+func openWAL(cfg WALConfig) (*writeAheadLog, []walBatch, []*Request, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = defaultWALSegmentSize
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, nil, nil, fmt.Errorf("batchsql: wal: %w", err)
+	}
+	ids, err := listWALSegments(cfg.Dir)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	w := &writeAheadLog{cfg: cfg, nextLSN: 1, segments: make(map[uint64]*walSegment)}
+	_, _ = rand.Read(w.epoch[:])
+	schemas := make(schemaCache)
+	var (
+		pending []*Request
+		records []walBatchRecord
+	)
+	for _, id := range ids {
+		seg, reqs, recs, err := w.recoverSegment(id, schemas)
+		if err != nil {
+			w.close()
+			return nil, nil, nil, err
+		}
+		pending = append(pending, reqs...)
+		records = append(records, recs...)
+		w.nextID = id + 1
+		if seg != nil {
+			w.segments[id] = seg
+		}
+	}
+	if err := w.rotate(); err != nil {
+		w.close()
+		return nil, nil, nil, err
+	}
+	batches, replay := groupWALBatches(pending, records)
+	return w, batches, replay, nil
+}
+
+// groupWALBatches 将未确认请求按批次记录分组；批次顺序按其首个请求的位置
+func groupWALBatches(pending []*Request, records []walBatchRecord) ([]walBatch, []*Request) {
+	if len(records) == 0 {
+		return nil, pending
+	}
+	byLSN := make(map[uint64]int)
+	for i, rec := range records {
+		for _, lsn := range rec.lsns {
+			byLSN[lsn] = i
+		}
+	}
+	var (
+		batches []walBatch
+		replay  []*Request
+	)
+	index := make(map[int]int) // 记录下标 -> batches 下标
+	for _, r := range pending {
+		i, ok := byLSN[r.walLSN]
+		if !ok {
+			replay = append(replay, r)
+			continue
+		}
+		j, ok := index[i]
+		if !ok {
+			j = len(batches)
+			index[i] = j
+			batches = append(batches, walBatch{id: records[i].id})
+		}
+		batches[j].requests = append(batches[j].requests, r)
+	}
+	return batches, replay
+}
+
+// listWALSegments 按段号升序列出日志段
+func listWALSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("batchsql: wal: %w", err)
+	}
+	var ids []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 16, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (w *writeAheadLog) segmentPath(id uint64) string {
+	return filepath.Join(w.cfg.Dir, fmt.Sprintf("%016x%s", id, walSegmentExt))
+}
+
+// recoverSegment 读取日志段并返回未确认的请求与批次记录；全部已确认的段直接删除（返回 nil 段）
+// 末尾的不完整/校验失败记录（崩溃时写到一半）会被截断，保证后续追加的确认记录可读
+func (w *writeAheadLog) recoverSegment(id uint64, schemas schemaCache) (*walSegment, []*Request, []walBatchRecord, error) {
+	path := w.segmentPath(id)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("batchsql: wal: %w", err)
+	}
+
+	type entry struct {
+		lsn     uint64
+		payload []byte
+	}
+	var (
+		entries []entry
+		records []walBatchRecord
+	)
+	acked := make(map[uint64]bool)
+	off := 0
+	for {
+		payload, next, ok := nextFrame(data, off)
+		if !ok {
+			break
+		}
+		d := decoder{buf: payload}
+		switch d.byte() {
+		case walRecordEntry:
+			lsn := d.uvarint()
+			entries = append(entries, entry{lsn: lsn, payload: payload[d.off:]})
+			if lsn >= w.nextLSN {
+				w.nextLSN = lsn + 1
+			}
+		case walRecordAck:
+			for i, cnt := uint64(0), d.count(); i < cnt; i++ {
+				acked[d.uvarint()] = true
+			}
+		case walRecordBatch:
+			rec := walBatchRecord{id: d.string()}
+			for i, cnt := uint64(0), d.count(); i < cnt; i++ {
+				rec.lsns = append(rec.lsns, d.uvarint())
+			}
+			records = append(records, rec)
+		}
+		if d.err != nil {
+			return nil, nil, nil, fmt.Errorf("batchsql: wal segment %s: %w", path, d.err)
+		}
+		off = next
+	}
+
+	seg := &walSegment{id: id, path: path, size: int64(off), sealed: true}
+	var pending []*Request
+	for _, e := range entries {
+		if acked[e.lsn] {
+			continue
+		}
+		r, err := decodeRequest(e.payload, schemas)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("batchsql: wal segment %s: %w", path, err)
+		}
+		r.walSeg, r.walLSN = seg, e.lsn
+		pending = append(pending, r)
+	}
+	if len(pending) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, nil, fmt.Errorf("batchsql: wal: %w", err)
+		}
+		return nil, nil, nil, nil
+	}
+
+	seg.pending = len(pending)
+	if off < len(data) {
+		if err := os.Truncate(path, int64(off)); err != nil {
+			return nil, nil, nil, fmt.Errorf("batchsql: wal: %w", err)
+		}
+	}
+	if seg.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644); err != nil {
+		return nil, nil, nil, fmt.Errorf("batchsql: wal: %w", err)
+	}
+	return seg, pending, records, nil
+}
+
+// rotate 创建新段并封存当前活动段（调用方持有锁或处于初始化阶段）；失败时保持原活动段不变
+func (w *writeAheadLog) rotate() error {
+	id := w.nextID
+	path := w.segmentPath(id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("batchsql: wal: %w", err)
+	}
+	w.nextID++
+	if prev := w.active; prev != nil {
+		prev.sealed = true
+		w.releaseIfDone(prev)
+	}
+	w.active = &walSegment{id: id, path: path, file: f}
+	w.segments[id] = w.active
+	return nil
+}
+
+// releaseIfDone 删除已封存且全部确认的段
+func (w *writeAheadLog) releaseIfDone(seg *walSegment) {
+	if !seg.sealed || seg.pending > 0 {
+		return
+	}
+	_ = seg.file.Close()
+	_ = os.Remove(seg.path)
+	delete(w.segments, seg.id)
+}
+
+// writeRecord 将负载以记录格式写入指定段
+func (w *writeAheadLog) writeRecord(seg *walSegment, payload []byte) error {
+	rec := appendFrame(make([]byte, 0, frameHeaderSize+len(payload)), payload)
+	if _, err := seg.file.Write(rec); err != nil {
+		// 截掉可能写入一半的记录，避免其后的记录在恢复时不可读
+		_ = seg.file.Truncate(seg.size)
+		return fmt.Errorf("batchsql: wal write: %w", err)
+	}
+	seg.size += int64(len(rec))
+	if w.cfg.SyncWrites {
+		if err := seg.file.Sync(); err != nil {
+			return fmt.Errorf("batchsql: wal sync: %w", err)
+		}
+	}
+	return nil
+}
+
+// append 追加请求并记录其所在段与 LSN
+func (w *writeAheadLog) append(r *Request) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return ErrWALClosed
+	}
+
+	lsn := w.nextLSN
+	payload := binary.AppendUvarint(append(w.buf[:0], walRecordEntry), lsn)
+	payload, err := appendRequest(payload, r)
+	if err != nil {
+		return err
+	}
+	w.buf = payload
+	if err := w.writeRecord(w.active, payload); err != nil {
+		return err
+	}
+	w.nextLSN++
+	r.walSeg, r.walLSN = w.active, lsn
+	w.active.pending++
+	if w.active.size >= w.cfg.SegmentSize {
+		// 轮转失败不影响本次写入：继续写当前段，下次追加时重试
+		_ = w.rotate()
+	}
+	return nil
+}
+
+// markBatch 在批次执行前记录批次边界，返回由本次打开标识、表名与批内 LSN 决定的批次 id
+// 批内请求均未记录到日志时返回空串；记录写入批内最小 LSN 所在的段，该段在批次确认前不会删除
+func (w *writeAheadLog) markBatch(table string, requests []*Request) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return "", ErrWALClosed
+	}
+
+	var (
+		seg    *walSegment
+		minLSN uint64
+	)
+	lsns := make([]uint64, 0, len(requests))
+	for _, r := range requests {
+		if r.walSeg == nil {
+			continue
+		}
+		if seg == nil || r.walLSN < minLSN {
+			seg, minLSN = r.walSeg, r.walLSN
+		}
+		lsns = append(lsns, r.walLSN)
+	}
+	if seg == nil {
+		return "", nil
+	}
+	slices.Sort(lsns)
+
+	h := sha256.New()
+	h.Write(w.epoch[:])
+	h.Write(appendString(nil, table))
+	var buf []byte
+	for _, lsn := range lsns {
+		buf = binary.AppendUvarint(buf, lsn)
+	}
+	h.Write(buf)
+	id := hex.EncodeToString(h.Sum(nil)[:16])
+
+	payload := appendString(append(w.buf[:0], walRecordBatch), id)
+	payload = binary.AppendUvarint(payload, uint64(len(lsns)))
+	payload = append(payload, buf...)
+	w.buf = payload
+	if err := w.writeRecord(seg, payload); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// ack 确认请求已持久化（checkpoint）；未记录到日志或已确认的请求会被忽略
+// 日志关闭后不再写入确认，相关请求将在下次打开时重放（至少一次语义）
+func (w *writeAheadLog) ack(requests []*Request) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+
+	bySeg := make(map[*walSegment][]uint64)
+	for _, r := range requests {
+		if r.walSeg != nil {
+			bySeg[r.walSeg] = append(bySeg[r.walSeg], r.walLSN)
+			r.walSeg = nil
+		}
+	}
+	var errs []error
+	for seg, lsns := range bySeg {
+		seg.pending -= len(lsns)
+		if seg.sealed && seg.pending == 0 {
+			// 整段即将删除，无需再写确认记录
+			w.releaseIfDone(seg)
+			continue
+		}
+		payload := binary.AppendUvarint(append(w.buf[:0], walRecordAck), uint64(len(lsns)))
+		for _, lsn := range lsns {
+			payload = binary.AppendUvarint(payload, lsn)
+		}
+		w.buf = payload
+		if err := w.writeRecord(seg, payload); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// close 关闭所有段文件；已全部确认的段直接删除
+func (w *writeAheadLog) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	w.closed = true
+	for _, seg := range w.segments {
+		if seg.file != nil {
+			_ = seg.file.Close()
+		}
+		if seg.pending == 0 {
+			_ = os.Remove(seg.path)
+		}
+	}
+}
+
+// OpenWAL 为 BatchSQL 开启预写日志，并重放目录中未确认的请求；返回重放的请求数
+// 需在首次 Submit 前调用且只能调用一次；重放的请求经正常管道执行，成功后确认
+// 部分请求入队失败时继续重放其余请求，返回已重放数与包含未重放数的错误（未重放的请求保留在日志中）
+// （幂等模式下已记录边界的批次在返回前按原批次与 id 同步执行）
+// 说明：
+// - 批次最终失败的请求不会确认，保留到下次启动时重放
+// - 创建时 ctx 取消后日志自动关闭；此后才完成的在途批次不再确认，下次启动会重复投递（至少一次语义，下游需幂等）
+func (b *BatchSQL) OpenWAL(cfg WALConfig) (int, error) {
+	if b.wal != nil {
+		return 0, fmt.Errorf("batchsql: wal already opened")
+	}
+	w, batches, replay, err := openWAL(cfg)
+	if err != nil {
+		return 0, err
+	}
+	b.wal = w
+	go func() {
+		<-b.ctx.Done()
+		w.close()
+	}()
+
+	// 已记录边界的批次按原批次与 id 同步执行（幂等模式下已提交的批次被去重表跳过），失败的请求保留在日志中
+	n := 0
+	for _, rb := range batches {
+		b.replayWALBatch(rb)
+		n += len(rb.requests)
+	}
+	// 单个请求入队失败不中断重放：已入队的请求照常执行，未入队的保留在日志中待下次启动重放
+	var errs []error
+	for _, r := range replay {
+		if err := b.enqueue(b.ctx, r.schema, r, false, false); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n++
+	}
+	if n > 0 {
+		b.logger.log(b.ctx, slog.LevelInfo, "batchsql: wal replayed", slog.Int("requests", n), slog.Int("batches", len(batches)))
+	}
+	if len(errs) > 0 {
+		return n, fmt.Errorf("batchsql: wal replay: %d of %d requests not replayed: %w", len(errs), n+len(errs), errors.Join(errs...))
+	}
+	return n, nil
+}
+
+// replayWALBatch 执行一个已记录边界的批次（不经管道，不再按字节切分，保证批次与 id 不变）
+func (b *BatchSQL) replayWALBatch(rb walBatch) {
+	defer func() {
+		if r := recover(); r != nil {
+			b.logger.log(b.ctx, slog.LevelError, "batchsql: wal replay panicked", slog.String("batch_id", rb.id), slog.Any("panic", r))
+		}
+	}()
+	_ = b.executeChunk(WithBatchID(b.ctx, rb.id), rb.requests[0].schema, rb.requests)
+}
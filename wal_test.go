@@ -0,0 +1,258 @@
+package batchsql_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rushairer/batchsql"
+)
+
+// openWALBatch 创建启用 WAL 的 BatchSQL，返回重放数量
+func openWALBatch(t *testing.T, ctx context.Context, dir string, segmentSize int64, flushSize uint32, executor batchsql.BatchExecutor) (*batchsql.BatchSQL, int) {
+	t.Helper()
+	batch := batchsql.NewBatchSQL(ctx, 100, flushSize, 10*time.Millisecond, executor)
+	n, err := batch.OpenWAL(batchsql.WALConfig{Dir: dir, SegmentSize: segmentSize})
+	if err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	return batch, n
+}
+
+func waitRowsWritten(t *testing.T, batch *batchsql.BatchSQL, rows int64) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for batch.Stats().RowsWritten < rows && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := batch.Stats().RowsWritten; got != rows {
+		t.Fatalf("expected %d rows written, got %d", rows, got)
+	}
+}
+
+func walSegments(t *testing.T, dir string) []string {
+	t.Helper()
+	files, err := filepath.Glob(filepath.Join(dir, "*.wal"))
+	if err != nil {
+		t.Fatalf("glob: %v", err)
+	}
+	return files
+}
+
+func TestWAL_ReplaysUnflushedRequestsAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id", "name", "amount", "paid", "at", "blob", "note")
+	at := time.Date(2024, 5, 6, 7, 8, 9, 10, time.FixedZone("CST", 8*3600))
+
+	// 第一次运行：刷新间隔足够长，请求停留在管道缓冲中时 ctx 被取消
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	batch1 := batchsql.NewBatchSQL(ctx1, 100, 100, time.Hour, batchsql.NewMockExecutor())
+	if n, err := batch1.OpenWAL(batchsql.WALConfig{Dir: dir}); err != nil || n != 0 {
+		t.Fatalf("expected empty wal, got n=%d err=%v", n, err)
+	}
+	for i := 0; i < 3; i++ {
+		req := batchsql.NewRequest(schema).
+			SetInt64("id", int64(i)).
+			SetString("name", "user").
+			SetFloat64("amount", 12.5).
+			SetBool("paid", true).
+			SetTime("at", at).
+			SetBytes("blob", []byte{1, 2, 3}).
+			SetNull("note")
+		if err := batch1.Submit(ctx1, req); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	cancel1()
+	time.Sleep(20 * time.Millisecond)
+
+	// 第二次运行：重放未确认的请求
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	mock := batchsql.NewMockExecutor()
+	batch2, replayed := openWALBatch(t, ctx2, dir, 0, 3, mock)
+	if replayed != 3 {
+		t.Fatalf("expected 3 replayed requests, got %d", replayed)
+	}
+	waitRowsWritten(t, batch2, 3)
+
+	batches := mock.SnapshotExecutedBatches()
+	if len(batches) != 1 || len(batches[0]) != 3 {
+		t.Fatalf("expected one replayed batch of 3 rows, got %v", batches)
+	}
+	row := batches[0][2]
+	if row["id"] != int64(2) || row["name"] != "user" || row["amount"] != 12.5 || row["paid"] != true || row["note"] != nil {
+		t.Fatalf("unexpected replayed row: %v", row)
+	}
+	if got, ok := row["at"].(time.Time); !ok || !got.Equal(at) {
+		t.Fatalf("unexpected replayed time: %v", row["at"])
+	}
+	if got, ok := row["blob"].([]byte); !ok || !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Fatalf("unexpected replayed bytes: %v", row["blob"])
+	}
+	cancel2()
+	time.Sleep(20 * time.Millisecond)
+
+	// 第三次运行：已确认的请求不再重放
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	if _, replayed := openWALBatch(t, ctx3, dir, 0, 3, batchsql.NewMockExecutor()); replayed != 0 {
+		t.Fatalf("expected checkpointed requests not to be replayed, got %d", replayed)
+	}
+}
+
+func TestWAL_FailedBatchIsKeptForReplay(t *testing.T) {
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id")
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	batch1, _ := openWALBatch(t, ctx1, dir, 0, 1, batchsql.NewThrottledBatchExecutor(nonRetryProcessor{}))
+	if err := batch1.Submit(ctx1, batchsql.NewRequest(schema).SetInt64("id", 7)); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for batch1.Stats().Failed < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel1()
+	time.Sleep(20 * time.Millisecond)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	batch2, replayed := openWALBatch(t, ctx2, dir, 0, 1, batchsql.NewMockExecutor())
+	if replayed != 1 {
+		t.Fatalf("expected failed request to be replayed, got %d", replayed)
+	}
+	waitRowsWritten(t, batch2, 1)
+}
+
+func TestWAL_RotatesAndRemovesCheckpointedSegments(t *testing.T) {
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id", "name")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch, _ := openWALBatch(t, ctx, dir, 128, 10, batchsql.NewMockExecutor())
+	for i := 0; i < 50; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i)).SetString("name", "rotate")); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	waitRowsWritten(t, batch, 50)
+	if files := walSegments(t, dir); len(files) != 1 {
+		t.Fatalf("expected only the active segment to remain, got %v", files)
+	}
+}
+
+func TestWAL_TruncatesTornTailAndRejectsUnsupportedTypes(t *testing.T) {
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id", "meta")
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	batch1 := batchsql.NewBatchSQL(ctx1, 100, 100, time.Hour, batchsql.NewMockExecutor())
+	if _, err := batch1.OpenWAL(batchsql.WALConfig{Dir: dir}); err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	err := batch1.Submit(ctx1, batchsql.NewRequest(schema).SetInt64("id", 1).Set("meta", struct{}{}))
+	if !errors.Is(err, batchsql.ErrInvalidColumnType) {
+		t.Fatalf("expected ErrInvalidColumnType, got %v", err)
+	}
+	if err := batch1.Submit(ctx1, batchsql.NewRequest(schema).SetInt64("id", 2).SetString("meta", "ok")); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	cancel1()
+	time.Sleep(20 * time.Millisecond)
+
+	// 模拟崩溃时写到一半的记录
+	files := walSegments(t, dir)
+	if len(files) != 1 {
+		t.Fatalf("expected one segment, got %v", files)
+	}
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("open segment: %v", err)
+	}
+	_, _ = f.Write([]byte{0x40, 0, 0, 0, 0xde, 0xad})
+	_ = f.Close()
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	batch2, replayed := openWALBatch(t, ctx2, dir, 0, 1, batchsql.NewMockExecutor())
+	if replayed != 1 {
+		t.Fatalf("expected the intact record to be replayed, got %d", replayed)
+	}
+	waitRowsWritten(t, batch2, 1)
+}
+
+func TestWAL_OrderingAppendFailureDoesNotStallLaterBatches(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	batch := batchsql.NewBatchSQLWithConfig(ctx, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     2,
+		FlushInterval: 10 * time.Millisecond,
+		Ordering:      batchsql.OrderingConfig{Mode: batchsql.OrderingPerSchema},
+	}, batchsql.NewMockExecutor())
+	if _, err := batch.OpenWAL(batchsql.WALConfig{Dir: t.TempDir()}); err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	schema := batchsql.NewSchema("events", batchsql.ConflictIgnore, "id", "payload")
+
+	// 编码器不支持的值类型：写日志失败，请求未入队
+	bad := batchsql.NewRequest(schema).SetInt64("id", 0).Set("payload", struct{}{})
+	if err := batch.Submit(ctx, bad); !errors.Is(err, batchsql.ErrInvalidColumnType) {
+		t.Fatalf("expected ErrInvalidColumnType, got %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		if err := batch.Submit(ctx, batchsql.NewRequest(schema).SetInt64("id", int64(i)).SetString("payload", "ok")); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	waitRowsWritten(t, batch, 4)
+}
+
+func TestWAL_ReplayReportsRequestsNotReplayed(t *testing.T) {
+	dir := t.TempDir()
+	schema := batchsql.NewSchema("billing", batchsql.ConflictIgnore, "id")
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	batch1 := batchsql.NewBatchSQL(ctx1, 100, 100, time.Hour, batchsql.NewMockExecutor())
+	if _, err := batch1.OpenWAL(batchsql.WALConfig{Dir: dir}); err != nil {
+		t.Fatalf("open wal: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := batch1.Submit(ctx1, batchsql.NewRequest(schema).SetInt64("id", int64(i))); err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+	}
+	cancel1()
+	time.Sleep(20 * time.Millisecond)
+
+	// 第二次运行：内存预算只容纳一个请求且超出时直接拒绝，其余请求入队失败；重放不中断并报告未重放数
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	batch2 := batchsql.NewBatchSQLWithConfig(ctx2, batchsql.PipelineConfig{
+		BufferSize:    100,
+		FlushSize:     100,
+		FlushInterval: time.Hour,
+		Memory:        batchsql.MemoryConfig{MaxBufferedBytes: 1, Shed: true},
+	}, batchsql.NewMockExecutor())
+	n, err := batch2.OpenWAL(batchsql.WALConfig{Dir: dir})
+	if n != 1 || !errors.Is(err, batchsql.ErrMemoryBudgetExceeded) || !strings.Contains(err.Error(), "2 of 3 requests not replayed") {
+		t.Fatalf("expected 1 replayed and 2 reported as not replayed, got n=%d err=%v", n, err)
+	}
+	cancel2()
+	time.Sleep(20 * time.Millisecond)
+
+	// 第三次运行：未重放的请求仍保留在日志中
+	ctx3, cancel3 := context.WithCancel(context.Background())
+	defer cancel3()
+	batch3, replayed := openWALBatch(t, ctx3, dir, 0, 3, batchsql.NewMockExecutor())
+	if replayed != 3 {
+		t.Fatalf("expected 3 requests to be replayed again, got %d", replayed)
+	}
+	waitRowsWritten(t, batch3, 3)
+}